@@ -0,0 +1,251 @@
+package controllers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	stdjson "encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/mocak/tbupt/json"
+	"github.com/mocak/tbupt/models"
+)
+
+var (
+	errUnauthenticated  = errors.New("api key or bearer token is required")
+	errAPIKeyInvalid    = errors.New("api key is invalid")
+	errTokenInvalid     = errors.New("bearer token is invalid")
+	errTokenExpired     = errors.New("bearer token is expired")
+	errDeckForbidden    = errors.New("role on the deck does not allow the operation")
+	errDeckOwnerOnly    = errors.New("access of the deck can be changed only by its owner")
+	errPrincipalInvalid = errors.New("principal must not be empty")
+)
+
+const (
+	// apiKeyHeader carries the static api key of the request
+	apiKeyHeader = "X-API-Key"
+	// bearerPrefix is the scheme of the bearer tokens in Authorization header
+	bearerPrefix = "Bearer "
+)
+
+// principalKey is the context key of the authenticated principal
+type principalKey struct{}
+
+// tokenClaims is the signed payload of the bearer tokens
+type tokenClaims struct {
+	Subject   string `json:"sub"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// Authenticator identifies the principals of the requests by static api keys or bearer tokens
+// Bearer tokens are the base64url encoded claims and their HMAC-SHA256 signature joined by a dot
+type Authenticator struct {
+	// keys maps the api keys to their principals
+	keys   map[string]string
+	secret []byte
+}
+
+// NewAuthenticator returns the authenticator of the api keys mapped to their principals
+// and the bearer tokens signed by the secret, bearer tokens are rejected if secret is empty
+func NewAuthenticator(keys map[string]string, secret []byte) *Authenticator {
+	return &Authenticator{keys: keys, secret: secret}
+}
+
+// IssueToken returns the bearer token of the principal valid until expiresAt
+func (a *Authenticator) IssueToken(principal string, expiresAt time.Time) (string, error) {
+	if principal == "" {
+		return "", errPrincipalInvalid
+	}
+	if len(a.secret) == 0 {
+		return "", errTokenInvalid
+	}
+	claims, err := stdjson.Marshal(tokenClaims{Subject: principal, ExpiresAt: expiresAt.Unix()})
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(claims)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(a.sign(payload)), nil
+}
+
+// Authenticate returns the principal of the request
+func (a *Authenticator) Authenticate(r *http.Request) (string, error) {
+	if key := r.Header.Get(apiKeyHeader); key != "" {
+		return a.principalOfKey(key)
+	}
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, bearerPrefix) {
+		return "", errUnauthenticated
+	}
+	return a.principalOfToken(strings.TrimPrefix(auth, bearerPrefix))
+}
+
+// Middleware rejects the unauthenticated requests with HTTP 401
+// and passes the principal of the others to the handlers in the request context
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, err := a.Authenticate(r)
+		if err != nil {
+			unauthorized(w, r, err)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, principal)))
+	})
+}
+
+// unauthorized replies the request with the authentication error and the challenge of the bearer tokens
+func unauthorized(w http.ResponseWriter, r *http.Request, err error) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="tbupt"`)
+	writeError(w, r, err, nil)
+}
+
+// principalOfKey returns the principal of the api key
+// Every key is compared in constant time to not leak the valid keys
+func (a *Authenticator) principalOfKey(key string) (string, error) {
+	principal := ""
+	for k, p := range a.keys {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			principal = p
+		}
+	}
+	if principal == "" {
+		return "", errAPIKeyInvalid
+	}
+	return principal, nil
+}
+
+// principalOfToken verifies the bearer token and returns its principal
+func (a *Authenticator) principalOfToken(token string) (string, error) {
+	if len(a.secret) == 0 {
+		return "", errTokenInvalid
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return "", errTokenInvalid
+	}
+	payload := parts[0]
+	got, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(got, a.sign(payload)) {
+		return "", errTokenInvalid
+	}
+	b, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return "", errTokenInvalid
+	}
+	var claims tokenClaims
+	if err := stdjson.Unmarshal(b, &claims); err != nil || claims.Subject == "" {
+		return "", errTokenInvalid
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return "", errTokenExpired
+	}
+	return claims.Subject, nil
+}
+
+func (a *Authenticator) sign(payload string) []byte {
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// principalOf returns the authenticated principal of the request, empty if authentication is disabled
+func principalOf(r *http.Request) string {
+	principal, _ := r.Context().Value(principalKey{}).(string)
+	return principal
+}
+
+// shareOnly reports whether the request of a deck carries a share token instead of credentials
+func shareOnly(r *http.Request) bool {
+	return r.Header.Get(shareTokenHeader) != "" && mux.Vars(r)["uuid"] != "" &&
+		r.Header.Get(apiKeyHeader) == "" && r.Header.Get("Authorization") == ""
+}
+
+// isMutation reports whether the request may change the deck
+func isMutation(r *http.Request) bool {
+	return r.Method != http.MethodGet && r.Method != http.MethodHead
+}
+
+// restricted reports whether the access of the request to the decks depends on its principal or share token
+func restricted(r *http.Request) bool {
+	return principalOf(r) != "" || r.Header.Get(shareTokenHeader) != ""
+}
+
+// roleOf returns the role of the request on the deck
+// Share token gives its role, otherwise the principal has its role on the deck
+// Requests are given models.RoleFull if authentication is disabled
+// Returns errShareTokenInvalid if share token is not a share of the deck
+func roleOf(r *http.Request, deck *models.Deck) (string, error) {
+	if token := r.Header.Get(shareTokenHeader); token != "" {
+		share := deck.ShareOf(token)
+		if share == nil {
+			return "", errShareTokenInvalid
+		}
+		return share.Role, nil
+	}
+	if principal := principalOf(r); principal != "" {
+		return deck.RoleOf(principal), nil
+	}
+	return models.RoleFull, nil
+}
+
+// deckOfOwner is used to get models.Deck record by URL to change its access
+// Sets errDeckOwnerOnly error response if the request is not of the owner of the deck
+func (d *Decks) deckOfOwner(w http.ResponseWriter, r *http.Request) (*models.Deck, error) {
+	deck, err := d.deckWithRole(w, r, models.RoleFull)
+	if err != nil {
+		return nil, err
+	}
+	if !isOwner(r, deck) {
+		writeError(w, r, errDeckOwnerOnly, deck)
+		return nil, errDeckOwnerOnly
+	}
+	return deck, nil
+}
+
+// isOwner reports whether the request is of the owner of the deck
+// Decks without owner principal are owned by every principal, share tokens never own a deck
+func isOwner(r *http.Request, deck *models.Deck) bool {
+	if r.Header.Get(shareTokenHeader) != "" {
+		return false
+	}
+	principal := principalOf(r)
+	return principal == "" || deck.Principal == "" || deck.Principal == principal
+}
+
+// grantsRequest is the principals granted to change the deck
+type grantsRequest struct {
+	Grants []string `json:"grants"`
+}
+
+// Grants is used to replace the principals granted to change the deck besides its owner
+// Only the owner can change the grants if authentication is enabled
+// Replies the request with deck resource info and HTTP 200 if succeed
+//
+// PUT /deck/:uuid/grants
+func (d *Decks) Grants(w http.ResponseWriter, r *http.Request) {
+	grantsReq := grantsRequest{}
+	if err := json.DecodeBody(w, r, &grantsReq); err != nil {
+		return
+	}
+
+	deck, err := d.deckOfOwner(w, r)
+	if err != nil {
+		return
+	}
+	if err := ifMatch(r, deck); err != nil {
+		writeError(w, r, err, deck)
+		return
+	}
+
+	if err := d.ds.Grant(deck, grantsReq.Grants); err != nil {
+		writeError(w, r, err, deck)
+		return
+	}
+	setETag(w, deck)
+	json.Response(w, r, newDeckResponse(deck), http.StatusOK)
+}
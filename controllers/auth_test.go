@@ -0,0 +1,106 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mocak/tbupt/models"
+)
+
+func TestAuthenticator_Authenticate(t *testing.T) {
+	a := NewAuthenticator(map[string]string{"alice-key": "alice"}, []byte("secret"))
+	valid, _ := a.IssueToken("bob", time.Now().Add(time.Hour))
+	expired, _ := a.IssueToken("bob", time.Now().Add(-time.Hour))
+	forged, _ := NewAuthenticator(nil, []byte("other")).IssueToken("bob", time.Now().Add(time.Hour))
+
+	tests := []struct {
+		name    string
+		header  string
+		value   string
+		want    string
+		wantErr error
+	}{
+		{"api key", apiKeyHeader, "alice-key", "alice", nil},
+		{"invalid api key", apiKeyHeader, "bob-key", "", errAPIKeyInvalid},
+		{"token", "Authorization", bearerPrefix + valid, "bob", nil},
+		{"expired token", "Authorization", bearerPrefix + expired, "", errTokenExpired},
+		{"forged token", "Authorization", bearerPrefix + forged, "", errTokenInvalid},
+		{"malformed token", "Authorization", bearerPrefix + "bob", "", errTokenInvalid},
+		{"basic auth", "Authorization", "Basic Ym9iOmJvYg==", "", errUnauthenticated},
+		{"no credentials", "", "", "", errUnauthenticated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/deck", nil)
+			if tt.header != "" {
+				r.Header.Set(tt.header, tt.value)
+			}
+			got, err := a.Authenticate(r)
+			if got != tt.want || err != tt.wantErr {
+				t.Errorf("Authenticate() got = %v, %v, want %v, %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAuthenticator_IssueToken(t *testing.T) {
+	if _, err := NewAuthenticator(nil, nil).IssueToken("alice", time.Now()); err != errTokenInvalid {
+		t.Errorf("IssueToken() without secret err = %v, want %v", err, errTokenInvalid)
+	}
+	if _, err := NewAuthenticator(nil, []byte("secret")).IssueToken("", time.Now()); err != errPrincipalInvalid {
+		t.Errorf("IssueToken() without principal err = %v, want %v", err, errPrincipalInvalid)
+	}
+}
+
+func TestDecks_Auth(t *testing.T) {
+	auth := NewAuthenticator(map[string]string{"alice-key": "alice", "bob-key": "bob"}, nil)
+	s := NewServer(NewDecks(models.NewDeckService(models.NewCardService())), WithAuth(auth))
+	do := func(method, target, body, key string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		if key != "" {
+			r.Header.Set(apiKeyHeader, key)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := do("POST", "/deck", "{}", ""); w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") == "" {
+		t.Fatalf("Create() without credentials got = %v, want 401 with WWW-Authenticate", w.Code)
+	}
+	created := do("POST", "/deck", `{"principal":"mallory"}`, "alice-key")
+	if !strings.Contains(created.Body.String(), `"Principal":"alice"`) {
+		t.Fatalf("Create() got = %v, want principal alice", created.Body.String())
+	}
+	deckID := strings.Split(strings.Split(created.Body.String(), `"DeckID":"`)[1], `"`)[0]
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		key        string
+		wantStatus int
+	}{
+		{"owner draws", "POST", "/deck/" + deckID + "/draw?count=1", "", "alice-key", http.StatusOK},
+		{"other gets", "GET", "/deck/" + deckID, "", "bob-key", http.StatusOK},
+		{"other draws", "POST", "/deck/" + deckID + "/draw?count=1", "", "bob-key", http.StatusForbidden},
+		{"other deletes", "DELETE", "/deck/" + deckID, "", "bob-key", http.StatusForbidden},
+		{"other grants", "PUT", "/deck/" + deckID + "/grants", `{"grants":["bob"]}`, "bob-key", http.StatusForbidden},
+		{"invalid grant", "PUT", "/deck/" + deckID + "/grants", `{"grants":[""]}`, "alice-key", http.StatusUnprocessableEntity},
+		{"owner grants", "PUT", "/deck/" + deckID + "/grants", `{"grants":["bob"]}`, "alice-key", http.StatusOK},
+		{"granted draws", "POST", "/deck/" + deckID + "/draw?count=1", "", "bob-key", http.StatusOK},
+		{"granted grants", "PUT", "/deck/" + deckID + "/grants", `{"grants":[]}`, "bob-key", http.StatusForbidden},
+		{"granted deletes", "DELETE", "/deck/" + deckID, "", "bob-key", http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := do(tt.method, tt.target, tt.body, tt.key); w.Code != tt.wantStatus {
+				t.Errorf("%s %s status = %v, want %v", tt.method, tt.target, w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
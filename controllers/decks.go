@@ -1,80 +1,344 @@
 package controllers
 
 import (
+	"crypto/subtle"
+	"errors"
+	"expvar"
 	"github.com/gorilla/mux"
 	"github.com/mocak/tbupt/json"
 	"github.com/mocak/tbupt/models"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
-func NewDecks(ds models.DeckService) *Decks {
-	return &Decks{
+var (
+	errOperatorKeyInvalid = errors.New("operator key is required")
+)
+
+// DecksOption is used to configure Decks
+type DecksOption func(*Decks)
+
+// WithOperatorKey enables peeking cards by the requests with the operator key
+// Peeking is disabled by default
+func WithOperatorKey(key string) DecksOption {
+	return func(d *Decks) {
+		d.operatorKey = key
+	}
+}
+
+func NewDecks(ds models.DeckService, opts ...DecksOption) *Decks {
+	d := &Decks{
 		ds: ds,
 	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
 }
 
 type Decks struct {
-	ds models.DeckService
+	ds          models.DeckService
+	operatorKey string
+	// keys stores the responses of the idempotency keys for keyWindow
+	keys      models.IdempotencyStore
+	keyWindow time.Duration
+	// hub publishes the deck events to the streams
+	hub *models.Hub
+	// webhooks are notified of the deck events
+	webhooks *models.Webhooks
 }
 
-type createResponse struct {
+// deckResponse is the deck resource info without cards
+type deckResponse struct {
 	DeckID    string
 	Shuffled  bool
 	Remaining int
+	Owner     string            `json:",omitempty"`
+	Tags      []string          `json:",omitempty"`
+	Principal string            `json:",omitempty"`
+	Grants    []string          `json:",omitempty"`
+	ACL       map[string]string `json:",omitempty"`
+	TTL       int               `json:",omitempty"`
+	ExpiresAt *time.Time        `json:",omitempty"`
+	Decks     int               `json:",omitempty"`
+	CutCard   int               `json:",omitempty"`
+	Seed      *int64            `json:",omitempty"`
+	Shuffler  string            `json:",omitempty"`
+	Fairness  *models.Fairness  `json:",omitempty"`
 }
 
 // Create is used to create deck resource
 // replies the request with created deck resource info and HTTP 201 code if succeed
+// Retries with the same Idempotency-Key header are replied with the first response
 //
 // POST /deck
 func (d *Decks) Create(w http.ResponseWriter, r *http.Request) {
-	deck := models.Deck{}
-	err := json.DecodeBody(w, r, &deck)
+	d.idempotent(w, r, d.create)
+}
+
+// createRequest is the options of the created deck
+// Other fields of the deck like its drawn cards and piles are not set by the clients
+type createRequest struct {
+	Shuffled    bool                `json:"shuffled"`
+	Composition *models.Composition `json:"composition"`
+	Decks       int                 `json:"decks"`
+	Penetration float64             `json:"penetration"`
+	Seed        *int64              `json:"seed"`
+	Shuffler    string              `json:"shuffler"`
+	Fairness    *models.Fairness    `json:"fairness"`
+	Owner       string              `json:"owner"`
+	Tags        []string            `json:"tags"`
+	TTL         int                 `json:"ttl"`
+	Grants      []string            `json:"grants"`
+	ACL         map[string]string   `json:"acl"`
+}
+
+func (d *Decks) create(w http.ResponseWriter, r *http.Request) {
+	createReq := createRequest{}
+	err := json.DecodeBody(w, r, &createReq)
 	if err != nil {
 		return
 	}
 
-	deck.CardCodes = r.URL.Query().Get("cards")
+	deck := models.Deck{
+		Shuffled:    createReq.Shuffled,
+		Composition: createReq.Composition,
+		Decks:       createReq.Decks,
+		Penetration: createReq.Penetration,
+		Seed:        createReq.Seed,
+		Shuffler:    createReq.Shuffler,
+		Fairness:    createReq.Fairness,
+		Owner:       createReq.Owner,
+		Tags:        createReq.Tags,
+		TTL:         createReq.TTL,
+		Grants:      createReq.Grants,
+		ACL:         createReq.ACL,
+		CardCodes:   r.URL.Query().Get("cards"),
+		Actor:       r.Header.Get(actorHeader),
+		Principal:   principalOf(r),
+	}
 	if err := d.ds.Create(&deck); err != nil {
-		json.Error(w, "Unexpected Error", http.StatusInternalServerError)
+		writeError(w, r, err, nil)
 		return
 	}
 
-	cr := createResponse{
+	setETag(w, &deck)
+	json.Response(w, r, newDeckResponse(&deck), http.StatusCreated)
+}
+
+// newDeckResponse returns the resource info of the given deck
+func newDeckResponse(deck *models.Deck) deckResponse {
+	var expiresAt *time.Time
+	if !deck.ExpiresAt.IsZero() {
+		expiresAt = &deck.ExpiresAt
+	}
+	return deckResponse{
 		DeckID:    deck.UUID,
 		Shuffled:  deck.Shuffled,
 		Remaining: deck.Remaining,
+		Owner:     deck.Owner,
+		Tags:      deck.Tags,
+		Principal: deck.Principal,
+		Grants:    deck.Grants,
+		ACL:       deck.ACL,
+		TTL:       deck.TTL,
+		ExpiresAt: expiresAt,
+		Decks:     deck.Decks,
+		CutCard:   deck.CutCard,
+		Seed:      deck.Seed,
+		Shuffler:  deck.Shuffler,
+		Fairness:  deck.Fairness,
 	}
+}
 
-	json.Response(w, cr, http.StatusCreated)
+// deckResponseOf returns the resource info of the given deck as seen by the request
+func (d *Decks) deckResponseOf(r *http.Request, deck *models.Deck) deckResponse {
+	resp := newDeckResponse(deck)
+	if !d.seesAccess(r, deck) {
+		resp.hideAccess()
+	}
+	return resp
+}
+
+// seesAccess reports whether the request is of the owner of the deck or an operator
+func (d *Decks) seesAccess(r *http.Request, deck *models.Deck) bool {
+	return isOwner(r, deck) || d.isOperator(r)
+}
+
+// hideAccess removes the grants, roles and seed of the deck, they are visible only to its owner and operators
+// Seed gives the order of the cards of the decks shuffled by a seeded shuffler
+func (resp *deckResponse) hideAccess() {
+	resp.Grants = nil
+	resp.ACL = nil
+	resp.Seed = nil
+}
+
+// deckSummary is the deck resource info with pile summaries, without cards
+type deckSummary struct {
+	deckResponse
+	CreatedAt time.Time
+	Piles     map[string]pileSummary `json:",omitempty"`
+}
+
+// pileSummary is the pile info without cards
+// Owner is the player key of the hand
+type pileSummary struct {
+	Remaining int
+	Owner     string `json:",omitempty"`
+}
+
+// Get is used to inspect deck resource without revealing its cards
+// Replies the request with deck summary and HTTP 200 if succeed
+//
+// GET /deck/:uuid
+func (d *Decks) Get(w http.ResponseWriter, r *http.Request) {
+	deck, err := d.deckByUUID(w, r)
+	if err != nil {
+		return
+	}
+
+	summary := newDeckSummary(deck)
+	if !d.seesAccess(r, deck) {
+		summary.hideAccess()
+	}
+	setETag(w, deck)
+	json.Response(w, r, summary, http.StatusOK)
+}
+
+// newDeckSummary returns the summary of the given deck
+func newDeckSummary(deck *models.Deck) deckSummary {
+	summary := deckSummary{
+		deckResponse: newDeckResponse(deck),
+		CreatedAt:    deck.CreatedAt,
+	}
+	for name, pile := range deck.Piles {
+		if summary.Piles == nil {
+			summary.Piles = map[string]pileSummary{}
+		}
+		summary.Piles[name] = pileSummary{Remaining: pile.Remaining, Owner: pile.Owner}
+	}
+	return summary
+}
+
+// Delete is used to delete deck resource
+// Replies the request with HTTP 204 if succeed
+//
+// DELETE /deck/:uuid
+func (d *Decks) Delete(w http.ResponseWriter, r *http.Request) {
+	if restricted(r) {
+		// checks the role on the deck
+		if _, err := d.deckByUUID(w, r); err != nil {
+			return
+		}
+	}
+	if err := d.ds.Delete(mux.Vars(r)["uuid"]); err != nil {
+		writeError(w, r, err, nil)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// operatorKeyHeader carries the operator key of the peek requests
+const operatorKeyHeader = "X-Operator-Key"
+
+// Peek is used to see cards on top of the deck without drawing them
+// Count query parameter is the number of cards, 1 by default
+// Requires the operator key, replies the request with card resources and HTTP 200 if succeed
+//
+// GET /deck/:uuid/peek?count=:count
+func (d *Decks) Peek(w http.ResponseWriter, r *http.Request) {
+	if !d.isOperator(r) {
+		writeError(w, r, errOperatorKeyInvalid, nil)
+		return
+	}
+
+	count := 1
+	if v := r.URL.Query().Get("count"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			writeError(w, r, models.ErrCountInvalid, nil)
+			return
+		}
+		count = n
+	}
+
+	deck, err := d.deckByUUID(w, r)
+	if err != nil {
+		return
+	}
+
+	cards, err := d.ds.Peek(deck, count)
+	if err != nil {
+		writeError(w, r, err, deck)
+		return
+	}
+	json.Response(w, r, cards, http.StatusOK)
+}
+
+// isOperator reports whether the request has the operator key
+func (d *Decks) isOperator(r *http.Request) bool {
+	key := r.Header.Get(operatorKeyHeader)
+	return d.operatorKey != "" && subtle.ConstantTimeCompare([]byte(key), []byte(d.operatorKey)) == 1
+}
+
+// Vars is used to read the metrics published by expvar
+// Requires the operator key, the published command line carries the configuration of the server
+//
+// GET /debug/vars
+func (d *Decks) Vars(w http.ResponseWriter, r *http.Request) {
+	if !d.isOperator(r) {
+		writeError(w, r, errOperatorKeyInvalid, nil)
+		return
+	}
+	expvar.Handler().ServeHTTP(w, r)
 }
 
 // Open is used the open deck
 // Replies the request with deck resource with cards and HTTP 200 if succeed
+// Hands of the other players have only their revealed cards
+// Requires models.RoleFull on the deck
+// Replies HTTP 412 if If-Match header does not match the deck version
 //
 // PUT /draw/:uid/open
 func (d *Decks) Open(w http.ResponseWriter, r *http.Request) {
-	deck, err := d.deckByUUID(w, r)
+	deck, err := d.deckWithRole(w, r, models.RoleFull)
 	if err != nil {
 		return
 	}
+	if err := ifMatch(r, deck); err != nil {
+		writeError(w, r, err, deck)
+		return
+	}
 	if err := d.ds.Open(deck); err != nil {
-		json.Error(w, "Unexpected Error", http.StatusInternalServerError)
+		writeError(w, r, err, deck)
 		return
 	}
-	json.Response(w, deck, http.StatusOK)
+	setETag(w, deck)
+	deck.Redact(deck.Player)
+	json.Response(w, r, deck, http.StatusOK)
 }
 
+// reshuffleHeader is set on draw responses when the cut card of the shoe is reached
+const reshuffleHeader = "X-Reshuffle"
+
 type drawRequest struct {
 	Count int `json:"count"`
 }
 
 // Draw used to draw cards from deck resource
 // Replies the request with drawn card resources and HTTP 200
+// Requires models.RoleDraw on the deck
+// Replies HTTP 412 if If-Match header does not match the deck version
+// Retries with the same Idempotency-Key header are replied with the first response
 //
 // POST /deck/:uid/draw
 func (d *Decks) Draw(w http.ResponseWriter, r *http.Request) {
+	d.idempotent(w, r, d.draw)
+}
 
+func (d *Decks) draw(w http.ResponseWriter, r *http.Request) {
 	drawReq := drawRequest{}
 
 	err := json.DecodeBody(w, r, &drawReq)
@@ -82,37 +346,160 @@ func (d *Decks) Draw(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	deck, err := d.deckByUUID(w, r)
+	deck, err := d.deckWithRole(w, r, models.RoleDraw)
 	if err != nil {
 		return
 	}
+	if err := ifMatch(r, deck); err != nil {
+		writeError(w, r, err, deck)
+		return
+	}
 
 	cards, err := d.ds.Draw(deck, drawReq.Count)
 	if err != nil {
-		json.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err, deck)
+		return
+	}
+
+	if deck.Reshuffle {
+		w.Header().Set(reshuffleHeader, "true")
+	}
+	setETag(w, deck)
+	json.Response(w, r, cards, http.StatusOK)
+}
+
+type returnRequest struct {
+	Cards    string `json:"cards"`
+	Position string `json:"position"`
+}
+
+// Return is used to put drawn cards back to the deck
+// at the top, bottom or random positions
+// Replies the request with deck resource info and HTTP 200 if succeed
+//
+// POST /deck/:uid/return
+func (d *Decks) Return(w http.ResponseWriter, r *http.Request) {
+	returnReq := returnRequest{}
+	if err := json.DecodeBody(w, r, &returnReq); err != nil {
+		return
+	}
+
+	deck, err := d.deckByUUID(w, r)
+	if err != nil {
+		return
+	}
+
+	codes := strings.Split(returnReq.Cards, ",")
+	if err := d.ds.Return(deck, codes, returnReq.Position); err != nil {
+		writeError(w, r, err, deck)
+		return
+	}
+	setETag(w, deck)
+	json.Response(w, r, d.deckResponseOf(r, deck), http.StatusOK)
+}
+
+type shuffleRequest struct {
+	Discarded bool   `json:"discarded"`
+	Strategy  string `json:"strategy"`
+	Times     int    `json:"times"`
+}
+
+// Shuffle is used to shuffle remaining cards of the deck in place
+// by the strategy applied given times, uniform once by default
+// Cards of the discard pile are put back before if discarded is set
+// Replies the request with deck resource info and HTTP 200 if succeed
+// Replies HTTP 412 if If-Match header does not match the deck version
+//
+// POST /deck/:uid/shuffle
+func (d *Decks) Shuffle(w http.ResponseWriter, r *http.Request) {
+	shuffleReq := shuffleRequest{}
+	if err := json.DecodeBody(w, r, &shuffleReq); err != nil {
+		return
+	}
+
+	deck, err := d.deckByUUID(w, r)
+	if err != nil {
+		return
 	}
 
-	json.Response(w, cards, http.StatusOK)
+	if err := ifMatch(r, deck); err != nil {
+		writeError(w, r, err, deck)
+		return
+	}
+
+	opts := models.ShuffleOptions{
+		Discarded: shuffleReq.Discarded,
+		Strategy:  shuffleReq.Strategy,
+		Times:     shuffleReq.Times,
+	}
+	if err := d.ds.Shuffle(deck, opts); err != nil {
+		writeError(w, r, err, deck)
+		return
+	}
+	setETag(w, deck)
+	json.Response(w, r, d.deckResponseOf(r, deck), http.StatusOK)
+}
+
+// Undo is used to revert the latest operation on the deck
+// Requires If-Match header of the deck version, so the changes of the other clients are not reverted
+// Replies the request with deck resource info and HTTP 200 if succeed
+//
+// POST /deck/:uid/undo
+func (d *Decks) Undo(w http.ResponseWriter, r *http.Request) {
+	deck, err := d.deckByUUID(w, r)
+	if err != nil {
+		return
+	}
+	if err := ifMatch(r, deck); err != nil {
+		writeError(w, r, err, deck)
+		return
+	}
+	if err := d.ds.Undo(deck); err != nil {
+		writeError(w, r, err, deck)
+		return
+	}
+	setETag(w, deck)
+	json.Response(w, r, d.deckResponseOf(r, deck), http.StatusOK)
 }
 
 // deckByUUID used to get models.Deck record by URL
+// Actor of the record is set by the request
+// Reading requests require models.RoleView, others models.RoleFull on the deck
 // Returns matched models.Deck record if found
 // Returns error models.ErrNotFound if record not found
 // Returns related if another error occurs
 // Sets error response if fails
 func (d *Decks) deckByUUID(w http.ResponseWriter, r *http.Request) (*models.Deck, error) {
+	if isMutation(r) {
+		return d.deckWithRole(w, r, models.RoleFull)
+	}
+	return d.deckWithRole(w, r, models.RoleView)
+}
+
+// deckWithRole used to get models.Deck record by URL if the role of the request on the deck allows the required role
+// Returns error errDeckForbidden if the role does not allow
+// Sets error response if fails
+func (d *Decks) deckWithRole(w http.ResponseWriter, r *http.Request, required string) (*models.Deck, error) {
 	vars := mux.Vars(r)
 	uuid := vars["uuid"]
 
 	deck, err := d.ds.ByUUID(uuid)
 	if err != nil {
-		if err == models.ErrNotFound {
-			json.Error(w, "Deck not found", http.StatusNotFound)
-		} else {
-			json.Error(w, "Unexpected Error", http.StatusInternalServerError)
-		}
+		writeError(w, r, err, deck)
+		return nil, err
+	}
+
+	role, err := roleOf(r, deck)
+	if err != nil {
+		writeError(w, r, err, nil)
 		return nil, err
 	}
+	if !models.RoleAllows(role, required) {
+		writeError(w, r, errDeckForbidden, deck)
+		return nil, errDeckForbidden
+	}
 
+	deck.Actor = r.Header.Get(actorHeader)
+	deck.Player = models.PlayerKey(r.Header.Get(playerTokenHeader))
 	return deck, nil
 }
@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"errors"
+	"github.com/gorilla/mux"
 	"github.com/mocak/tbupt/models"
 	"io"
 	"net/http"
@@ -9,6 +10,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestNewDecks(t *testing.T) {
@@ -71,7 +73,7 @@ func TestDecks_Create(t *testing.T) {
 				r: httptest.NewRequest("POST", "/deck", strings.NewReader("{\"a\":\"b\"}")),
 				w: httptest.NewRecorder(),
 			},
-			want:       "\"Unexpected Error\"\n",
+			want:       "{\"code\":\"internal_error\",\"message\":\"Unexpected Error\"}\n",
 			wantStatus: http.StatusInternalServerError,
 		},
 	}
@@ -96,11 +98,39 @@ func TestDecks_Create(t *testing.T) {
 	}
 }
 
+func TestDecks_Create_IgnoresState(t *testing.T) {
+	s := NewServer(NewDecks(models.NewDeckService(models.NewCardService())))
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return w
+	}
+	created := do("POST", "/deck", `{"drawn":[{"value":"ACE","suit":"SPADES","code":"AS"}],`+
+		`"piles":{"hand":{"owner":"mallory","cards":[{"value":"KING","suit":"HEARTS","code":"KH"}]}},`+
+		`"created_at":"2000-01-01T00:00:00Z","remaining":3}`)
+	if created.Code != http.StatusCreated || !strings.Contains(created.Body.String(), `"Remaining":52`) {
+		t.Fatalf("Create() got = %v %v, want 201 with 52 remaining", created.Code, created.Body.String())
+	}
+	deckID := strings.Split(strings.Split(created.Body.String(), `"DeckID":"`)[1], `"`)[0]
+
+	if got := do("GET", "/deck/"+deckID, "").Body.String(); strings.Contains(got, "Piles") || strings.Contains(got, "2000-01-01") {
+		t.Errorf("Get() got = %v, want no piles and current creation time", got)
+	}
+	if w := do("POST", "/deck/"+deckID+"/return", `{"cards":"AS"}`); w.Code != http.StatusConflict {
+		t.Errorf("Return() of injected drawn card status = %v, want %v", w.Code, http.StatusConflict)
+	}
+}
+
 func TestDecks_Draw(t *testing.T) {
 	cards := []*models.Card{
 		{Value: "ACE", Suit: "SPADES", Code: "AS"},
 		{Value: "2", Suit: "SPADES", Code: "2S"},
 	}
+	negativeDrawService := models.NewDeckService(models.NewCardService())
+	negativeDraw := &models.Deck{}
+	if err := negativeDrawService.Create(negativeDraw); err != nil {
+		t.Fatalf("Create() err = %s, want nil", err)
+	}
 	type fields struct {
 		ds models.DeckService
 	}
@@ -142,9 +172,22 @@ func TestDecks_Draw(t *testing.T) {
 				r: httptest.NewRequest("POST", "/deck/testuuid/draw", strings.NewReader("{\"count\":2}")),
 				w: httptest.NewRecorder(),
 			},
-			want:       "\"Unexpected Error\"\n",
+			want:       "{\"code\":\"internal_error\",\"message\":\"Unexpected Error\"}\n",
 			wantStatus: http.StatusInternalServerError,
 		},
+		{
+			name: "negative count",
+			fields: fields{
+				ds: negativeDrawService,
+			},
+			args: args{
+				r: mux.SetURLVars(httptest.NewRequest("POST", "/deck/"+negativeDraw.UUID+"/draw", strings.NewReader("{\"count\":-1}")),
+					map[string]string{"uuid": negativeDraw.UUID}),
+				w: httptest.NewRecorder(),
+			},
+			want:       "{\"code\":\"count_invalid\",\"message\":\"count must not be negative\",\"field\":\"count\"}\n",
+			wantStatus: http.StatusUnprocessableEntity,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -167,6 +210,41 @@ func TestDecks_Draw(t *testing.T) {
 	}
 }
 
+func TestDecks_Draw_Reshuffle(t *testing.T) {
+	d := &Decks{
+		ds: mockDeckService{deck: &models.Deck{UUID: "testuuid", Remaining: 3, Reshuffle: true}},
+	}
+	w := httptest.NewRecorder()
+	d.Draw(w, httptest.NewRequest("POST", "/deck/testuuid/draw", strings.NewReader("{\"count\":1}")))
+	if got := w.Result().Header.Get(reshuffleHeader); got != "true" {
+		t.Errorf("Draw() %s header = %v, want true", reshuffleHeader, got)
+	}
+}
+
+func TestDecks_Return(t *testing.T) {
+	d := &Decks{
+		ds: mockDeckService{deck: &models.Deck{UUID: "testuuid", Remaining: 4}},
+	}
+	w := httptest.NewRecorder()
+	d.Return(w, httptest.NewRequest("POST", "/deck/testuuid/return", strings.NewReader("{\"cards\":\"AS\",\"position\":\"bottom\"}")))
+	want := "{\"DeckID\":\"testuuid\",\"Shuffled\":false,\"Remaining\":4}"
+	if got := w.Body.String(); got != want || w.Code != http.StatusOK {
+		t.Errorf("Return() = %v %v, want %v %v", w.Code, got, http.StatusOK, want)
+	}
+}
+
+func TestDecks_Shuffle(t *testing.T) {
+	d := &Decks{
+		ds: mockDeckService{deck: &models.Deck{UUID: "testuuid", Remaining: 4}},
+	}
+	w := httptest.NewRecorder()
+	d.Shuffle(w, httptest.NewRequest("POST", "/deck/testuuid/shuffle", strings.NewReader("{\"discarded\":true,\"strategy\":\"riffle\",\"times\":7}")))
+	want := "{\"DeckID\":\"testuuid\",\"Shuffled\":true,\"Remaining\":4}"
+	if got := w.Body.String(); got != want || w.Code != http.StatusOK {
+		t.Errorf("Shuffle() = %v %v, want %v %v", w.Code, got, http.StatusOK, want)
+	}
+}
+
 func TestDecks_Open(t *testing.T) {
 	cards := []*models.Card{
 		{Value: "ACE", Suit: "SPADES", Code: "AS"},
@@ -198,7 +276,7 @@ func TestDecks_Open(t *testing.T) {
 				r: httptest.NewRequest("PUT", "/deck/testuuid/open", strings.NewReader("{\"count\":2}")),
 				w: httptest.NewRecorder(),
 			},
-			want:       "{\"deck_id\":\"testuuid\",\"shuffled\":false,\"remaining\":3,\"cards\":[{\"value\":\"ACE\",\"suit\":\"SPADES\",\"code\":\"AS\"},{\"value\":\"2\",\"suit\":\"SPADES\",\"code\":\"2S\"}]}",
+			want:       "{\"deck_id\":\"testuuid\",\"shuffled\":false,\"remaining\":3,\"cards\":[{\"value\":\"ACE\",\"suit\":\"SPADES\",\"code\":\"AS\"},{\"value\":\"2\",\"suit\":\"SPADES\",\"code\":\"2S\"}],\"created_at\":\"0001-01-01T00:00:00Z\"}",
 			wantStatus: http.StatusOK,
 		},
 		{
@@ -213,7 +291,7 @@ func TestDecks_Open(t *testing.T) {
 				r: httptest.NewRequest("PUT", "/deck/testuuid/draw", strings.NewReader("{\"count\":2}")),
 				w: httptest.NewRecorder(),
 			},
-			want:       "\"Unexpected Error\"\n",
+			want:       "{\"code\":\"internal_error\",\"message\":\"Unexpected Error\"}\n",
 			wantStatus: http.StatusInternalServerError,
 		},
 	}
@@ -242,6 +320,10 @@ type mockDeckService struct {
 	deck  *models.Deck
 	err   error
 	cards []*models.Card
+	// drawErr is returned by Draw only, so the deck lookup succeeds
+	drawErr error
+	events  []*models.DeckEvent
+	next    int
 }
 
 func (m mockDeckService) Update(deck *models.Deck) error {
@@ -264,5 +346,252 @@ func (m mockDeckService) ByUUID(uuid string) (*models.Deck, error) {
 }
 
 func (m mockDeckService) Draw(deck *models.Deck, count int) ([]*models.Card, error) {
+	if m.drawErr != nil {
+		return nil, m.drawErr
+	}
 	return m.cards, m.err
 }
+
+func (m mockDeckService) Peek(deck *models.Deck, count int) ([]*models.Card, error) {
+	return m.cards, m.err
+}
+
+func (m mockDeckService) List(filter models.DeckFilter) (models.DeckPage, error) {
+	return models.DeckPage{Decks: []*models.Deck{m.deck}, Limit: filter.Limit, NextCursor: filter.Cursor}, m.err
+}
+
+func (m mockDeckService) Delete(uuid string) error {
+	return m.err
+}
+
+func (m mockDeckService) Events(uuid string, after, limit int) (models.DeckEventPage, error) {
+	return models.DeckEventPage{Events: m.events, Limit: limit, Next: m.next}, m.err
+}
+
+func (m mockDeckService) Replay(uuid string, seq int) (*models.Deck, error) {
+	return m.deck, m.err
+}
+
+func (m mockDeckService) Undo(deck *models.Deck) error {
+	return m.err
+}
+
+func (m mockDeckService) AddToPile(deck *models.Deck, pile string, codes []string) error {
+	deck.Piles = m.deck.Piles
+	return m.err
+}
+
+func (m mockDeckService) DrawFromPile(deck *models.Deck, pile string, count int) ([]*models.Card, error) {
+	return m.cards, m.err
+}
+
+func (m mockDeckService) MoveCards(deck *models.Deck, from, to string, codes []string, count int) ([]*models.Card, error) {
+	return m.cards, m.err
+}
+
+func (m mockDeckService) Claim(deck *models.Deck, pile string) error {
+	return m.err
+}
+
+func (m mockDeckService) Deal(deck *models.Deck, pile string, count int) ([]*models.Card, error) {
+	return m.cards, m.err
+}
+
+func (m mockDeckService) Reveal(deck *models.Deck, pile string, codes []string) error {
+	return m.err
+}
+
+func (m mockDeckService) Grant(deck *models.Deck, principals []string) error {
+	return m.err
+}
+
+func (m mockDeckService) SetACL(deck *models.Deck, acl map[string]string) error {
+	return m.err
+}
+
+func (m mockDeckService) Share(deck *models.Deck, role string) (*models.Share, error) {
+	return nil, m.err
+}
+
+func (m mockDeckService) Unshare(deck *models.Deck, id string) error {
+	return m.err
+}
+
+func (m mockDeckService) Return(deck *models.Deck, codes []string, position string) error {
+	deck.Remaining = m.deck.Remaining
+	return m.err
+}
+
+func (m mockDeckService) Shuffle(deck *models.Deck, opts models.ShuffleOptions) error {
+	deck.Shuffled = true
+	return m.err
+}
+
+func TestDecks_Get(t *testing.T) {
+	createdAt := time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+	d := &Decks{
+		ds: mockDeckService{deck: &models.Deck{
+			UUID:      "testuuid",
+			Shuffled:  true,
+			Remaining: 40,
+			CreatedAt: createdAt,
+			Cards:     []*models.Card{models.NewCard(models.ValueAce, models.SuitSpades)},
+			Piles:     map[string]*models.Pile{"discard": {Remaining: 2}},
+		}},
+	}
+	w := httptest.NewRecorder()
+	d.Get(w, httptest.NewRequest("GET", "/deck/testuuid", nil))
+	want := "{\"DeckID\":\"testuuid\",\"Shuffled\":true,\"Remaining\":40,\"CreatedAt\":\"2022-01-02T03:04:05Z\",\"Piles\":{\"discard\":{\"Remaining\":2}}}"
+	if got := w.Body.String(); got != want || w.Code != http.StatusOK {
+		t.Errorf("Get() = %v %v, want %v %v", w.Code, got, http.StatusOK, want)
+	}
+}
+
+func TestDecks_Peek(t *testing.T) {
+	cards := []*models.Card{models.NewCard(models.ValueAce, models.SuitSpades)}
+	tests := []struct {
+		name        string
+		operatorKey string
+		key         string
+		query       string
+		want        string
+		wantStatus  int
+	}{
+		{
+			name:        "valid",
+			operatorKey: "secret",
+			key:         "secret",
+			query:       "?count=1",
+			want:        "[{\"value\":\"ACE\",\"suit\":\"SPADES\",\"code\":\"AS\"}]",
+			wantStatus:  http.StatusOK,
+		},
+		{
+			name:       "disabled",
+			key:        "",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:        "wrong key",
+			operatorKey: "secret",
+			key:         "guess",
+			wantStatus:  http.StatusForbidden,
+		},
+		{
+			name:        "invalid count",
+			operatorKey: "secret",
+			key:         "secret",
+			query:       "?count=many",
+			wantStatus:  http.StatusUnprocessableEntity,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDecks(mockDeckService{deck: &models.Deck{UUID: "testuuid"}, cards: cards}, WithOperatorKey(tt.operatorKey))
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", "/deck/testuuid/peek"+tt.query, nil)
+			r.Header.Set(operatorKeyHeader, tt.key)
+			d.Peek(w, r)
+			if w.Code != tt.wantStatus {
+				t.Errorf("Peek() status code = %v, want %v", w.Code, tt.wantStatus)
+			}
+			if got := w.Body.String(); tt.want != "" && got != tt.want {
+				t.Errorf("Peek() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecks_Vars(t *testing.T) {
+	auth := NewAuthenticator(map[string]string{"alice-key": "alice"}, nil)
+	tests := []struct {
+		name       string
+		opts       []ServerOption
+		header     string
+		value      string
+		wantStatus int
+	}{
+		{name: "operator", header: operatorKeyHeader, value: "secret", wantStatus: http.StatusOK},
+		{name: "anonymous", wantStatus: http.StatusForbidden},
+		{name: "wrong key", header: operatorKeyHeader, value: "guess", wantStatus: http.StatusForbidden},
+		{name: "unauthenticated", opts: []ServerOption{WithAuth(auth)}, wantStatus: http.StatusUnauthorized},
+		{name: "principal", opts: []ServerOption{WithAuth(auth)}, header: apiKeyHeader, value: "alice-key", wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewServer(NewDecks(mockDeckService{}, WithOperatorKey("secret")), tt.opts...)
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", "/debug/vars", nil)
+			if tt.header != "" {
+				r.Header.Set(tt.header, tt.value)
+			}
+			s.ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Errorf("Vars() status code = %v, want %v", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK && strings.Contains(w.Body.String(), "cmdline") {
+				t.Errorf("Vars() = %v, want no metrics", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestDecks_Delete(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+	}{
+		{name: "deleted", wantStatus: http.StatusNoContent},
+		{name: "not found", err: models.ErrNotFound, wantStatus: http.StatusNotFound},
+		{name: "not supported", err: models.ErrDeleteNotSupported, wantStatus: http.StatusNotImplemented},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &Decks{ds: mockDeckService{err: tt.err}}
+			w := httptest.NewRecorder()
+			d.Delete(w, httptest.NewRequest("DELETE", "/deck/testuuid", nil))
+			if w.Code != tt.wantStatus {
+				t.Errorf("Delete() status code = %v, want %v", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestDecks_Undo(t *testing.T) {
+	s := NewServer(NewDecks(models.NewDeckService(models.NewCardService())))
+	do := func(method, target, body, match string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		if match != "" {
+			r.Header.Set("If-Match", match)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		return w
+	}
+	created := do("POST", "/deck", "{}", "")
+	deckID := strings.Split(strings.Split(created.Body.String(), `"DeckID":"`)[1], `"`)[0]
+	do("POST", "/deck/"+deckID+"/draw", `{"count":2}`, "")
+
+	tests := []struct {
+		name       string
+		match      string
+		want       string
+		wantStatus int
+	}{
+		{name: "without if-match", wantStatus: http.StatusPreconditionRequired},
+		{name: "stale", match: `"1"`, wantStatus: http.StatusPreconditionFailed},
+		{name: "undone", match: `"2"`, want: `"Remaining":52`, wantStatus: http.StatusOK},
+		{name: "nothing to undo", match: `"3"`, wantStatus: http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := do("POST", "/deck/"+deckID+"/undo", "", tt.match)
+			if w.Code != tt.wantStatus {
+				t.Errorf("Undo() status code = %v, want %v", w.Code, tt.wantStatus)
+			}
+			if !strings.Contains(w.Body.String(), tt.want) {
+				t.Errorf("Undo() got = %v, want containing %v", w.Body.String(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/mocak/tbupt/json"
+	"github.com/mocak/tbupt/models"
+)
+
+// apiError is the HTTP representation of a domain error
+type apiError struct {
+	status int
+	code   string
+	field  string
+}
+
+// apiErrors maps the domain errors to their HTTP representation
+// 400 malformed requests, 401 unauthenticated requests, 403 unauthorized operations, 404 missing resources,
+// 409 conflicts with the deck state, 412 and 428 failed or missing preconditions, 422 invalid field values
+// 501 operations the storage or the server does not support and 503 streams ended by the server
+var apiErrors = map[error]apiError{
+	models.ErrUUIDRequired:   {http.StatusBadRequest, "uuid_required", "uuid"},
+	models.ErrUUIDInvalid:    {http.StatusBadRequest, "uuid_invalid", "uuid"},
+	errIdempotencyKeyInvalid: {http.StatusBadRequest, "idempotency_key_invalid", ""},
+
+	errUnauthenticated:   {http.StatusUnauthorized, "unauthenticated", ""},
+	errAPIKeyInvalid:     {http.StatusUnauthorized, "api_key_invalid", ""},
+	errTokenInvalid:      {http.StatusUnauthorized, "token_invalid", ""},
+	errTokenExpired:      {http.StatusUnauthorized, "token_expired", ""},
+	errShareTokenInvalid: {http.StatusUnauthorized, "share_token_invalid", ""},
+
+	errOperatorKeyInvalid:         {http.StatusForbidden, "operator_key_invalid", ""},
+	errDeckForbidden:              {http.StatusForbidden, "deck_forbidden", ""},
+	errDeckOwnerOnly:              {http.StatusForbidden, "deck_owner_only", ""},
+	models.ErrPlayerTokenRequired: {http.StatusForbidden, "player_token_required", ""},
+	models.ErrPileNotOwned:        {http.StatusForbidden, "pile_not_owned", "pile"},
+
+	models.ErrNotFound:        {http.StatusNotFound, "deck_not_found", "uuid"},
+	models.ErrPileNotFound:    {http.StatusNotFound, "pile_not_found", "pile"},
+	models.ErrEventNotFound:   {http.StatusNotFound, "event_not_found", "seq"},
+	models.ErrWebhookNotFound: {http.StatusNotFound, "webhook_not_found", "id"},
+	models.ErrShareNotFound:   {http.StatusNotFound, "share_not_found", "id"},
+
+	models.ErrDeckOpened:               {http.StatusConflict, "deck_opened", ""},
+	models.ErrNotEnoughCards:           {http.StatusConflict, "not_enough_cards", "count"},
+	models.ErrCardsNotDrawn:            {http.StatusConflict, "cards_not_drawn", "cards"},
+	models.ErrCardsNotInPile:           {http.StatusConflict, "cards_not_in_pile", "cards"},
+	models.ErrIdempotencyKeyInProgress: {http.StatusConflict, "idempotency_key_in_progress", ""},
+	models.ErrNothingToUndo:            {http.StatusConflict, "nothing_to_undo", ""},
+	models.ErrPileClaimed:              {http.StatusConflict, "pile_claimed", "pile"},
+	models.ErrWebhookLimit:             {http.StatusConflict, "webhook_limit", ""},
+	models.ErrShareLimit:               {http.StatusConflict, "share_limit", ""},
+
+	models.ErrVersionMismatch: {http.StatusPreconditionFailed, "version_mismatch", ""},
+	models.ErrVersionRequired: {http.StatusPreconditionRequired, "version_required", ""},
+
+	models.ErrCardCodeValueInvalid:     {http.StatusUnprocessableEntity, "card_code_value_invalid", "cards"},
+	models.ErrCardCodeSuitInvalid:      {http.StatusUnprocessableEntity, "card_code_suit_invalid", "cards"},
+	models.ErrCompositionUnknown:       {http.StatusUnprocessableEntity, "composition_unknown", "composition.name"},
+	models.ErrCompositionJokersInvalid: {http.StatusUnprocessableEntity, "composition_jokers_invalid", "composition.jokers"},
+	models.ErrCompositionRuleInvalid:   {http.StatusUnprocessableEntity, "composition_rule_invalid", "composition"},
+	models.ErrDecksInvalid:             {http.StatusUnprocessableEntity, "decks_invalid", "decks"},
+	models.ErrPenetrationInvalid:       {http.StatusUnprocessableEntity, "penetration_invalid", "penetration"},
+	models.ErrShufflerUnknown:          {http.StatusUnprocessableEntity, "shuffler_unknown", "shuffler"},
+	models.ErrSeedNotSupported:         {http.StatusUnprocessableEntity, "seed_not_supported", "seed"},
+	models.ErrPositionInvalid:          {http.StatusUnprocessableEntity, "position_invalid", "position"},
+	models.ErrStrategyUnknown:          {http.StatusUnprocessableEntity, "strategy_unknown", "strategy"},
+	models.ErrTimesInvalid:             {http.StatusUnprocessableEntity, "times_invalid", "times"},
+	models.ErrCountInvalid:             {http.StatusUnprocessableEntity, "count_invalid", "count"},
+	models.ErrCursorInvalid:            {http.StatusUnprocessableEntity, "cursor_invalid", "cursor"},
+	models.ErrLimitInvalid:             {http.StatusUnprocessableEntity, "limit_invalid", "limit"},
+	models.ErrPileNameInvalid:          {http.StatusUnprocessableEntity, "pile_name_invalid", "pile"},
+	models.ErrTTLInvalid:               {http.StatusUnprocessableEntity, "ttl_invalid", "ttl"},
+	models.ErrIdempotencyKeyReused:     {http.StatusUnprocessableEntity, "idempotency_key_reused", ""},
+	models.ErrWebhookURLInvalid:        {http.StatusUnprocessableEntity, "webhook_url_invalid", "url"},
+	models.ErrWebhookURLPrivate:        {http.StatusUnprocessableEntity, "webhook_url_private", "url"},
+	models.ErrWebhookEventUnknown:      {http.StatusUnprocessableEntity, "webhook_event_unknown", "events"},
+	models.ErrPrincipalInvalid:         {http.StatusUnprocessableEntity, "principal_invalid", "grants"},
+	models.ErrRoleInvalid:              {http.StatusUnprocessableEntity, "role_invalid", "role"},
+
+	models.ErrListNotSupported:   {http.StatusNotImplemented, "list_not_supported", ""},
+	models.ErrDeleteNotSupported: {http.StatusNotImplemented, "delete_not_supported", ""},
+	models.ErrEventsNotSupported: {http.StatusNotImplemented, "events_not_supported", ""},
+	errStreamNotSupported:        {http.StatusNotImplemented, "stream_not_supported", ""},
+	errWebhooksNotSupported:      {http.StatusNotImplemented, "webhooks_not_supported", ""},
+
+	models.ErrSubscriberLagged: {http.StatusServiceUnavailable, "subscriber_lagged", ""},
+	models.ErrHubClosed:        {http.StatusServiceUnavailable, "hub_closed", ""},
+}
+
+// writeError sets the error response of the given error
+// Deck id and remaining cards of the deck are added as problem extension members if known
+// Errors without mapping are replied with HTTP 500 without details
+func writeError(w http.ResponseWriter, r *http.Request, err error, deck *models.Deck) {
+	status, body := errorResponse(err)
+	ext := map[string]interface{}{}
+	if uuid := mux.Vars(r)["uuid"]; uuid != "" {
+		ext["deck_id"] = uuid
+	}
+	if deck != nil {
+		ext["deck_id"] = deck.UUID
+		ext["remaining"] = deck.Remaining
+	}
+	json.WriteError(w, r, body, status, ext)
+}
+
+// errorResponse returns the status code and the body of the given error
+func errorResponse(err error) (int, json.ErrorBody) {
+	if qe, ok := err.(queryError); ok {
+		return http.StatusBadRequest, json.ErrorBody{Code: "query_invalid", Message: qe.Error(), Field: qe.param}
+	}
+	ae, ok := apiErrors[err]
+	if !ok {
+		return http.StatusInternalServerError, json.ErrorBody{Code: json.CodeInternal, Message: "Unexpected Error"}
+	}
+	return ae.status, json.ErrorBody{Code: ae.code, Message: err.Error(), Field: ae.field}
+}
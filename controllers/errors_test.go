@@ -0,0 +1,99 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/mocak/tbupt/models"
+)
+
+func Test_writeError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		want       string
+		wantStatus int
+	}{
+		{
+			name:       "malformed",
+			err:        models.ErrUUIDInvalid,
+			want:       `{"code":"uuid_invalid","message":"uuid is not valid","field":"uuid"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "not found",
+			err:        models.ErrNotFound,
+			want:       `{"code":"deck_not_found","message":"resource not found","field":"uuid"}`,
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "conflict",
+			err:        models.ErrDeckOpened,
+			want:       `{"code":"deck_opened","message":"not permitted on opened deck"}`,
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:       "not enough cards",
+			err:        models.ErrNotEnoughCards,
+			want:       `{"code":"not_enough_cards","message":"there is not enough cards in the deck for the operation","field":"count"}`,
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:       "invalid field",
+			err:        models.ErrCardCodeSuitInvalid,
+			want:       `{"code":"card_code_suit_invalid","message":"card code suit is invalid","field":"cards"}`,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "unexpected",
+			err:        errors.New("connection refused"),
+			want:       `{"code":"internal_error","message":"Unexpected Error"}`,
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("POST", "/deck", nil)
+			r.Header.Set("Accept", "application/json")
+			writeError(w, r, tt.err, nil)
+			if got := strings.TrimSuffix(w.Body.String(), "\n"); got != tt.want || w.Code != tt.wantStatus {
+				t.Errorf("writeError() = %v %v, want %v %v", w.Code, got, tt.wantStatus, tt.want)
+			}
+		})
+	}
+}
+
+func Test_writeError_Problem(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := mux.SetURLVars(httptest.NewRequest("POST", "/deck/testuuid/draw", nil), map[string]string{"uuid": "testuuid"})
+	r.Header.Set("Accept", "application/problem+json, application/json")
+	writeError(w, r, models.ErrDeckOpened, &models.Deck{UUID: "testuuid", Remaining: 3})
+	want := `{"code":"deck_opened","deck_id":"testuuid","detail":"not permitted on opened deck",` +
+		`"instance":"/deck/testuuid/draw","remaining":3,"status":409,"title":"Conflict","type":"urn:tbupt:problem:deck_opened"}`
+	if got := strings.TrimSuffix(w.Body.String(), "\n"); got != want || w.Code != http.StatusConflict {
+		t.Errorf("writeError() = %v %v, want %v %v", w.Code, got, http.StatusConflict, want)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Errorf("writeError() content type = %v, want application/problem+json", ct)
+	}
+}
+
+func TestDecks_Draw_Error(t *testing.T) {
+	d := &Decks{
+		ds: mockDeckService{deck: &models.Deck{UUID: "testuuid", Remaining: 2}, drawErr: models.ErrNotEnoughCards},
+	}
+	w := httptest.NewRecorder()
+	r := mux.SetURLVars(httptest.NewRequest("POST", "/deck/testuuid/draw", strings.NewReader(`{"count":5}`)), map[string]string{"uuid": "testuuid"})
+	r.Header.Set("Accept", "application/problem+json")
+	d.Draw(w, r)
+	want := `{"code":"not_enough_cards","deck_id":"testuuid","detail":"there is not enough cards in the deck for the operation",` +
+		`"field":"count","instance":"/deck/testuuid/draw","remaining":2,"status":409,"title":"Conflict","type":"urn:tbupt:problem:not_enough_cards"}`
+	if got := strings.TrimSuffix(w.Body.String(), "\n"); got != want || w.Code != http.StatusConflict {
+		t.Errorf("Draw() = %v %v, want %v %v", w.Code, got, http.StatusConflict, want)
+	}
+}
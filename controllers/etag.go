@@ -0,0 +1,40 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mocak/tbupt/models"
+)
+
+// etag returns the entity tag of the deck version
+func etag(deck *models.Deck) string {
+	return `"` + strconv.Itoa(deck.Version) + `"`
+}
+
+// setETag sets the ETag header of the response to the deck version
+func setETag(w http.ResponseWriter, deck *models.Deck) {
+	if deck.Version > 0 {
+		w.Header().Set("ETag", etag(deck))
+	}
+}
+
+// ifMatch makes the updates of the deck conditional on the If-Match header of the request
+// Absent header and * do not set a condition
+// Returns models.ErrVersionMismatch if the header is not an entity tag of a deck version
+func ifMatch(r *http.Request, deck *models.Deck) error {
+	v := strings.TrimSpace(r.Header.Get("If-Match"))
+	if v == "" || v == "*" {
+		return nil
+	}
+	if len(v) < 2 || v[0] != '"' || v[len(v)-1] != '"' {
+		return models.ErrVersionMismatch
+	}
+	version, err := strconv.Atoi(v[1 : len(v)-1])
+	if err != nil || version < 1 {
+		return models.ErrVersionMismatch
+	}
+	deck.IfMatch = version
+	return nil
+}
@@ -0,0 +1,86 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mocak/tbupt/models"
+)
+
+func Test_ifMatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		want    int
+		wantErr error
+	}{
+		{name: "absent", want: 0},
+		{name: "any", header: "*", want: 0},
+		{name: "version", header: `"3"`, want: 3},
+		{name: "unquoted", header: "3", wantErr: models.ErrVersionMismatch},
+		{name: "weak", header: `W/"3"`, wantErr: models.ErrVersionMismatch},
+		{name: "not a version", header: `"abc"`, wantErr: models.ErrVersionMismatch},
+		{name: "zero", header: `"0"`, wantErr: models.ErrVersionMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/deck/testuuid/draw", nil)
+			if tt.header != "" {
+				r.Header.Set("If-Match", tt.header)
+			}
+			deck := &models.Deck{}
+			if err := ifMatch(r, deck); err != tt.wantErr {
+				t.Errorf("ifMatch() err = %v, want %v", err, tt.wantErr)
+			}
+			if deck.IfMatch != tt.want {
+				t.Errorf("ifMatch() IfMatch = %v, want %v", deck.IfMatch, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecks_IfMatch(t *testing.T) {
+	s := NewServer(NewDecks(models.NewDeckService(models.NewCardService())))
+	do := func(method, target, body, match string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		if match != "" {
+			r.Header.Set("If-Match", match)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		return w
+	}
+
+	w := do("POST", "/deck", "{}", "")
+	if got := w.Header().Get("ETag"); got != `"1"` {
+		t.Fatalf("Create() ETag = %v, want \"1\"", got)
+	}
+	deckID := strings.Split(strings.Split(w.Body.String(), `"DeckID":"`)[1], `"`)[0]
+
+	w = do("POST", "/deck/"+deckID+"/draw", `{"count":1}`, `"1"`)
+	if w.Code != http.StatusOK || w.Header().Get("ETag") != `"2"` {
+		t.Errorf("Draw() status code = %v ETag = %v, want 200 \"2\"", w.Code, w.Header().Get("ETag"))
+	}
+
+	stale := []struct {
+		method string
+		target string
+	}{
+		{"POST", "/draw"},
+		{"POST", "/shuffle"},
+		{"PUT", "/open"},
+	}
+	for _, req := range stale {
+		w = do(req.method, "/deck/"+deckID+req.target, "{}", `"1"`)
+		if w.Code != http.StatusPreconditionFailed {
+			t.Errorf("%s %s status code = %v, want %v", req.method, req.target, w.Code, http.StatusPreconditionFailed)
+		}
+	}
+
+	w = do("GET", "/deck/"+deckID, "", "")
+	if w.Code != http.StatusOK || w.Header().Get("ETag") != `"2"` {
+		t.Errorf("Get() status code = %v ETag = %v, want 200 \"2\"", w.Code, w.Header().Get("ETag"))
+	}
+}
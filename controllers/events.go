@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/mocak/tbupt/json"
+	"github.com/mocak/tbupt/models"
+)
+
+// actorHeader carries the name of the client recorded by the deck events
+const actorHeader = "X-Actor"
+
+// eventsResponse is a page of the deck events
+type eventsResponse struct {
+	Events []*models.DeckEvent
+	Paging paging
+}
+
+// Events is used to list the recorded events of the deck in order
+// Cursor query parameter is the sequence of the event to list after
+// Replies the request with a page of events and HTTP 200 if succeed
+//
+// GET /deck/:uuid/events?cursor=:seq&limit=:int
+func (d *Decks) Events(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	after, err := parseIntParam(q, "cursor")
+	if err != nil {
+		writeError(w, r, err, nil)
+		return
+	}
+	limit, err := parseIntParam(q, "limit")
+	if err != nil {
+		writeError(w, r, err, nil)
+		return
+	}
+	if after == nil {
+		after = new(int)
+	}
+	if limit == nil {
+		limit = new(int)
+	}
+	if restricted(r) {
+		// checks the role on the deck
+		if _, err := d.deckByUUID(w, r); err != nil {
+			return
+		}
+	}
+
+	page, err := d.ds.Events(mux.Vars(r)["uuid"], *after, *limit)
+	if err != nil {
+		writeError(w, r, err, nil)
+		return
+	}
+
+	resp := eventsResponse{
+		Events: page.Events,
+		Paging: paging{Limit: page.Limit, Count: len(page.Events)},
+	}
+	if page.Next > 0 {
+		resp.Paging.NextCursor = strconv.Itoa(page.Next)
+	}
+	json.Response(w, r, resp, http.StatusOK)
+}
+
+// Replay is used to see the deck in its state after an event
+// Requires the operator key and a role on the deck,
+// replies the request with deck resource with cards and HTTP 200 if succeed
+//
+// GET /deck/:uuid/events/:seq/deck
+func (d *Decks) Replay(w http.ResponseWriter, r *http.Request) {
+	if !d.isOperator(r) {
+		writeError(w, r, errOperatorKeyInvalid, nil)
+		return
+	}
+
+	seq, err := strconv.Atoi(mux.Vars(r)["seq"])
+	if err != nil {
+		writeError(w, r, models.ErrEventNotFound, nil)
+		return
+	}
+	current, err := d.deckByUUID(w, r)
+	if err != nil {
+		return
+	}
+	deck, err := d.ds.Replay(current.UUID, seq)
+	if err != nil {
+		writeError(w, r, err, current)
+		return
+	}
+	setETag(w, deck)
+	json.Response(w, r, deck, http.StatusOK)
+}
@@ -0,0 +1,116 @@
+package controllers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/mocak/tbupt/models"
+)
+
+func TestDecks_Events(t *testing.T) {
+	at := time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+	events := []*models.DeckEvent{
+		{DeckID: "testuuid", Seq: 1, Type: models.EventCreated, At: at, Actor: "host"},
+		{DeckID: "testuuid", Seq: 2, Type: models.EventDrawn, At: at, Actor: "player", Cards: []string{"AS"}},
+	}
+	tests := []struct {
+		name       string
+		ds         mockDeckService
+		query      string
+		want       string
+		wantStatus int
+	}{
+		{
+			name:  "page",
+			ds:    mockDeckService{events: events, next: 2},
+			query: "?limit=2",
+			want: "{\"Events\":[{\"deck_id\":\"testuuid\",\"seq\":1,\"type\":\"created\",\"at\":\"2022-01-02T03:04:05Z\",\"actor\":\"host\"}," +
+				"{\"deck_id\":\"testuuid\",\"seq\":2,\"type\":\"drawn\",\"at\":\"2022-01-02T03:04:05Z\",\"actor\":\"player\",\"cards\":[\"AS\"]}]," +
+				"\"Paging\":{\"Limit\":2,\"Count\":2,\"NextCursor\":\"2\"}}",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "malformed cursor",
+			query:      "?cursor=first",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "not supported",
+			ds:         mockDeckService{err: models.ErrEventsNotSupported},
+			wantStatus: http.StatusNotImplemented,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDecks(tt.ds)
+			w := httptest.NewRecorder()
+			d.Events(w, httptest.NewRequest("GET", "/deck/testuuid/events"+tt.query, nil))
+			if w.Code != tt.wantStatus {
+				t.Errorf("Events() status code = %v, want %v", w.Code, tt.wantStatus)
+			}
+			if tt.want != "" && w.Body.String() != tt.want {
+				t.Errorf("Events() got = %v, want %v", w.Body.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestDecks_Replay(t *testing.T) {
+	deck := &models.Deck{UUID: "testuuid", Remaining: 1, Cards: []*models.Card{{Value: "ACE", Suit: "SPADES", Code: "AS"}}, Version: 2}
+	tests := []struct {
+		name       string
+		ds         mockDeckService
+		key        string
+		wantStatus int
+	}{
+		{name: "valid", ds: mockDeckService{deck: deck}, key: "secret", wantStatus: http.StatusOK},
+		{name: "without key", ds: mockDeckService{deck: deck}, wantStatus: http.StatusForbidden},
+		{name: "event not found", ds: mockDeckService{err: models.ErrEventNotFound}, key: "secret", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDecks(tt.ds, WithOperatorKey("secret"))
+			r := httptest.NewRequest("GET", "/deck/testuuid/events/2/deck", nil)
+			r = mux.SetURLVars(r, map[string]string{"uuid": "testuuid", "seq": "2"})
+			if tt.key != "" {
+				r.Header.Set(operatorKeyHeader, tt.key)
+			}
+			w := httptest.NewRecorder()
+			d.Replay(w, r)
+			if w.Code != tt.wantStatus {
+				t.Errorf("Replay() status code = %v, want %v", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusOK && w.Header().Get("ETag") != `"2"` {
+				t.Errorf("Replay() ETag = %v, want \"2\"", w.Header().Get("ETag"))
+			}
+		})
+	}
+}
+
+func TestDecks_Events_Actor(t *testing.T) {
+	s := NewServer(NewDecks(models.NewDeckService(models.NewCardService())))
+	do := func(method, target, body string) string {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		r.Header.Set(actorHeader, "dealer")
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		b, _ := io.ReadAll(w.Result().Body)
+		return string(b)
+	}
+
+	created := do("POST", "/deck", "{}")
+	deckID := strings.Split(strings.Split(created, `"DeckID":"`)[1], `"`)[0]
+	do("POST", "/deck/"+deckID+"/draw", `{"count":1}`)
+
+	got := do("GET", "/deck/"+deckID+"/events", "")
+	for _, want := range []string{`"seq":1,"type":"created"`, `"seq":2,"type":"drawn"`, `"actor":"dealer","cards":["AS"]`} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Events() got = %v, want containing %v", got, want)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/mocak/tbupt/models"
+)
+
+var (
+	errIdempotencyKeyInvalid = errors.New("idempotency key must be at most 255 characters")
+)
+
+const (
+	// idempotencyKeyHeader carries the client generated key of the retried requests
+	idempotencyKeyHeader = "Idempotency-Key"
+	// idempotentReplayedHeader is set on the replayed responses
+	idempotentReplayedHeader = "Idempotent-Replayed"
+	// maxIdempotencyKeyLength is the longest accepted idempotency key
+	maxIdempotencyKeyLength = 255
+)
+
+// WithIdempotency enables Idempotency-Key header on create and draw requests
+// Responses are stored in the store and replayed to the retries within window
+func WithIdempotency(store models.IdempotencyStore, window time.Duration) DecksOption {
+	return func(d *Decks) {
+		d.keys = store
+		d.keyWindow = window
+	}
+}
+
+// idempotent runs handle once per idempotency key of the request
+// Replays the first response to the retries with the same request
+// Replies HTTP 422 if the key is used by a different request, HTTP 409 if its request is in progress
+// Key is released if handle panics or replies a server error, so the request can be retried
+func (d *Decks) idempotent(w http.ResponseWriter, r *http.Request, handle http.HandlerFunc) {
+	key := r.Header.Get(idempotencyKeyHeader)
+	if d.keys == nil || key == "" {
+		handle(w, r)
+		return
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		writeError(w, r, errIdempotencyKeyInvalid, nil)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, err, nil)
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	rec := &models.IdempotencyRecord{
+		Key:         key,
+		Fingerprint: fingerprint(r, body),
+		ExpiresAt:   time.Now().Add(d.keyWindow),
+	}
+	stored, err := d.keys.Reserve(rec)
+	if err != nil {
+		writeError(w, r, err, nil)
+		return
+	}
+	switch {
+	case stored == nil:
+	case stored.Fingerprint != rec.Fingerprint:
+		writeError(w, r, models.ErrIdempotencyKeyReused, nil)
+		return
+	case stored.Pending():
+		writeError(w, r, models.ErrIdempotencyKeyInProgress, nil)
+		return
+	default:
+		replay(w, stored)
+		return
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			d.release(key)
+			panic(p)
+		}
+	}()
+	rw := &recordingWriter{ResponseWriter: w}
+	handle(rw, r)
+	rec.Status = rw.status
+	if rec.Status == 0 {
+		rec.Status = http.StatusOK
+	}
+	if rec.Status >= http.StatusInternalServerError {
+		// server errors may be transient, they are not replayed
+		d.release(key)
+		return
+	}
+	rec.Header = w.Header().Clone()
+	rec.Body = rw.body.Bytes()
+	if err := d.keys.Save(rec); err != nil {
+		log.Printf("idempotency: save response of %q: %s", key, err)
+	}
+}
+
+// release removes the pending reservation of the key
+func (d *Decks) release(key string) {
+	if err := d.keys.Release(key); err != nil {
+		log.Printf("idempotency: release %q: %s", key, err)
+	}
+}
+
+// fingerprint returns the hash of the request principal, share token, method, path and body
+// Keys reused by another principal or share token are rejected instead of replaying the response of the first one
+func fingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, principalOf(r)+" "+r.Header.Get(shareTokenHeader)+"\n")
+	io.WriteString(h, r.Method+" "+r.URL.RequestURI()+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// replay writes the stored response
+func replay(w http.ResponseWriter, rec *models.IdempotencyRecord) {
+	for name, values := range rec.Header {
+		w.Header()[name] = values
+	}
+	w.Header().Set(idempotentReplayedHeader, "true")
+	w.WriteHeader(rec.Status)
+	w.Write(rec.Body)
+}
+
+// recordingWriter keeps the status and body written to the response
+type recordingWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rw *recordingWriter) WriteHeader(status int) {
+	if rw.status == 0 {
+		rw.status = status
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *recordingWriter) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	rw.body.Write(b)
+	return rw.ResponseWriter.Write(b)
+}
@@ -0,0 +1,148 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mocak/tbupt/models"
+)
+
+func TestDecks_Idempotency(t *testing.T) {
+	store := models.NewIdempotencyMemory()
+	s := NewServer(NewDecks(models.NewDeckService(models.NewCardService()), WithIdempotency(store, time.Hour)))
+	do := func(method, target, body, key string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		if key != "" {
+			r.Header.Set(idempotencyKeyHeader, key)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		return w
+	}
+
+	created := do("POST", "/deck", `{"shuffled":true}`, "create-1")
+	replayed := do("POST", "/deck", `{"shuffled":true}`, "create-1")
+	if replayed.Code != http.StatusCreated || replayed.Body.String() != created.Body.String() {
+		t.Errorf("Create() retry got = %v %s, want %v %s", replayed.Code, replayed.Body, created.Code, created.Body)
+	}
+	if replayed.Header().Get(idempotentReplayedHeader) != "true" {
+		t.Errorf("Create() retry %s header is not set", idempotentReplayedHeader)
+	}
+	deckID := strings.Split(strings.Split(created.Body.String(), `"DeckID":"`)[1], `"`)[0]
+
+	tests := []struct {
+		name       string
+		body       string
+		key        string
+		wantStatus int
+		wantETag   string
+	}{
+		{name: "first", body: `{"count":2}`, key: "draw-1", wantStatus: http.StatusOK, wantETag: `"2"`},
+		{name: "retry", body: `{"count":2}`, key: "draw-1", wantStatus: http.StatusOK, wantETag: `"2"`},
+		{name: "reused", body: `{"count":3}`, key: "draw-1", wantStatus: http.StatusUnprocessableEntity},
+		{name: "another key", body: `{"count":2}`, key: "draw-2", wantStatus: http.StatusOK, wantETag: `"3"`},
+		{name: "without key", body: `{"count":2}`, wantStatus: http.StatusOK, wantETag: `"4"`},
+		{name: "too long key", body: `{"count":2}`, key: strings.Repeat("k", 256), wantStatus: http.StatusBadRequest},
+	}
+	var first string
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := do("POST", "/deck/"+deckID+"/draw", tt.body, tt.key)
+			if w.Code != tt.wantStatus {
+				t.Errorf("Draw() status code = %v, want %v", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("ETag"); got != tt.wantETag {
+				t.Errorf("Draw() ETag = %v, want %v", got, tt.wantETag)
+			}
+			switch tt.name {
+			case "first":
+				first = w.Body.String()
+			case "retry":
+				if w.Body.String() != first {
+					t.Errorf("Draw() retry got = %s, want %s", w.Body, first)
+				}
+			}
+		})
+	}
+
+	w := do("GET", "/deck/"+deckID, "", "")
+	if !strings.Contains(w.Body.String(), `"Remaining":46`) {
+		t.Errorf("Get() got = %s, want 46 remaining cards", w.Body)
+	}
+}
+
+func TestDecks_Idempotency_Panic(t *testing.T) {
+	store := models.NewIdempotencyMemory()
+	d := NewDecks(models.NewDeckService(models.NewCardService()), WithIdempotency(store, time.Hour))
+	newRequest := func() *http.Request {
+		r := httptest.NewRequest("POST", "/deck", strings.NewReader("{}"))
+		r.Header.Set(idempotencyKeyHeader, "key")
+		return r
+	}
+
+	func() {
+		defer func() {
+			if p := recover(); p == nil {
+				t.Errorf("idempotent() did not pass the panic through")
+			}
+		}()
+		d.idempotent(httptest.NewRecorder(), newRequest(), func(w http.ResponseWriter, r *http.Request) {
+			panic("handler failed")
+		})
+	}()
+
+	w := httptest.NewRecorder()
+	d.Create(w, newRequest())
+	if w.Code != http.StatusCreated {
+		t.Errorf("Create() retry after panic status code = %v, want %v", w.Code, http.StatusCreated)
+	}
+}
+
+func TestDecks_Idempotency_ServerError(t *testing.T) {
+	d := NewDecks(mockDeckService{}, WithIdempotency(models.NewIdempotencyMemory(), time.Hour))
+	tests := []struct {
+		name       string
+		status     int
+		wantStatus int
+	}{
+		{name: "server error", status: http.StatusServiceUnavailable, wantStatus: http.StatusServiceUnavailable},
+		{name: "retry", status: http.StatusCreated, wantStatus: http.StatusCreated},
+		{name: "replay", status: http.StatusInternalServerError, wantStatus: http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/deck", strings.NewReader("{}"))
+			r.Header.Set(idempotencyKeyHeader, "key")
+			w := httptest.NewRecorder()
+			d.idempotent(w, r, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+			})
+			if w.Code != tt.wantStatus {
+				t.Errorf("idempotent() status code = %v, want %v", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestDecks_Idempotency_InProgress(t *testing.T) {
+	store := models.NewIdempotencyMemory()
+	d := NewDecks(models.NewDeckService(models.NewCardService()), WithIdempotency(store, time.Hour))
+	r := httptest.NewRequest("POST", "/deck", strings.NewReader("{}"))
+	r.Header.Set(idempotencyKeyHeader, "key")
+	if _, err := store.Reserve(&models.IdempotencyRecord{
+		Key:         "key",
+		Fingerprint: fingerprint(r, []byte("{}")),
+		ExpiresAt:   time.Now().Add(time.Hour),
+	}); err != nil {
+		t.Fatalf("Reserve() err = %s, want nil", err)
+	}
+
+	w := httptest.NewRecorder()
+	d.Create(w, r)
+	if w.Code != http.StatusConflict {
+		t.Errorf("Create() status code = %v, want %v", w.Code, http.StatusConflict)
+	}
+}
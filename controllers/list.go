@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/mocak/tbupt/json"
+	"github.com/mocak/tbupt/models"
+)
+
+// queryError is the error of a malformed query parameter
+type queryError struct {
+	param string
+}
+
+func (e queryError) Error() string {
+	return "query parameter " + e.param + " is invalid"
+}
+
+// listResponse is a page of the deck summaries
+type listResponse struct {
+	Decks  []deckSummary
+	Paging paging
+}
+
+// paging is the metadata of a listed page
+// NextCursor is set if there are more decks to list
+type paging struct {
+	Limit      int
+	Count      int
+	NextCursor string `json:",omitempty"`
+}
+
+// List is used to list deck resources by filters
+// Only the decks the principal has a role on are listed if authentication is enabled
+// Replies the request with a page of deck summaries and HTTP 200 if succeed
+//
+// GET /deck?opened=:bool&shuffled=:bool&created_after=:time&created_before=:time
+// &min_remaining=:int&max_remaining=:int&owner=:owner&principal=:principal&tag=:tag&cursor=:cursor&limit=:int
+func (d *Decks) List(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseDeckFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, r, err, nil)
+		return
+	}
+	filter.Viewer = principalOf(r)
+
+	page, err := d.ds.List(filter)
+	if err != nil {
+		writeError(w, r, err, nil)
+		return
+	}
+
+	resp := listResponse{
+		Decks:  make([]deckSummary, len(page.Decks)),
+		Paging: paging{Limit: page.Limit, Count: len(page.Decks), NextCursor: page.NextCursor},
+	}
+	for i, deck := range page.Decks {
+		resp.Decks[i] = newDeckSummary(deck)
+		if !d.seesAccess(r, deck) {
+			resp.Decks[i].hideAccess()
+		}
+	}
+	json.Response(w, r, resp, http.StatusOK)
+}
+
+// parseDeckFilter returns the deck filter of the query
+// Returns queryError if a parameter is malformed
+func parseDeckFilter(q url.Values) (models.DeckFilter, error) {
+	filter := models.DeckFilter{
+		Owner:     q.Get("owner"),
+		Principal: q.Get("principal"),
+		Tag:       q.Get("tag"),
+		Cursor:    q.Get("cursor"),
+	}
+	var err error
+	if filter.Opened, err = parseBoolParam(q, "opened"); err != nil {
+		return filter, err
+	}
+	if filter.Shuffled, err = parseBoolParam(q, "shuffled"); err != nil {
+		return filter, err
+	}
+	if filter.CreatedAfter, err = parseTimeParam(q, "created_after"); err != nil {
+		return filter, err
+	}
+	if filter.CreatedBefore, err = parseTimeParam(q, "created_before"); err != nil {
+		return filter, err
+	}
+	if filter.MinRemaining, err = parseIntParam(q, "min_remaining"); err != nil {
+		return filter, err
+	}
+	if filter.MaxRemaining, err = parseIntParam(q, "max_remaining"); err != nil {
+		return filter, err
+	}
+	limit, err := parseIntParam(q, "limit")
+	if err != nil {
+		return filter, err
+	}
+	if limit != nil {
+		filter.Limit = *limit
+	}
+	return filter, nil
+}
+
+func parseBoolParam(q url.Values, param string) (*bool, error) {
+	v := q.Get(param)
+	if v == "" {
+		return nil, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return nil, queryError{param}
+	}
+	return &b, nil
+}
+
+func parseIntParam(q url.Values, param string) (*int, error) {
+	v := q.Get(param)
+	if v == "" {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return nil, queryError{param}
+	}
+	return &n, nil
+}
+
+func parseTimeParam(q url.Values, param string) (time.Time, error) {
+	v := q.Get(param)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, queryError{param}
+	}
+	return t, nil
+}
@@ -0,0 +1,98 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mocak/tbupt/models"
+)
+
+func TestDecks_List(t *testing.T) {
+	createdAt := time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+	deck := &models.Deck{UUID: "testuuid", Remaining: 52, CreatedAt: createdAt, Owner: "dealer", Tags: []string{"poker"}}
+	tests := []struct {
+		name       string
+		query      string
+		want       string
+		wantStatus int
+	}{
+		{
+			name:  "page",
+			query: "?owner=dealer&limit=1&cursor=next",
+			want: "{\"Decks\":[{\"DeckID\":\"testuuid\",\"Shuffled\":false,\"Remaining\":52,\"Owner\":\"dealer\",\"Tags\":[\"poker\"]," +
+				"\"CreatedAt\":\"2022-01-02T03:04:05Z\"}],\"Paging\":{\"Limit\":1,\"Count\":1,\"NextCursor\":\"next\"}}",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "malformed",
+			query:      "?opened=maybe",
+			want:       "{\"code\":\"query_invalid\",\"message\":\"query parameter opened is invalid\",\"field\":\"opened\"}\n",
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDecks(mockDeckService{deck: deck})
+			w := httptest.NewRecorder()
+			d.List(w, httptest.NewRequest("GET", "/deck"+tt.query, nil))
+			if got := w.Body.String(); got != tt.want || w.Code != tt.wantStatus {
+				t.Errorf("List() = %v %v, want %v %v", w.Code, got, tt.wantStatus, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseDeckFilter(t *testing.T) {
+	truth, three, ten := true, 3, 10
+	tests := []struct {
+		name    string
+		query   string
+		want    models.DeckFilter
+		wantErr error
+	}{
+		{name: "empty", query: "", want: models.DeckFilter{}},
+		{
+			name:  "all",
+			query: "opened=true&shuffled=1&created_after=2022-01-02T03:04:05Z&created_before=2022-01-03T00:00:00%2B01:00&min_remaining=3&max_remaining=10&owner=o&principal=p&tag=t&cursor=c&limit=5",
+			want: models.DeckFilter{
+				Opened:        &truth,
+				Shuffled:      &truth,
+				CreatedAfter:  time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC),
+				CreatedBefore: time.Date(2022, 1, 3, 0, 0, 0, 0, time.FixedZone("", 3600)),
+				MinRemaining:  &three,
+				MaxRemaining:  &ten,
+				Owner:         "o",
+				Principal:     "p",
+				Tag:           "t",
+				Cursor:        "c",
+				Limit:         5,
+			},
+		},
+		{name: "bool", query: "shuffled=yes", wantErr: queryError{"shuffled"}},
+		{name: "time", query: "created_after=yesterday", wantErr: queryError{"created_after"}},
+		{name: "int", query: "limit=ten", wantErr: queryError{"limit"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, _ := url.ParseQuery(tt.query)
+			got, err := parseDeckFilter(q)
+			if err != tt.wantErr {
+				t.Fatalf("parseDeckFilter() err = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if !got.CreatedBefore.Equal(tt.want.CreatedBefore) {
+				t.Errorf("parseDeckFilter() created before = %v, want %v", got.CreatedBefore, tt.want.CreatedBefore)
+			}
+			got.CreatedBefore, tt.want.CreatedBefore = time.Time{}, time.Time{}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseDeckFilter() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/mocak/tbupt/json"
+	"github.com/mocak/tbupt/models"
+)
+
+// playerTokenHeader carries the token of the player owning the hands
+const playerTokenHeader = "X-Player-Token"
+
+type pileRequest struct {
+	Cards string `json:"cards"`
+	Count int    `json:"count"`
+	To    string `json:"to"`
+}
+
+// codes returns the comma separated card codes of the request
+func (pr pileRequest) codes() []string {
+	if strings.TrimSpace(pr.Cards) == "" {
+		return nil
+	}
+	return strings.Split(pr.Cards, ",")
+}
+
+// Pile is used to list cards of the deck pile
+// Hands of the other players have only their revealed cards
+// Replies the request with pile resource and HTTP 200 if succeed
+//
+// GET /deck/:uuid/piles/:pile
+func (d *Decks) Pile(w http.ResponseWriter, r *http.Request) {
+	deck, err := d.deckByUUID(w, r)
+	if err != nil {
+		return
+	}
+	d.replyPile(w, r, deck)
+}
+
+// replyPile replies the request with the pile of the request as seen by the player
+func (d *Decks) replyPile(w http.ResponseWriter, r *http.Request, deck *models.Deck) {
+	pile, err := deck.Pile(mux.Vars(r)["pile"])
+	if err != nil {
+		writeError(w, r, err, deck)
+		return
+	}
+	json.Response(w, r, pile.Redacted(deck.Player), http.StatusOK)
+}
+
+// AddToPile is used to put drawn cards on top of the deck pile
+// All drawn cards are added if cards are not given
+// Replies the request with pile resource and HTTP 200 if succeed
+//
+// POST /deck/:uuid/piles/:pile/add
+func (d *Decks) AddToPile(w http.ResponseWriter, r *http.Request) {
+	pileReq := pileRequest{}
+	if err := json.DecodeBody(w, r, &pileReq); err != nil {
+		return
+	}
+
+	deck, err := d.deckByUUID(w, r)
+	if err != nil {
+		return
+	}
+
+	if err := d.ds.AddToPile(deck, mux.Vars(r)["pile"], pileReq.codes()); err != nil {
+		writeError(w, r, err, deck)
+		return
+	}
+	d.replyPile(w, r, deck)
+}
+
+// DrawFromPile is used to draw cards from the top of the deck pile
+// Replies the request with drawn card resources and HTTP 200 if succeed
+// Requires models.RoleDraw on the deck
+//
+// POST /deck/:uuid/piles/:pile/draw
+func (d *Decks) DrawFromPile(w http.ResponseWriter, r *http.Request) {
+	pileReq := pileRequest{}
+	if err := json.DecodeBody(w, r, &pileReq); err != nil {
+		return
+	}
+
+	deck, err := d.deckWithRole(w, r, models.RoleDraw)
+	if err != nil {
+		return
+	}
+
+	cards, err := d.ds.DrawFromPile(deck, mux.Vars(r)["pile"], pileReq.Count)
+	if err != nil {
+		writeError(w, r, err, deck)
+		return
+	}
+	json.Response(w, r, cards, http.StatusOK)
+}
+
+// MoveCards is used to move cards of the deck pile on top of another pile
+// Moves the given cards if set, otherwise count cards from the top
+// Replies the request with moved card resources and HTTP 200 if succeed
+//
+// POST /deck/:uuid/piles/:pile/move
+func (d *Decks) MoveCards(w http.ResponseWriter, r *http.Request) {
+	pileReq := pileRequest{}
+	if err := json.DecodeBody(w, r, &pileReq); err != nil {
+		return
+	}
+
+	deck, err := d.deckByUUID(w, r)
+	if err != nil {
+		return
+	}
+
+	cards, err := d.ds.MoveCards(deck, mux.Vars(r)["pile"], pileReq.To, pileReq.codes(), pileReq.Count)
+	if err != nil {
+		writeError(w, r, err, deck)
+		return
+	}
+	json.Response(w, r, cards, http.StatusOK)
+}
+
+// ClaimPile is used to make the deck pile the hand of the player of the X-Player-Token header
+// Cards of the hand are visible only to the player unless they are revealed
+// Requires the draw role on the deck, replies the request with pile resource and HTTP 200 if succeed
+//
+// POST /deck/:uuid/piles/:pile/claim
+func (d *Decks) ClaimPile(w http.ResponseWriter, r *http.Request) {
+	deck, err := d.deckOfPlayer(w, r)
+	if err != nil {
+		return
+	}
+	if err := d.ds.Claim(deck, mux.Vars(r)["pile"]); err != nil {
+		writeError(w, r, err, deck)
+		return
+	}
+	d.replyPile(w, r, deck)
+}
+
+// Deal is used to draw cards from the top of the deck on top of the deck pile
+// Dealt cards are not replied to the dealer if the pile is the hand of another player
+// Replies the request with pile resource and HTTP 200 if succeed
+//
+// POST /deck/:uuid/piles/:pile/deal
+func (d *Decks) Deal(w http.ResponseWriter, r *http.Request) {
+	pileReq := pileRequest{}
+	if err := json.DecodeBody(w, r, &pileReq); err != nil {
+		return
+	}
+
+	deck, err := d.deckByUUID(w, r)
+	if err != nil {
+		return
+	}
+
+	if _, err := d.ds.Deal(deck, mux.Vars(r)["pile"], pileReq.Count); err != nil {
+		writeError(w, r, err, deck)
+		return
+	}
+	d.replyPile(w, r, deck)
+}
+
+// Reveal is used to make the cards of the player hand visible to everyone
+// Reveals the given cards if set, otherwise all cards of the hand
+// Requires the draw role on the deck, replies the request with pile resource and HTTP 200 if succeed
+//
+// POST /deck/:uuid/piles/:pile/reveal
+func (d *Decks) Reveal(w http.ResponseWriter, r *http.Request) {
+	pileReq := pileRequest{}
+	if err := json.DecodeBody(w, r, &pileReq); err != nil {
+		return
+	}
+
+	deck, err := d.deckOfPlayer(w, r)
+	if err != nil {
+		return
+	}
+
+	if err := d.ds.Reveal(deck, mux.Vars(r)["pile"], pileReq.codes()); err != nil {
+		writeError(w, r, err, deck)
+		return
+	}
+	d.replyPile(w, r, deck)
+}
+
+// deckOfPlayer is used to get models.Deck record by URL for the player of the X-Player-Token header
+// Draw role is enough for the players to manage their own hands
+// Sets models.ErrPlayerTokenRequired error response if the request has no player token
+func (d *Decks) deckOfPlayer(w http.ResponseWriter, r *http.Request) (*models.Deck, error) {
+	deck, err := d.deckWithRole(w, r, models.RoleDraw)
+	if err != nil {
+		return nil, err
+	}
+	if deck.Player == "" {
+		writeError(w, r, models.ErrPlayerTokenRequired, deck)
+		return nil, models.ErrPlayerTokenRequired
+	}
+	return deck, nil
+}
@@ -0,0 +1,267 @@
+package controllers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/mocak/tbupt/models"
+)
+
+func TestDecks_Piles(t *testing.T) {
+	cards := []*models.Card{
+		{Value: "ACE", Suit: "SPADES", Code: "AS"},
+	}
+	piles := map[string]*models.Pile{
+		"discard": {Cards: cards, Remaining: 1},
+	}
+	cardsJSON := "[{\"value\":\"ACE\",\"suit\":\"SPADES\",\"code\":\"AS\"}]"
+	pileJSON := "{\"cards\":" + cardsJSON + ",\"remaining\":1}"
+
+	type args struct {
+		handler func(d *Decks) http.HandlerFunc
+		pile    string
+		body    string
+	}
+	tests := []struct {
+		name       string
+		ds         models.DeckService
+		args       args
+		want       string
+		wantStatus int
+	}{
+		{
+			name: "list",
+			ds:   mockDeckService{deck: &models.Deck{UUID: "testuuid", Piles: piles}},
+			args: args{
+				handler: func(d *Decks) http.HandlerFunc { return d.Pile },
+				pile:    "discard",
+			},
+			want:       pileJSON,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "list not found",
+			ds:   mockDeckService{deck: &models.Deck{UUID: "testuuid", Piles: piles}},
+			args: args{
+				handler: func(d *Decks) http.HandlerFunc { return d.Pile },
+				pile:    "unknown",
+			},
+			want:       "{\"code\":\"pile_not_found\",\"message\":\"pile not found\",\"field\":\"pile\"}\n",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name: "add",
+			ds:   mockDeckService{deck: &models.Deck{UUID: "testuuid", Piles: piles}},
+			args: args{
+				handler: func(d *Decks) http.HandlerFunc { return d.AddToPile },
+				pile:    "discard",
+				body:    "{\"cards\":\"AS\"}",
+			},
+			want:       pileJSON,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "draw",
+			ds:   mockDeckService{deck: &models.Deck{UUID: "testuuid"}, cards: cards},
+			args: args{
+				handler: func(d *Decks) http.HandlerFunc { return d.DrawFromPile },
+				pile:    "discard",
+				body:    "{\"count\":1}",
+			},
+			want:       cardsJSON,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "move",
+			ds:   mockDeckService{deck: &models.Deck{UUID: "testuuid"}, cards: cards},
+			args: args{
+				handler: func(d *Decks) http.HandlerFunc { return d.MoveCards },
+				pile:    "discard",
+				body:    "{\"to\":\"player-1\",\"count\":1}",
+			},
+			want:       cardsJSON,
+			wantStatus: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &Decks{ds: tt.ds}
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("POST", "/deck/testuuid/piles/"+tt.args.pile, strings.NewReader(tt.args.body))
+			r = mux.SetURLVars(r, map[string]string{"uuid": "testuuid", "pile": tt.args.pile})
+			tt.args.handler(d)(w, r)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+			byteSlice, _ := io.ReadAll(resp.Body)
+			got := string(byteSlice)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("TestResponse() = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(resp.StatusCode, tt.wantStatus) {
+				t.Errorf("TestResponse() status code = %v, want %v", resp.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestDecks_Hands_Share(t *testing.T) {
+	auth := NewAuthenticator(map[string]string{"alice-key": "alice"}, nil)
+	s := NewServer(NewDecks(models.NewDeckService(models.NewCardService())), WithAuth(auth))
+	do := func(method, target, body, key, share, token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		if key != "" {
+			r.Header.Set(apiKeyHeader, key)
+		}
+		if share != "" {
+			r.Header.Set(shareTokenHeader, share)
+		}
+		if token != "" {
+			r.Header.Set(playerTokenHeader, token)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		return w
+	}
+	created := do("POST", "/deck?cards=AS,KH,QD", "{}", "alice-key", "", "")
+	deck := "/deck/" + strings.Split(strings.Split(created.Body.String(), `"DeckID":"`)[1], `"`)[0]
+	mint := func(role string) string {
+		w := do("POST", deck+"/shares", `{"role":"`+role+`"}`, "alice-key", "", "")
+		if w.Code != http.StatusCreated {
+			t.Fatalf("CreateShare() got = %v %v, want 201", w.Code, w.Body.String())
+		}
+		return strings.Split(strings.Split(w.Body.String(), `"token":"`)[1], `"`)[0]
+	}
+	viewToken, drawToken := mint(models.RoleView), mint(models.RoleDraw)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		key        string
+		share      string
+		token      string
+		wantStatus int
+	}{
+		{"view share claims", "POST", "/piles/bob/claim", "", "", viewToken, "bob", http.StatusForbidden},
+		{"draw share claims without token", "POST", "/piles/bob/claim", "", "", drawToken, "", http.StatusForbidden},
+		{"draw share claims", "POST", "/piles/bob/claim", "", "", drawToken, "bob", http.StatusOK},
+		{"owner deals", "POST", "/piles/bob/deal", `{"count":2}`, "alice-key", "", "", http.StatusOK},
+		{"draw share reveals without token", "POST", "/piles/bob/reveal", `{"cards":"KH"}`, "", drawToken, "", http.StatusForbidden},
+		{"draw share reveals other hand", "POST", "/piles/bob/reveal", `{"cards":"KH"}`, "", drawToken, "carol", http.StatusForbidden},
+		{"draw share reveals", "POST", "/piles/bob/reveal", `{"cards":"KH"}`, "", drawToken, "bob", http.StatusOK},
+		{"view share reveals", "POST", "/piles/bob/reveal", `{"cards":"AS"}`, "", viewToken, "bob", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := do(tt.method, deck+tt.path, tt.body, tt.key, tt.share, tt.token)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("%s %s status = %v, want %v", tt.method, tt.path, w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestDecks_Hands(t *testing.T) {
+	s := NewServer(NewDecks(models.NewDeckService(models.NewCardService())))
+	do := func(method, target, body, token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		if token != "" {
+			r.Header.Set(playerTokenHeader, token)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		return w
+	}
+	created := do("POST", "/deck?cards=AS,KH,QD", "{}", "")
+	deckID := strings.Split(strings.Split(created.Body.String(), `"DeckID":"`)[1], `"`)[0]
+	owner := models.PlayerKey("alice")
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		token      string
+		want       string
+		wantStatus int
+	}{
+		{
+			name:       "claim without token",
+			method:     "POST",
+			path:       "/piles/alice/claim",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "claim",
+			method:     "POST",
+			path:       "/piles/alice/claim",
+			token:      "alice",
+			want:       `{"cards":[],"remaining":0,"owner":"` + owner + `"}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "deal to hand",
+			method:     "POST",
+			path:       "/piles/alice/deal",
+			body:       `{"count":2}`,
+			want:       `{"cards":[],"remaining":2,"owner":"` + owner + `"}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "hand of owner",
+			method:     "GET",
+			path:       "/piles/alice",
+			token:      "alice",
+			want:       `{"cards":[{"value":"ACE","suit":"SPADES","code":"AS"},{"value":"KING","suit":"HEARTS","code":"KH"}],"remaining":2,"owner":"` + owner + `"}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "draw from other hand",
+			method:     "POST",
+			path:       "/piles/alice/draw",
+			body:       `{"count":1}`,
+			token:      "bob",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "reveal",
+			method:     "POST",
+			path:       "/piles/alice/reveal",
+			body:       `{"cards":"KH"}`,
+			token:      "alice",
+			want:       `{"cards":[{"value":"ACE","suit":"SPADES","code":"AS"},{"value":"KING","suit":"HEARTS","code":"KH"}],"remaining":2,"owner":"` + owner + `","revealed":["KH"]}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "hand of other player",
+			method:     "GET",
+			path:       "/piles/alice",
+			token:      "bob",
+			want:       `{"cards":[{"value":"KING","suit":"HEARTS","code":"KH"}],"remaining":2,"owner":"` + owner + `","revealed":["KH"]}`,
+			wantStatus: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := do(tt.method, "/deck/"+deckID+tt.path, tt.body, tt.token)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("%s %s status = %v, want %v", tt.method, tt.path, w.Code, tt.wantStatus)
+			}
+			if tt.want != "" && w.Body.String() != tt.want {
+				t.Errorf("%s %s got = %v, want %v", tt.method, tt.path, w.Body.String(), tt.want)
+			}
+		})
+	}
+
+	opened := do("PUT", "/deck/"+deckID+"/open", "", "bob")
+	if got := opened.Body.String(); strings.Contains(got, `"AS"`) || !strings.Contains(got, `"QD"`) {
+		t.Errorf("Open() got = %v, want remaining cards without the hidden AS", got)
+	}
+}
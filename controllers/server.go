@@ -6,21 +6,89 @@ import (
 )
 
 type Server struct {
-	r  *mux.Router
-	dc *Decks
+	r    *mux.Router
+	dc   *Decks
+	auth *Authenticator
+}
+
+// ServerOption is used to configure Server
+type ServerOption func(*Server)
+
+// WithAuth requires every request to be authenticated by the authenticator
+// Decks created by a principal can be changed only by the principal and its granted principals
+// Authentication is disabled by default
+func WithAuth(auth *Authenticator) ServerOption {
+	return func(s *Server) {
+		s.auth = auth
+	}
 }
 
 // NewServer returns new server instance
-func NewServer(dc *Decks) *Server {
-	return &Server{dc: dc}
+func NewServer(dc *Decks, opts ...ServerOption) *Server {
+	s := &Server{dc: dc}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 // ServeHTTP dispatches the handler registered in the matched route.
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	s.r = mux.NewRouter()
+	if s.auth != nil {
+		s.r.Use(s.authenticate)
+	}
 	s.r.HandleFunc("/deck", s.dc.Create).Methods("POST")
+	s.r.HandleFunc("/deck", s.dc.List).Methods("GET")
+	s.r.HandleFunc("/deck/{uuid}", s.dc.Get).Methods("GET")
+	s.r.HandleFunc("/deck/{uuid}", s.dc.Delete).Methods("DELETE")
+	s.r.HandleFunc("/deck/{uuid}/peek", s.dc.Peek).Methods("GET")
+	s.r.HandleFunc("/deck/{uuid}/events", s.dc.Events).Methods("GET")
+	s.r.HandleFunc("/deck/{uuid}/events/stream", s.dc.Stream).Methods("GET")
+	s.r.HandleFunc("/deck/{uuid}/events/{seq:[0-9]+}/deck", s.dc.Replay).Methods("GET")
 	s.r.HandleFunc("/deck/{uuid}/open", s.dc.Open).Methods("PUT")
 	s.r.HandleFunc("/deck/{uuid}/draw", s.dc.Draw).Methods("POST")
+	s.r.HandleFunc("/deck/{uuid}/return", s.dc.Return).Methods("POST")
+	s.r.HandleFunc("/deck/{uuid}/shuffle", s.dc.Shuffle).Methods("POST")
+	s.r.HandleFunc("/deck/{uuid}/undo", s.dc.Undo).Methods("POST")
+	s.r.HandleFunc("/deck/{uuid}/grants", s.dc.Grants).Methods("PUT")
+	s.r.HandleFunc("/deck/{uuid}/acl", s.dc.SetACL).Methods("PUT")
+	s.r.HandleFunc("/deck/{uuid}/shares", s.dc.CreateShare).Methods("POST")
+	s.r.HandleFunc("/deck/{uuid}/shares", s.dc.Shares).Methods("GET")
+	s.r.HandleFunc("/deck/{uuid}/shares/{id}", s.dc.DeleteShare).Methods("DELETE")
+	s.r.HandleFunc("/deck/{uuid}/piles/{pile}", s.dc.Pile).Methods("GET")
+	s.r.HandleFunc("/deck/{uuid}/piles/{pile}/add", s.dc.AddToPile).Methods("POST")
+	s.r.HandleFunc("/deck/{uuid}/piles/{pile}/draw", s.dc.DrawFromPile).Methods("POST")
+	s.r.HandleFunc("/deck/{uuid}/piles/{pile}/move", s.dc.MoveCards).Methods("POST")
+	s.r.HandleFunc("/deck/{uuid}/piles/{pile}/claim", s.dc.ClaimPile).Methods("POST")
+	s.r.HandleFunc("/deck/{uuid}/piles/{pile}/deal", s.dc.Deal).Methods("POST")
+	s.r.HandleFunc("/deck/{uuid}/piles/{pile}/reveal", s.dc.Reveal).Methods("POST")
+	s.r.HandleFunc("/deck/{uuid}/webhooks", s.dc.CreateWebhook).Methods("POST")
+	s.r.HandleFunc("/deck/{uuid}/webhooks", s.dc.Webhooks).Methods("GET")
+	s.r.HandleFunc("/deck/{uuid}/webhooks/{id}", s.dc.DeleteWebhook).Methods("DELETE")
+	s.r.HandleFunc("/webhooks", s.dc.CreateWebhook).Methods("POST")
+	s.r.HandleFunc("/webhooks", s.dc.Webhooks).Methods("GET")
+	s.r.HandleFunc("/webhooks/dead-letters", s.dc.DeadLetters).Methods("GET")
+	s.r.HandleFunc("/webhooks/{id}", s.dc.DeleteWebhook).Methods("DELETE")
+	s.r.HandleFunc("/debug/vars", s.dc.Vars).Methods("GET")
 
 	s.r.ServeHTTP(w, r)
 }
+
+// authenticate passes the requests of a deck with a valid share token of the deck instead of credentials,
+// others are authenticated by the authenticator
+// Requests with an invalid share token are replied with HTTP 401
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	authenticated := s.auth.Middleware(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !shareOnly(r) {
+			authenticated.ServeHTTP(w, r)
+			return
+		}
+		if err := s.dc.checkShare(r); err != nil {
+			unauthorized(w, r, err)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
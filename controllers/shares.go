@@ -0,0 +1,149 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/mocak/tbupt/json"
+	"github.com/mocak/tbupt/models"
+)
+
+var errShareTokenInvalid = errors.New("share token is invalid or revoked")
+
+// shareTokenHeader carries the share token of the request
+const shareTokenHeader = "X-Share-Token"
+
+// aclRequest is the roles of the principals on the deck
+type aclRequest struct {
+	ACL map[string]string `json:"acl"`
+}
+
+// SetACL is used to replace the roles of the principals on the deck
+// Only the owner can change the roles if authentication is enabled
+// Replies the request with deck resource info and HTTP 200 if succeed
+//
+// PUT /deck/:uuid/acl
+func (d *Decks) SetACL(w http.ResponseWriter, r *http.Request) {
+	aclReq := aclRequest{}
+	if err := json.DecodeBody(w, r, &aclReq); err != nil {
+		return
+	}
+
+	deck, err := d.deckOfOwner(w, r)
+	if err != nil {
+		return
+	}
+	if err := ifMatch(r, deck); err != nil {
+		writeError(w, r, err, deck)
+		return
+	}
+
+	if err := d.ds.SetACL(deck, aclReq.ACL); err != nil {
+		writeError(w, r, err, deck)
+		return
+	}
+	setETag(w, deck)
+	json.Response(w, r, newDeckResponse(deck), http.StatusOK)
+}
+
+// shareRequest is the role of the minted share token
+type shareRequest struct {
+	Role string `json:"role"`
+}
+
+// shareResponse is the share resource, Token is set only when the share is minted
+type shareResponse struct {
+	ID        string    `json:"id"`
+	Role      string    `json:"role"`
+	Token     string    `json:"token,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CreateShare is used to mint a share token of the role on the deck
+// Only the owner can mint share tokens if authentication is enabled
+// Replies the request with share resource carrying the token and HTTP 201 if succeed
+//
+// POST /deck/:uuid/shares
+func (d *Decks) CreateShare(w http.ResponseWriter, r *http.Request) {
+	shareReq := shareRequest{}
+	if err := json.DecodeBody(w, r, &shareReq); err != nil {
+		return
+	}
+
+	deck, err := d.deckOfOwner(w, r)
+	if err != nil {
+		return
+	}
+
+	share, err := d.ds.Share(deck, shareReq.Role)
+	if err != nil {
+		writeError(w, r, err, deck)
+		return
+	}
+	setETag(w, deck)
+	json.Response(w, r, newShareResponse(share), http.StatusCreated)
+}
+
+// Shares is used to list the share tokens of the deck without the tokens
+// Replies the request with share resources and HTTP 200 if succeed
+//
+// GET /deck/:uuid/shares
+func (d *Decks) Shares(w http.ResponseWriter, r *http.Request) {
+	deck, err := d.deckOfOwner(w, r)
+	if err != nil {
+		return
+	}
+
+	shares := make([]shareResponse, len(deck.Shares))
+	for i, share := range deck.Shares {
+		shares[i] = newShareResponse(share)
+	}
+	json.Response(w, r, shares, http.StatusOK)
+}
+
+// DeleteShare is used to revoke the share token of the deck
+// Replies the request with HTTP 204 if succeed
+//
+// DELETE /deck/:uuid/shares/:id
+func (d *Decks) DeleteShare(w http.ResponseWriter, r *http.Request) {
+	deck, err := d.deckOfOwner(w, r)
+	if err != nil {
+		return
+	}
+
+	if err := d.ds.Unshare(deck, mux.Vars(r)["id"]); err != nil {
+		writeError(w, r, err, deck)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkShare verifies the share token of the request is a share of the deck of the route
+// Returns errShareTokenInvalid if deck is not found or expired, or the token is not its share
+// Storage errors are returned as is
+func (d *Decks) checkShare(r *http.Request) error {
+	deck, err := d.ds.ByUUID(mux.Vars(r)["uuid"])
+	switch err {
+	case models.ErrNotFound, models.ErrUUIDInvalid:
+		return errShareTokenInvalid
+	}
+	if err != nil {
+		return err
+	}
+	if deck.ShareOf(r.Header.Get(shareTokenHeader)) == nil {
+		return errShareTokenInvalid
+	}
+	return nil
+}
+
+// newShareResponse returns the resource of the given share
+func newShareResponse(share *models.Share) shareResponse {
+	return shareResponse{
+		ID:        share.ID,
+		Role:      share.Role,
+		Token:     share.Token,
+		CreatedAt: share.CreatedAt,
+	}
+}
@@ -0,0 +1,198 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mocak/tbupt/models"
+)
+
+func TestDecks_Shares(t *testing.T) {
+	auth := NewAuthenticator(map[string]string{"alice-key": "alice", "bob-key": "bob", "carol-key": "carol"}, nil)
+	wh := models.NewWebhooks()
+	defer wh.Close()
+	d := NewDecks(models.NewDeckService(models.NewCardService()),
+		WithOperatorKey("operator-key"), WithHub(models.NewHub(models.DefaultHubBuffer)), WithWebhooks(wh))
+	s := NewServer(d, WithAuth(auth))
+	do := func(method, target, body, key, share string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		r.Header.Set(operatorKeyHeader, "operator-key")
+		if key != "" {
+			r.Header.Set(apiKeyHeader, key)
+		}
+		if share != "" {
+			r.Header.Set(shareTokenHeader, share)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		return w
+	}
+	created := do("POST", "/deck", "{}", "alice-key", "")
+	deckID := strings.Split(strings.Split(created.Body.String(), `"DeckID":"`)[1], `"`)[0]
+	deck := "/deck/" + deckID
+	other := do("POST", "/deck", "{}", "alice-key", "")
+	otherDeck := "/deck/" + strings.Split(strings.Split(other.Body.String(), `"DeckID":"`)[1], `"`)[0]
+
+	mint := func(role string) (string, string) {
+		w := do("POST", deck+"/shares", `{"role":"`+role+`"}`, "alice-key", "")
+		if w.Code != http.StatusCreated {
+			t.Fatalf("CreateShare() got = %v %v, want 201", w.Code, w.Body.String())
+		}
+		id := strings.Split(strings.Split(w.Body.String(), `"id":"`)[1], `"`)[0]
+		token := strings.Split(strings.Split(w.Body.String(), `"token":"`)[1], `"`)[0]
+		return id, token
+	}
+	_, viewToken := mint(models.RoleView)
+	drawID, drawToken := mint(models.RoleDraw)
+
+	if w := do("PUT", deck+"/acl", `{"acl":{"bob":"draw"}}`, "alice-key", ""); w.Code != http.StatusOK {
+		t.Fatalf("SetACL() got = %v %v, want 200", w.Code, w.Body.String())
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		key        string
+		share      string
+		wantStatus int
+	}{
+		{"view share gets", "GET", deck, "", "", viewToken, http.StatusOK},
+		{"view share draws", "POST", deck + "/draw?count=1", "", "", viewToken, http.StatusForbidden},
+		{"draw share draws", "POST", deck + "/draw?count=1", "", "", drawToken, http.StatusOK},
+		{"draw share opens", "PUT", deck + "/open", "", "", drawToken, http.StatusForbidden},
+		{"draw share mints", "POST", deck + "/shares", `{"role":"full"}`, "", drawToken, http.StatusForbidden},
+		{"forged share", "GET", deck, "", "", "forged", http.StatusUnauthorized},
+		{"share of other route", "POST", "/deck", "{}", "", viewToken, http.StatusUnauthorized},
+		{"share of other deck", "GET", otherDeck, "", "", viewToken, http.StatusUnauthorized},
+		{"view share replays", "GET", deck + "/events/1/deck", "", "", viewToken, http.StatusOK},
+		{"forged share replays", "GET", deck + "/events/1/deck", "", "", "forged", http.StatusUnauthorized},
+		{"forged share lists events", "GET", deck + "/events", "", "", "forged", http.StatusUnauthorized},
+		{"forged share streams", "GET", deck + "/events/stream", "", "", "forged", http.StatusUnauthorized},
+		{"forged share of unknown deck", "GET", "/deck/unknown/events/stream", "", "", "forged", http.StatusUnauthorized},
+		{"view share lists webhooks", "GET", deck + "/webhooks", "", "", viewToken, http.StatusForbidden},
+		{"draw role lists webhooks", "GET", deck + "/webhooks", "", "bob-key", "", http.StatusForbidden},
+		{"owner lists webhooks", "GET", deck + "/webhooks", "", "alice-key", "", http.StatusOK},
+		{"no role replays", "GET", deck + "/events/1/deck", "", "carol-key", "", http.StatusForbidden},
+		{"draw role draws", "POST", deck + "/draw?count=1", "", "bob-key", "", http.StatusOK},
+		{"draw role opens", "PUT", deck + "/open", "", "bob-key", "", http.StatusForbidden},
+		{"no role gets", "GET", deck, "", "carol-key", "", http.StatusForbidden},
+		{"no role lists events", "GET", deck + "/events", "", "carol-key", "", http.StatusForbidden},
+		{"other sets acl", "PUT", deck + "/acl", `{"acl":{}}`, "bob-key", "", http.StatusForbidden},
+		{"unknown role", "POST", deck + "/shares", `{"role":"admin"}`, "alice-key", "", http.StatusUnprocessableEntity},
+		{"list shares", "GET", deck + "/shares", "", "alice-key", "", http.StatusOK},
+		{"revoke", "DELETE", deck + "/shares/" + drawID, "", "alice-key", "", http.StatusNoContent},
+		{"revoke again", "DELETE", deck + "/shares/" + drawID, "", "alice-key", "", http.StatusNotFound},
+		{"revoked share draws", "POST", deck + "/draw?count=1", "", "", drawToken, http.StatusUnauthorized},
+		{"owner opens", "PUT", deck + "/open", "", "alice-key", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := do(tt.method, tt.target, tt.body, tt.key, tt.share); w.Code != tt.wantStatus {
+				t.Errorf("%s %s status = %v, want %v", tt.method, tt.target, w.Code, tt.wantStatus)
+			}
+		})
+	}
+
+	if w := do("GET", deck+"/shares", "", "alice-key", ""); strings.Contains(w.Body.String(), `"token"`) {
+		t.Errorf("Shares() got = %v, want no tokens", w.Body.String())
+	}
+}
+
+func TestDecks_List_Access(t *testing.T) {
+	auth := NewAuthenticator(map[string]string{"alice-key": "alice", "bob-key": "bob", "carol-key": "carol"}, nil)
+	s := NewServer(NewDecks(models.NewDeckService(models.NewCardService())), WithAuth(auth))
+	do := func(method, target, body, key string) string {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		r.Header.Set(apiKeyHeader, key)
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		return w.Body.String()
+	}
+	private := do("POST", "/deck", `{"grants":["dave"],"acl":{"bob":"view"}}`, "alice-key")
+	privateID := strings.Split(strings.Split(private, `"DeckID":"`)[1], `"`)[0]
+	public := do("POST", "/deck", "{}", "bob-key")
+	publicID := strings.Split(strings.Split(public, `"DeckID":"`)[1], `"`)[0]
+
+	tests := []struct {
+		name       string
+		key        string
+		wantDecks  []string
+		wantAccess bool
+	}{
+		{"owner", "alice-key", []string{privateID, publicID}, true},
+		{"acl principal", "bob-key", []string{privateID, publicID}, false},
+		{"principal without role", "carol-key", []string{publicID}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := do("GET", "/deck", "", tt.key)
+			if n := strings.Count(got, `"DeckID"`); n != len(tt.wantDecks) {
+				t.Errorf("List() got %d decks, want %v in %v", n, tt.wantDecks, got)
+			}
+			for _, id := range tt.wantDecks {
+				if !strings.Contains(got, id) {
+					t.Errorf("List() got = %v, want deck %v", got, id)
+				}
+			}
+			if hasAccess := strings.Contains(got, `"Grants"`) && strings.Contains(got, `"ACL"`); hasAccess != tt.wantAccess {
+				t.Errorf("List() got grants and acl = %v, want %v", hasAccess, tt.wantAccess)
+			}
+		})
+	}
+}
+
+func TestDecks_Seed_Access(t *testing.T) {
+	auth := NewAuthenticator(map[string]string{"alice-key": "alice", "bob-key": "bob"}, nil)
+	s := NewServer(NewDecks(models.NewDeckService(models.NewCardService()), WithOperatorKey("operator-key")), WithAuth(auth))
+	do := func(method, target, body, key, share, operator string) string {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		if key != "" {
+			r.Header.Set(apiKeyHeader, key)
+		}
+		if share != "" {
+			r.Header.Set(shareTokenHeader, share)
+		}
+		if operator != "" {
+			r.Header.Set(operatorKeyHeader, operator)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		return w.Body.String()
+	}
+	created := do("POST", "/deck", `{"shuffled":true,"seed":42}`, "alice-key", "", "")
+	deck := "/deck/" + strings.Split(strings.Split(created, `"DeckID":"`)[1], `"`)[0]
+	minted := do("POST", deck+"/shares", `{"role":"full"}`, "alice-key", "", "")
+	fullToken := strings.Split(strings.Split(minted, `"token":"`)[1], `"`)[0]
+
+	tests := []struct {
+		name     string
+		method   string
+		target   string
+		key      string
+		share    string
+		operator string
+		wantSeed bool
+	}{
+		{"owner gets", "GET", deck, "alice-key", "", "", true},
+		{"viewer gets", "GET", deck, "bob-key", "", "", false},
+		{"viewer lists", "GET", "/deck", "bob-key", "", "", false},
+		{"share gets", "GET", deck, "", fullToken, "", false},
+		{"share shuffles", "POST", deck + "/shuffle", "", fullToken, "", false},
+		{"operator gets", "GET", deck, "bob-key", "", "operator-key", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := do(tt.method, tt.target, "{}", tt.key, tt.share, tt.operator)
+			if !strings.Contains(got, `"DeckID"`) {
+				t.Fatalf("%s %s got = %v, want deck", tt.method, tt.target, got)
+			}
+			if hasSeed := strings.Contains(got, `"Seed":42`); hasSeed != tt.wantSeed {
+				t.Errorf("%s %s got seed = %v, want %v in %v", tt.method, tt.target, hasSeed, tt.wantSeed, got)
+			}
+		})
+	}
+}
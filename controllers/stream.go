@@ -0,0 +1,247 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/mocak/tbupt/models"
+)
+
+var (
+	errStreamNotSupported = errors.New("event streaming is not enabled")
+)
+
+const (
+	// lastEventIDHeader carries the sequence of the last event received before reconnecting
+	lastEventIDHeader = "Last-Event-ID"
+	// streamPingInterval is the interval of keeping the idle streams alive
+	streamPingInterval = 15 * time.Second
+	// streamWriteTimeout is the longest time of writing a message to the websocket
+	streamWriteTimeout = 10 * time.Second
+)
+
+// WithHub enables streaming the deck events published to the hub
+// Streaming is disabled by default
+func WithHub(hub *models.Hub) DecksOption {
+	return func(d *Decks) {
+		d.hub = hub
+	}
+}
+
+var upgrader = websocket.Upgrader{}
+
+// eventSink writes the streamed events to a client
+type eventSink interface {
+	send(event *models.DeckEvent) error
+	ping() error
+	// end reports the reason of the end of the stream if it is ended by the server
+	end(err error)
+}
+
+// Stream is used to receive the events of the deck as they happen
+// WebSocket upgrade requests receive the events as json messages, other requests as server-sent events
+// Events after the sequence in cursor query parameter or Last-Event-ID header are sent first
+// Subscribers too slow to receive the events are disconnected, they can reconnect from their last event
+//
+// GET /deck/:uuid/events/stream?cursor=:seq
+func (d *Decks) Stream(w http.ResponseWriter, r *http.Request) {
+	if d.hub == nil {
+		writeError(w, r, errStreamNotSupported, nil)
+		return
+	}
+	deck, err := d.deckByUUID(w, r)
+	if err != nil {
+		return
+	}
+	after, err := streamCursor(r)
+	if err != nil {
+		writeError(w, r, err, deck)
+		return
+	}
+
+	// subscribe before reading the backlog to not miss the events in between
+	sub := d.hub.Subscribe(deck.UUID)
+	defer sub.Close()
+	var backlog []*models.DeckEvent
+	if after > 0 {
+		if backlog, err = d.backlog(deck.UUID, after); err != nil {
+			writeError(w, r, err, deck)
+			return
+		}
+	}
+
+	if websocket.IsWebSocketUpgrade(r) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			// upgrader replied the error
+			return
+		}
+		defer conn.Close()
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		go func() {
+			// reads the control messages, fails when the client disconnects
+			defer cancel()
+			for {
+				if _, _, err := conn.NextReader(); err != nil {
+					return
+				}
+			}
+		}()
+		pump(ctx, &webSocketSink{conn: conn}, sub, backlog, after)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, r, errStreamNotSupported, deck)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	pump(r.Context(), &sseSink{w: w, flusher: flusher}, sub, backlog, after)
+}
+
+// streamCursor returns the sequence of the last event received by the client
+// Cursor query parameter takes precedence over Last-Event-ID header
+func streamCursor(r *http.Request) (int, error) {
+	cursor, err := parseIntParam(r.URL.Query(), "cursor")
+	if err != nil {
+		return 0, err
+	}
+	if cursor != nil {
+		return *cursor, nil
+	}
+	id := r.Header.Get(lastEventIDHeader)
+	if id == "" {
+		return 0, nil
+	}
+	seq, err := strconv.Atoi(id)
+	if err != nil || seq < 0 {
+		return 0, models.ErrCursorInvalid
+	}
+	return seq, nil
+}
+
+// backlog returns all recorded events of the deck after the sequence
+func (d *Decks) backlog(uuid string, after int) ([]*models.DeckEvent, error) {
+	var events []*models.DeckEvent
+	for {
+		page, err := d.ds.Events(uuid, after, models.MaxListLimit)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, page.Events...)
+		if page.Next == 0 {
+			return events, nil
+		}
+		after = page.Next
+	}
+}
+
+// pump sends the backlog and the events of the subscription to the sink until either ends
+// Published events already sent by the backlog are skipped
+func pump(ctx context.Context, sink eventSink, sub *models.Subscription, backlog []*models.DeckEvent, after int) {
+	for _, event := range backlog {
+		if err := sink.send(event); err != nil {
+			return
+		}
+		after = event.Seq
+	}
+
+	ticker := time.NewTicker(streamPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := sink.ping(); err != nil {
+				return
+			}
+		case event, ok := <-sub.Events:
+			if !ok {
+				sink.end(sub.Err())
+				return
+			}
+			if event.Seq <= after {
+				continue
+			}
+			if err := sink.send(event); err != nil {
+				return
+			}
+			after = event.Seq
+		}
+	}
+}
+
+// sseSink writes the events as server-sent events
+// Event id is the sequence and event name is the type of the deck event
+type sseSink struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+func (s *sseSink) send(event *models.DeckEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return s.write("id: %d\nevent: %s\ndata: %s\n\n", event.Seq, event.Type, data)
+}
+
+func (s *sseSink) ping() error {
+	return s.write(": ping\n\n")
+}
+
+func (s *sseSink) end(err error) {
+	if err == nil {
+		return
+	}
+	_, body := errorResponse(err)
+	data, _ := json.Marshal(body)
+	s.write("event: error\ndata: %s\n\n", data)
+}
+
+func (s *sseSink) write(format string, args ...interface{}) error {
+	if _, err := fmt.Fprintf(s.w, format, args...); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+// webSocketSink writes the events as json text messages
+// Stream ended by the server is closed with the error code and message
+type webSocketSink struct {
+	conn *websocket.Conn
+}
+
+func (s *webSocketSink) send(event *models.DeckEvent) error {
+	s.conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+	return s.conn.WriteJSON(event)
+}
+
+func (s *webSocketSink) ping() error {
+	return s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(streamWriteTimeout))
+}
+
+func (s *webSocketSink) end(err error) {
+	code, reason := websocket.CloseNormalClosure, ""
+	switch err {
+	case models.ErrSubscriberLagged:
+		code, reason = websocket.CloseTryAgainLater, err.Error()
+	case models.ErrHubClosed:
+		code, reason = websocket.CloseGoingAway, err.Error()
+	}
+	msg := websocket.FormatCloseMessage(code, reason)
+	s.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(streamWriteTimeout))
+}
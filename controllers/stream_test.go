@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/mocak/tbupt/models"
+)
+
+func TestDecks_Stream(t *testing.T) {
+	hub := models.NewHub(0)
+	ds := models.NewDeckService(models.NewCardService(), models.WithHub(hub))
+	srv := httptest.NewServer(NewServer(NewDecks(ds, WithHub(hub))))
+	defer srv.Close()
+	do := func(method, target, body string) string {
+		r, _ := http.NewRequest(method, srv.URL+target, strings.NewReader(body))
+		resp, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatalf("%s %s err = %s, want nil", method, target, err)
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return string(b)
+	}
+	created := do("POST", "/deck", "{}")
+	deckID := strings.Split(strings.Split(created, `"DeckID":"`)[1], `"`)[0]
+	do("POST", "/deck/"+deckID+"/draw", `{"count":1}`)
+
+	resp, err := http.Get(srv.URL + "/deck/" + deckID + "/events/stream?cursor=1")
+	if err != nil {
+		t.Fatalf("GET stream err = %s, want nil", err)
+	}
+	defer resp.Body.Close()
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("Content-Type got = %v, want text/event-stream", got)
+	}
+	sse := bufio.NewReader(resp.Body)
+	next := func() string {
+		var lines []string
+		for {
+			line, err := sse.ReadString('\n')
+			if err != nil {
+				t.Fatalf("read stream err = %s, want nil", err)
+			}
+			if line == "\n" {
+				return strings.Join(lines, "")
+			}
+			lines = append(lines, line)
+		}
+	}
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/deck/"+deckID+"/events/stream", nil)
+	if err != nil {
+		t.Fatalf("Dial() err = %s, want nil", err)
+	}
+	defer ws.Close()
+
+	if got := next(); !strings.HasPrefix(got, "id: 2\nevent: drawn\ndata: {\"deck_id\":\""+deckID+"\",\"seq\":2,") {
+		t.Errorf("backlog event got = %q, want drawn event of seq 2", got)
+	}
+	do("POST", "/deck/"+deckID+"/shuffle", "{}")
+	if got := next(); !strings.HasPrefix(got, "id: 3\nevent: shuffled\n") {
+		t.Errorf("event got = %q, want shuffled event of seq 3", got)
+	}
+	var event models.DeckEvent
+	if err := ws.ReadJSON(&event); err != nil || event.Seq != 3 || event.Type != models.EventShuffled {
+		t.Errorf("ReadJSON() got = %+v, %v, want shuffled event of seq 3", event, err)
+	}
+
+	hub.Close()
+	if got := next(); got != "event: error\ndata: {\"code\":\"hub_closed\",\"message\":\"event hub is closed\"}\n" {
+		t.Errorf("closing event got = %q, want hub_closed error", got)
+	}
+	if _, err := sse.ReadString('\n'); err == nil {
+		t.Errorf("stream is not ended after hub is closed")
+	}
+	_, _, err = ws.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Errorf("ReadMessage() err = %v, want going away close error", err)
+	}
+}
+
+func TestDecks_Stream_Errors(t *testing.T) {
+	tests := []struct {
+		name       string
+		d          *Decks
+		header     string
+		wantStatus int
+	}{
+		{
+			name:       "not enabled",
+			d:          NewDecks(mockDeckService{deck: &models.Deck{UUID: "testuuid"}}),
+			wantStatus: http.StatusNotImplemented,
+		},
+		{
+			name:       "deck not found",
+			d:          NewDecks(mockDeckService{err: models.ErrNotFound}, WithHub(models.NewHub(0))),
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "malformed last event id",
+			d:          NewDecks(mockDeckService{deck: &models.Deck{UUID: "testuuid"}}, WithHub(models.NewHub(0))),
+			header:     "first",
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/deck/testuuid/events/stream", nil)
+			if tt.header != "" {
+				r.Header.Set(lastEventIDHeader, tt.header)
+			}
+			w := httptest.NewRecorder()
+			NewServer(tt.d).ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Errorf("Stream() status = %v, want %v", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/mocak/tbupt/json"
+	"github.com/mocak/tbupt/models"
+)
+
+var (
+	errWebhooksNotSupported = errors.New("webhooks are not enabled")
+)
+
+// WithWebhooks enables registering webhooks to be notified of the deck events
+// Webhooks are disabled by default
+func WithWebhooks(wh *models.Webhooks) DecksOption {
+	return func(d *Decks) {
+		d.webhooks = wh
+	}
+}
+
+// webhookRequest is the registration of a webhook
+type webhookRequest struct {
+	URL    string
+	Events []string
+}
+
+// webhooksResponse is the list of the registered webhooks
+type webhooksResponse struct {
+	Webhooks []*models.Webhook
+}
+
+// deadLettersResponse is the list of the undelivered notifications
+type deadLettersResponse struct {
+	DeadLetters []models.DeadLetter
+}
+
+// CreateWebhook is used to register a webhook of the deck, or a global webhook without deck
+// Global webhooks require the operator key
+// Replies the request with the webhook including its signing secret and HTTP 201 if succeed
+//
+// POST /deck/:uuid/webhooks
+// POST /webhooks
+func (d *Decks) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	deckID, ok := d.webhookScope(w, r)
+	if !ok {
+		return
+	}
+	req := webhookRequest{}
+	if err := json.DecodeBody(w, r, &req); err != nil {
+		return
+	}
+
+	hook := &models.Webhook{URL: req.URL, DeckID: deckID, Events: req.Events}
+	if err := d.webhooks.Register(hook); err != nil {
+		writeError(w, r, err, nil)
+		return
+	}
+	json.Response(w, r, hook, http.StatusCreated)
+}
+
+// Webhooks is used to list the webhooks of the deck, or the global webhooks without deck
+// Webhooks of the deck require the full role on the deck, global webhooks require the operator key
+// Replies the request with the webhooks without secrets and HTTP 200 if succeed
+//
+// GET /deck/:uuid/webhooks
+// GET /webhooks
+func (d *Decks) Webhooks(w http.ResponseWriter, r *http.Request) {
+	deckID, ok := d.webhookScope(w, r)
+	if !ok {
+		return
+	}
+	json.Response(w, r, webhooksResponse{Webhooks: d.webhooks.Webhooks(deckID)}, http.StatusOK)
+}
+
+// DeleteWebhook is used to unregister a webhook of the deck, or a global webhook without deck
+// Global webhooks require the operator key
+// Replies the request with HTTP 204 if succeed
+//
+// DELETE /deck/:uuid/webhooks/:id
+// DELETE /webhooks/:id
+func (d *Decks) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	deckID, ok := d.webhookScope(w, r)
+	if !ok {
+		return
+	}
+	if err := d.webhooks.Unregister(deckID, mux.Vars(r)["id"]); err != nil {
+		writeError(w, r, err, nil)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeadLetters is used to list the notifications failed on every delivery attempt, latest first
+// Requires the operator key, replies the request with the dead letters and HTTP 200 if succeed
+//
+// GET /webhooks/dead-letters
+func (d *Decks) DeadLetters(w http.ResponseWriter, r *http.Request) {
+	if d.webhooks == nil {
+		writeError(w, r, errWebhooksNotSupported, nil)
+		return
+	}
+	if !d.isOperator(r) {
+		writeError(w, r, errOperatorKeyInvalid, nil)
+		return
+	}
+	json.Response(w, r, deadLettersResponse{DeadLetters: d.webhooks.DeadLetters()}, http.StatusOK)
+}
+
+// webhookScope returns the deck id of the webhook request, empty for global webhooks
+// Writes the error response and returns false if webhooks are disabled, the deck does not exist,
+// the request does not have the full role on the deck or a global webhook request does not have the operator key
+// Webhooks of a deck are not visible to its viewers, their urls may carry the credentials of the receivers
+func (d *Decks) webhookScope(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if d.webhooks == nil {
+		writeError(w, r, errWebhooksNotSupported, nil)
+		return "", false
+	}
+	if mux.Vars(r)["uuid"] == "" {
+		if !d.isOperator(r) {
+			writeError(w, r, errOperatorKeyInvalid, nil)
+			return "", false
+		}
+		return "", true
+	}
+	deck, err := d.deckWithRole(w, r, models.RoleFull)
+	if err != nil {
+		return "", false
+	}
+	return deck.UUID, true
+}
@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mocak/tbupt/models"
+)
+
+func TestDecks_Webhooks(t *testing.T) {
+	wh := models.NewWebhooks()
+	defer wh.Close()
+	s := NewServer(NewDecks(models.NewDeckService(models.NewCardService()),
+		WithOperatorKey("secret"), WithWebhooks(wh)))
+	do := func(method, target, body, key string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		if key != "" {
+			r.Header.Set(operatorKeyHeader, key)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		return w
+	}
+	created := do("POST", "/deck", "{}", "")
+	deckID := strings.Split(strings.Split(created.Body.String(), `"DeckID":"`)[1], `"`)[0]
+
+	w := do("POST", "/deck/"+deckID+"/webhooks", `{"url":"https://example.com/hook","events":["deck.empty"]}`, "")
+	if w.Code != http.StatusCreated || !strings.Contains(w.Body.String(), `"secret":"`) {
+		t.Fatalf("CreateWebhook() got = %v %v, want 201 with secret", w.Code, w.Body.String())
+	}
+	hookID := strings.Split(strings.Split(w.Body.String(), `"id":"`)[1], `"`)[0]
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		key        string
+		wantStatus int
+	}{
+		{"list deck webhooks", "GET", "/deck/" + deckID + "/webhooks", "", "", http.StatusOK},
+		{"invalid url", "POST", "/deck/" + deckID + "/webhooks", `{"url":"hook"}`, "", http.StatusUnprocessableEntity},
+		{"private url", "POST", "/deck/" + deckID + "/webhooks", `{"url":"http://169.254.169.254/"}`, "", http.StatusUnprocessableEntity},
+		{"unknown event", "POST", "/deck/" + deckID + "/webhooks", `{"url":"https://example.com","events":["lost"]}`, "", http.StatusUnprocessableEntity},
+		{"unknown deck", "POST", "/deck/00000000-0000-0000-0000-000000000000/webhooks", `{"url":"https://example.com"}`, "", http.StatusNotFound},
+		{"global without operator key", "POST", "/webhooks", `{"url":"https://example.com"}`, "", http.StatusForbidden},
+		{"global", "POST", "/webhooks", `{"url":"https://example.com"}`, "secret", http.StatusCreated},
+		{"list global without operator key", "GET", "/webhooks", "", "", http.StatusForbidden},
+		{"list global", "GET", "/webhooks", "", "secret", http.StatusOK},
+		{"delete deck webhook as global", "DELETE", "/webhooks/" + hookID, "", "secret", http.StatusNotFound},
+		{"delete", "DELETE", "/deck/" + deckID + "/webhooks/" + hookID, "", "", http.StatusNoContent},
+		{"delete again", "DELETE", "/deck/" + deckID + "/webhooks/" + hookID, "", "", http.StatusNotFound},
+		{"dead letters without operator key", "GET", "/webhooks/dead-letters", "", "", http.StatusForbidden},
+		{"dead letters", "GET", "/webhooks/dead-letters", "", "secret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := do(tt.method, tt.target, tt.body, tt.key); w.Code != tt.wantStatus {
+				t.Errorf("%s %s status = %v, want %v", tt.method, tt.target, w.Code, tt.wantStatus)
+			}
+		})
+	}
+
+	if w := do("GET", "/deck/"+deckID+"/webhooks", "", ""); w.Body.String() != `{"Webhooks":[]}` {
+		t.Errorf("Webhooks() got = %v, want none", w.Body.String())
+	}
+}
+
+func TestDecks_Webhooks_NotEnabled(t *testing.T) {
+	s := NewServer(NewDecks(mockDeckService{deck: &models.Deck{UUID: "testuuid"}}))
+	for _, target := range []string{"/webhooks", "/deck/testuuid/webhooks", "/webhooks/dead-letters"} {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+		if w.Code != http.StatusNotImplemented {
+			t.Errorf("GET %s status = %v, want %v", target, w.Code, http.StatusNotImplemented)
+		}
+	}
+}
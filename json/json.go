@@ -6,15 +6,29 @@ import (
 	"net/http"
 )
 
+// Codes of the errors reported by the json package
+const (
+	CodeInternal    = "internal_error"
+	CodeBodyInvalid = "body_invalid"
+)
+
+// ErrorBody is the structured error response body
+// Code is stable and machine-readable, Field names the offending request field if any
+type ErrorBody struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Field   string `json:"field,omitempty"`
+}
+
 // Response prepares json response
-// Sets content type and response body
-func Response(w http.ResponseWriter, v interface{}, code int) {
-	w.Header().Set("Content-Type", "application/json")
+// Sets content type and response body, the error of a failed marshal is negotiated like WriteError
+func Response(w http.ResponseWriter, r *http.Request, v interface{}, code int) {
 	bytes, err := json.Marshal(v)
 	if err != nil {
-		Error(w, "Unexpected Error", http.StatusInternalServerError)
+		WriteError(w, r, ErrorBody{Code: CodeInternal, Message: "Unexpected Error"}, http.StatusInternalServerError, nil)
 		return
 	}
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(code)
 	w.Write(bytes)
 }
@@ -29,7 +43,7 @@ func DecodeBody(w http.ResponseWriter, r *http.Request, v interface{}) error {
 		case io.EOF:
 			return nil
 		default:
-			Error(w, err.Error(), http.StatusBadRequest)
+			WriteError(w, r, ErrorBody{Code: CodeBodyInvalid, Message: err.Error()}, http.StatusBadRequest, nil)
 			return err
 		}
 	}
@@ -37,6 +51,7 @@ func DecodeBody(w http.ResponseWriter, r *http.Request, v interface{}) error {
 }
 
 // Error prepares json error response
+// WriteError should be preferred to reply the errors of a request
 func Error(w http.ResponseWriter, err interface{}, code int) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(code)
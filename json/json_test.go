@@ -18,8 +18,12 @@ func TestResponse(t *testing.T) {
 	valid := TestType{Test: "test"}
 	validJson, _ := json.Marshal(&valid)
 
+	problem := httptest.NewRequest("GET", "/", nil)
+	problem.Header.Set("Accept", ProblemContentType)
+
 	type args struct {
 		w *httptest.ResponseRecorder
+		r *http.Request
 		v interface{}
 		s int
 	}
@@ -32,22 +36,30 @@ func TestResponse(t *testing.T) {
 	}{
 		{
 			name:       "valid",
-			args:       args{httptest.NewRecorder(), &valid, http.StatusCreated},
+			args:       args{httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil), &valid, http.StatusCreated},
 			want:       string(validJson),
 			wantCT:     "application/json",
 			wantStatus: http.StatusCreated,
 		},
 		{
 			name:       "invalid type",
-			args:       args{httptest.NewRecorder(), func() {}, http.StatusOK},
-			want:       "\"Unexpected Error\"",
+			args:       args{httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil), func() {}, http.StatusOK},
+			want:       "{\"code\":\"internal_error\",\"message\":\"Unexpected Error\"}",
 			wantCT:     "application/json",
 			wantStatus: http.StatusInternalServerError,
 		},
+		{
+			name: "invalid type problem",
+			args: args{httptest.NewRecorder(), problem, func() {}, http.StatusOK},
+			want: "{\"code\":\"internal_error\",\"detail\":\"Unexpected Error\",\"instance\":\"/\",\"status\":500," +
+				"\"title\":\"Internal Server Error\",\"type\":\"urn:tbupt:problem:internal_error\"}",
+			wantCT:     ProblemContentType,
+			wantStatus: http.StatusInternalServerError,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			Response(tt.args.w, tt.args.v, tt.args.s)
+			Response(tt.args.w, tt.args.r, tt.args.v, tt.args.s)
 			resp := tt.args.w.Result()
 			byteSlice, _ := io.ReadAll(resp.Body)
 			got := strings.TrimSuffix(string(byteSlice), "\n")
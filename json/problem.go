@@ -0,0 +1,89 @@
+package json
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// ProblemContentType is the media type of the RFC 7807 problem details
+const ProblemContentType = "application/problem+json"
+
+// problemTypePrefix prefixes the error code to build the problem type URI
+const problemTypePrefix = "urn:tbupt:problem:"
+
+// Problem is the RFC 7807 problem details of an error response
+// Extensions are encoded as top level members next to the standard ones
+type Problem struct {
+	Type       string
+	Title      string
+	Status     int
+	Detail     string
+	Instance   string
+	Extensions map[string]interface{}
+}
+
+// MarshalJSON encodes the problem with its extension members
+// Extensions cannot override the standard members
+func (p Problem) MarshalJSON() ([]byte, error) {
+	m := make(map[string]interface{}, len(p.Extensions)+5)
+	for k, v := range p.Extensions {
+		m[k] = v
+	}
+	m["type"] = p.Type
+	m["title"] = p.Title
+	m["status"] = p.Status
+	if p.Detail != "" {
+		m["detail"] = p.Detail
+	}
+	if p.Instance != "" {
+		m["instance"] = p.Instance
+	}
+	return json.Marshal(m)
+}
+
+// NewProblem returns the problem details of the error body
+// Code and field of the body are kept as extension members
+func NewProblem(r *http.Request, body ErrorBody, status int, ext map[string]interface{}) Problem {
+	p := Problem{
+		Type:       problemTypePrefix + body.Code,
+		Title:      http.StatusText(status),
+		Status:     status,
+		Detail:     body.Message,
+		Instance:   r.URL.Path,
+		Extensions: map[string]interface{}{"code": body.Code},
+	}
+	if body.Field != "" {
+		p.Extensions["field"] = body.Field
+	}
+	for k, v := range ext {
+		p.Extensions[k] = v
+	}
+	return p
+}
+
+// WriteError replies the request with the error in the format negotiated by the Accept header
+// Clients accepting application/problem+json get the problem details with the given extension members,
+// others get the ErrorBody
+func WriteError(w http.ResponseWriter, r *http.Request, body ErrorBody, status int, ext map[string]interface{}) {
+	if !acceptsProblem(r) {
+		Error(w, body, status)
+		return
+	}
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(NewProblem(r, body, status, ext))
+}
+
+// acceptsProblem reports whether the request explicitly accepts problem details
+// Quality values are not weighted, a listed problem+json wins over plain json
+func acceptsProblem(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err == nil && mediaType == ProblemContentType {
+			return true
+		}
+	}
+	return false
+}
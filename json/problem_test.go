@@ -0,0 +1,56 @@
+package json
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWriteError(t *testing.T) {
+	body := ErrorBody{Code: "deck_opened", Message: "not permitted on opened deck"}
+	problem := `{"code":"deck_opened","deck_id":"id","detail":"not permitted on opened deck",` +
+		`"instance":"/deck/id/draw","status":409,"title":"Conflict","type":"urn:tbupt:problem:deck_opened"}`
+	legacy := `{"code":"deck_opened","message":"not permitted on opened deck"}`
+	tests := []struct {
+		name   string
+		accept string
+		want   string
+		wantCT string
+	}{
+		{name: "no accept", want: legacy, wantCT: "application/json"},
+		{name: "any", accept: "*/*", want: legacy, wantCT: "application/json"},
+		{name: "problem", accept: "application/problem+json", want: problem, wantCT: ProblemContentType},
+		{name: "both", accept: "application/json;q=0.9, application/problem+json", want: problem, wantCT: ProblemContentType},
+		{name: "plain json", accept: "application/json", want: legacy, wantCT: "application/json"},
+		{name: "plain json with params", accept: "text/html, application/json; charset=utf-8", want: legacy, wantCT: "application/json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("POST", "/deck/id/draw", nil)
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			WriteError(w, r, body, http.StatusConflict, map[string]interface{}{"deck_id": "id"})
+			if got := strings.TrimSuffix(w.Body.String(), "\n"); got != tt.want || w.Code != http.StatusConflict {
+				t.Errorf("WriteError() = %v %v, want %v %v", w.Code, got, http.StatusConflict, tt.want)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != tt.wantCT {
+				t.Errorf("WriteError() content type = %v, want %v", ct, tt.wantCT)
+			}
+		})
+	}
+}
+
+func TestProblem_MarshalJSON(t *testing.T) {
+	p := Problem{Type: "about:blank", Title: "Not Found", Status: 404, Extensions: map[string]interface{}{"status": 200, "remaining": 0}}
+	got, err := p.MarshalJSON()
+	if err != nil {
+		t.Fatalf("MarshalJSON() err = %s, want nil", err)
+	}
+	want := `{"remaining":0,"status":404,"title":"Not Found","type":"about:blank"}`
+	if string(got) != want {
+		t.Errorf("MarshalJSON() got = %v, want %v", string(got), want)
+	}
+}
@@ -1,16 +1,181 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
 	"github.com/mocak/tbupt/controllers"
 	"github.com/mocak/tbupt/models"
-	"net/http"
+
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
 )
 
 func main() {
+	storage := flag.String("storage", "memory", "deck storage: memory, sqlite3 or postgres")
+	dsn := flag.String("dsn", "file:tbupt.db?_foreign_keys=on&_busy_timeout=5000", "data source name of the sql storage")
+	shuffler := flag.String("shuffler", models.ShufflerMath, "default shuffler: math, crypto or fair")
+	ttl := flag.Duration("ttl", 0, "default ttl of the created decks, decks do not expire if zero")
+	janitorInterval := flag.Duration("janitor-interval", time.Minute, "interval of evicting expired decks")
+	undoDepth := flag.Int("undo-depth", models.DefaultUndoDepth, "number of the operations can be undone in a row, undo is disabled if zero")
+	idempotencyWindow := flag.Duration("idempotency-window", 24*time.Hour, "duration of replaying the responses of the idempotency keys")
+	streamBuffer := flag.Int("stream-buffer", models.DefaultHubBuffer, "number of the events buffered per stream, slower streams are disconnected")
+	webhookAttempts := flag.Int("webhook-attempts", models.DefaultWebhookAttempts, "number of the delivery attempts of the webhook notifications")
+	webhookBackoff := flag.Duration("webhook-backoff", models.DefaultWebhookBackoff, "delay before the first retry of the webhook notifications, doubles after every retry")
+	webhookPrivate := flag.Bool("webhook-private", false, "allows the webhooks of loopback, link-local and private addresses")
+	issueToken := flag.String("issue-token", "", "prints a bearer token of the principal signed by the token secret and exits")
+	tokenTTL := flag.Duration("token-ttl", 24*time.Hour, "validity duration of the issued bearer tokens")
+	flag.Parse()
+
+	// secrets are not taken as flags, command line of the process is visible to the other users and in the metrics
+	operatorKey, err := secretOf("TBUPT_OPERATOR_KEY")
+	if err != nil {
+		log.Fatal(err)
+	}
+	apiKeys, err := secretOf("TBUPT_API_KEYS")
+	if err != nil {
+		log.Fatal(err)
+	}
+	tokenSecret, err := secretOf("TBUPT_TOKEN_SECRET")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var serverOpts []controllers.ServerOption
+	if apiKeys != "" || tokenSecret != "" {
+		keys, err := parseAPIKeys(apiKeys)
+		if err != nil {
+			log.Fatal(err)
+		}
+		auth := controllers.NewAuthenticator(keys, []byte(tokenSecret))
+		if *issueToken != "" {
+			token, err := auth.IssueToken(*issueToken, time.Now().Add(*tokenTTL))
+			if err != nil {
+				log.Fatal(err)
+			}
+			fmt.Println(token)
+			return
+		}
+		serverOpts = append(serverOpts, controllers.WithAuth(auth))
+	} else if *issueToken != "" {
+		log.Fatal("token secret is required to issue tokens")
+	}
+
+	deckStorage := models.NewDeckMemory()
+	if *storage != "memory" {
+		var err error
+		deckStorage, err = openDeckSQL(models.Dialect(*storage), *dsn)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if expirer, ok := deckStorage.(models.DeckExpirer); ok {
+		janitor := models.StartJanitor(expirer, *janitorInterval)
+		defer janitor.Stop()
+	}
+
+	hub := models.NewHub(*streamBuffer)
+	webhookOpts := []models.WebhooksOption{models.WithWebhookRetries(*webhookAttempts, *webhookBackoff)}
+	if *webhookPrivate {
+		webhookOpts = append(webhookOpts, models.WithPrivateWebhookTargets())
+	}
+	webhooks := models.NewWebhooks(webhookOpts...)
+	defer webhooks.Close()
+
 	cardService := models.NewCardService()
-	deckService := models.NewDeckService(cardService)
-	deckController := controllers.NewDecks(deckService)
-	r := controllers.NewServer(deckController)
+	deckService := models.NewDeckService(cardService,
+		models.WithDeckStorage(deckStorage),
+		models.WithShuffler(*shuffler),
+		models.WithDeckTTL(*ttl),
+		models.WithUndoDepth(*undoDepth),
+		models.WithHub(hub),
+		models.WithWebhooks(webhooks),
+	)
+	keys, ok := deckStorage.(models.IdempotencyStore)
+	if !ok {
+		keys = models.NewIdempotencyMemory()
+	}
+	deckController := controllers.NewDecks(deckService,
+		controllers.WithOperatorKey(operatorKey),
+		controllers.WithIdempotency(keys, *idempotencyWindow),
+		controllers.WithHub(hub),
+		controllers.WithWebhooks(webhooks),
+	)
+
+	srv := &http.Server{Addr: ":3000", Handler: controllers.NewServer(deckController, serverOpts...)}
+	// streams are ended on shutdown, otherwise they keep the server running until the timeout
+	srv.RegisterOnShutdown(hub.Close)
+
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	<-stop
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Print(err)
+	}
+}
+
+// openDeckSQL connects to the database and returns sql deck storage
+func openDeckSQL(dialect models.Dialect, dsn string) (models.DeckStorage, error) {
+	db, err := sql.Open(string(dialect), dsn)
+	if err != nil {
+		return nil, err
+	}
+	if dialect == models.DialectSQLite {
+		// sqlite allows a single writer at a time
+		db.SetMaxOpenConns(1)
+	}
+	if err := db.Ping(); err != nil {
+		return nil, err
+	}
+	return models.NewDeckSQL(db, dialect)
+}
+
+// secretOf returns the secret of the environment variable,
+// or the content of the file named by the variable with _FILE suffix without the trailing newline
+func secretOf(name string) (string, error) {
+	path := os.Getenv(name + "_FILE")
+	if path == "" {
+		return os.Getenv(name), nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("%s_FILE: %w", name, err)
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
 
-	http.ListenAndServe(":3000", r)
+// parseAPIKeys returns the api keys mapped to their principals from comma separated principal=key pairs
+func parseAPIKeys(s string) (map[string]string, error) {
+	keys := make(map[string]string)
+	if s == "" {
+		return keys, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		i := strings.Index(pair, "=")
+		if i <= 0 || i == len(pair)-1 {
+			return nil, fmt.Errorf("api key %q must be a principal=key pair", pair)
+		}
+		keys[pair[i+1:]] = pair[:i]
+	}
+	return keys, nil
 }
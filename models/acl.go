@@ -0,0 +1,185 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrRoleInvalid   = errors.New("role must be view, draw or full")
+	ErrShareNotFound = errors.New("share not found")
+	ErrShareLimit    = errors.New("deck has too many shares")
+)
+
+// Roles of the principals and share tokens on a deck, every role allows the operations of the previous ones
+// RoleView reads the deck, RoleDraw draws its cards and RoleFull changes it in any way
+const (
+	RoleView = "view"
+	RoleDraw = "draw"
+	RoleFull = "full"
+)
+
+// MaxShares is the number of the share tokens can be minted on a deck
+const MaxShares = 50
+
+// roleRanks orders the roles by the operations they allow
+var roleRanks = map[string]int{RoleView: 1, RoleDraw: 2, RoleFull: 3}
+
+// Share is a revocable token giving its role on the deck to anyone holding it
+// Only the hash of the token is stored, Token is set only when the share is minted
+type Share struct {
+	ID        string    `json:"id"`
+	Role      string    `json:"role"`
+	TokenHash string    `json:"token_hash"`
+	CreatedAt time.Time `json:"created_at"`
+	Token     string    `json:"-"`
+}
+
+// RoleAllows reports whether the role allows the operations of the required role
+func RoleAllows(role, required string) bool {
+	return roleRanks[role] > 0 && roleRanks[role] >= roleRanks[required]
+}
+
+// SetACL replaces the roles of the principals on the deck
+// Returns ErrPrincipalInvalid if a principal is invalid or there are too many
+// Returns ErrRoleInvalid if a role is unknown
+func (ds *deckService) SetACL(deck *Deck, acl map[string]string) error {
+	if err := checkACL(acl); err != nil {
+		return err
+	}
+	return ds.modify(deck, &DeckEvent{Type: EventACLChanged}, func(deck *Deck) ([]*Card, error) {
+		deck.ACL = copyACL(acl)
+		return nil, nil
+	})
+}
+
+// Share mints a share token of the role on the deck
+// Returned share carries the token, it can not be retrieved later
+// Returns ErrRoleInvalid if role is unknown
+// Returns ErrShareLimit if deck has MaxShares shares
+func (ds *deckService) Share(deck *Deck, role string) (*Share, error) {
+	if roleRanks[role] == 0 {
+		return nil, ErrRoleInvalid
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	token := hex.EncodeToString(b)
+	share := Share{
+		ID:        uuid.NewString(),
+		Role:      role,
+		TokenHash: shareKey(token),
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+	}
+	err := ds.modify(deck, &DeckEvent{Type: EventShared}, func(deck *Deck) ([]*Card, error) {
+		if len(deck.Shares) >= MaxShares {
+			return nil, ErrShareLimit
+		}
+		stored := share
+		deck.Shares = append(deck.Shares, &stored)
+		return nil, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	share.Token = token
+	return &share, nil
+}
+
+// Unshare revokes the share of the given id, its token is rejected afterwards
+// Returns ErrShareNotFound if deck has no such share
+func (ds *deckService) Unshare(deck *Deck, id string) error {
+	return ds.modify(deck, &DeckEvent{Type: EventUnshared}, func(deck *Deck) ([]*Card, error) {
+		for i, share := range deck.Shares {
+			if share.ID == id {
+				deck.Shares = append(deck.Shares[:i:i], deck.Shares[i+1:]...)
+				return nil, nil
+			}
+		}
+		return nil, ErrShareNotFound
+	})
+}
+
+// RoleOf returns the role of the principal on the deck
+// Owner and granted principals have RoleFull, decks without ACL can be viewed by anyone
+// Returns empty string if principal has no role
+func (d *Deck) RoleOf(principal string) string {
+	if d.MutableBy(principal) {
+		return RoleFull
+	}
+	if role, ok := d.ACL[principal]; ok {
+		return role
+	}
+	if len(d.ACL) == 0 {
+		return RoleView
+	}
+	return ""
+}
+
+// ShareOf returns the share of the token, nil if token is not a share of the deck
+// Every share is compared in constant time to not leak the valid tokens
+func (d *Deck) ShareOf(token string) *Share {
+	key := []byte(shareKey(token))
+	var found *Share
+	for _, share := range d.Shares {
+		if subtle.ConstantTimeCompare(key, []byte(share.TokenHash)) == 1 {
+			found = share
+		}
+	}
+	return found
+}
+
+// shareKey returns the stored hash of the share token
+func shareKey(token string) string {
+	return PlayerKey(token)
+}
+
+func (dv *deckValidator) checkACL(deck *Deck) error {
+	return checkACL(deck.ACL)
+}
+
+func checkACL(acl map[string]string) error {
+	if len(acl) > MaxGrants {
+		return ErrPrincipalInvalid
+	}
+	for principal, role := range acl {
+		if principal == "" || len(principal) > 255 {
+			return ErrPrincipalInvalid
+		}
+		if roleRanks[role] == 0 {
+			return ErrRoleInvalid
+		}
+	}
+	return nil
+}
+
+// copyACL returns the copy of the acl, nil if empty
+func copyACL(acl map[string]string) map[string]string {
+	if len(acl) == 0 {
+		return nil
+	}
+	c := make(map[string]string, len(acl))
+	for principal, role := range acl {
+		c[principal] = role
+	}
+	return c
+}
+
+// copyShares returns the deep copy of the shares
+func copyShares(shares []*Share) []*Share {
+	if shares == nil {
+		return nil
+	}
+	c := make([]*Share, len(shares))
+	for i, share := range shares {
+		s := *share
+		c[i] = &s
+	}
+	return c
+}
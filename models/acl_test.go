@@ -0,0 +1,116 @@
+package models
+
+import "testing"
+
+func TestRoleAllows(t *testing.T) {
+	tests := []struct {
+		role     string
+		required string
+		want     bool
+	}{
+		{RoleView, RoleView, true},
+		{RoleView, RoleDraw, false},
+		{RoleDraw, RoleDraw, true},
+		{RoleDraw, RoleFull, false},
+		{RoleFull, RoleDraw, true},
+		{"", RoleView, false},
+		{"admin", RoleView, false},
+	}
+	for _, tt := range tests {
+		if got := RoleAllows(tt.role, tt.required); got != tt.want {
+			t.Errorf("RoleAllows(%q, %q) got = %v, want %v", tt.role, tt.required, got, tt.want)
+		}
+	}
+}
+
+func TestDeck_RoleOf(t *testing.T) {
+	tests := []struct {
+		name      string
+		deck      Deck
+		principal string
+		want      string
+	}{
+		{"owner", Deck{Principal: "alice", ACL: map[string]string{"bob": RoleView}}, "alice", RoleFull},
+		{"granted", Deck{Principal: "alice", Grants: []string{"bob"}}, "bob", RoleFull},
+		{"acl", Deck{Principal: "alice", ACL: map[string]string{"bob": RoleDraw}}, "bob", RoleDraw},
+		{"other without acl", Deck{Principal: "alice"}, "bob", RoleView},
+		{"other with acl", Deck{Principal: "alice", ACL: map[string]string{"bob": RoleDraw}}, "carol", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.deck.RoleOf(tt.principal); got != tt.want {
+				t.Errorf("RoleOf() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_deckService_Share(t *testing.T) {
+	ds := NewDeckService(NewCardService())
+	deck := &Deck{}
+	if err := ds.Create(deck); err != nil {
+		t.Fatalf("Create() err = %s, want nil", err)
+	}
+
+	if _, err := ds.Share(deck, "admin"); err != ErrRoleInvalid {
+		t.Errorf("Share() of unknown role err = %v, want %v", err, ErrRoleInvalid)
+	}
+	share, err := ds.Share(deck, RoleDraw)
+	if err != nil {
+		t.Fatalf("Share() err = %s, want nil", err)
+	}
+	if share.Token == "" || deck.Shares[0].Token != "" || deck.Shares[0].TokenHash == share.Token {
+		t.Errorf("Share() got token %q stored as %+v, want only its hash stored", share.Token, deck.Shares[0])
+	}
+
+	stored, err := ds.ByUUID(deck.UUID)
+	if err != nil {
+		t.Fatalf("ByUUID() err = %s, want nil", err)
+	}
+	if got := stored.ShareOf(share.Token); got == nil || got.Role != RoleDraw {
+		t.Errorf("ShareOf() got = %+v, want share of %v role", got, RoleDraw)
+	}
+	if got := stored.ShareOf("forged"); got != nil {
+		t.Errorf("ShareOf() of forged token got = %+v, want nil", got)
+	}
+
+	if err := ds.Unshare(deck, share.ID); err != nil {
+		t.Fatalf("Unshare() err = %s, want nil", err)
+	}
+	if got := deck.ShareOf(share.Token); got != nil {
+		t.Errorf("ShareOf() of revoked token got = %+v, want nil", got)
+	}
+	if err := ds.Unshare(deck, share.ID); err != ErrShareNotFound {
+		t.Errorf("Unshare() again err = %v, want %v", err, ErrShareNotFound)
+	}
+}
+
+func Test_deckService_SetACL(t *testing.T) {
+	ds := NewDeckService(NewCardService())
+	deck := &Deck{Principal: "alice"}
+	if err := ds.Create(deck); err != nil {
+		t.Fatalf("Create() err = %s, want nil", err)
+	}
+
+	tests := []struct {
+		name    string
+		acl     map[string]string
+		wantErr error
+	}{
+		{"roles", map[string]string{"bob": RoleView, "carol": RoleDraw}, nil},
+		{"clear", nil, nil},
+		{"unknown role", map[string]string{"bob": "admin"}, ErrRoleInvalid},
+		{"empty principal", map[string]string{"": RoleView}, ErrPrincipalInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ds.SetACL(deck, tt.acl)
+			if err != tt.wantErr {
+				t.Fatalf("SetACL() err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && len(deck.ACL) != len(tt.acl) {
+				t.Errorf("SetACL() got acl = %v, want %v", deck.ACL, tt.acl)
+			}
+		})
+	}
+}
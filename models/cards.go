@@ -7,8 +7,11 @@ import (
 )
 
 var (
-	ErrCardCodeValueInvalid = errors.New("card code value is invalid")
-	ErrCardCodeSuitInvalid  = errors.New("card code suit is invalid")
+	ErrCardCodeValueInvalid     = errors.New("card code value is invalid")
+	ErrCardCodeSuitInvalid      = errors.New("card code suit is invalid")
+	ErrCompositionUnknown       = errors.New("deck composition is unknown")
+	ErrCompositionJokersInvalid = errors.New("deck composition jokers must be between 0 and 2")
+	ErrCompositionRuleInvalid   = errors.New("deck composition rule is invalid")
 )
 
 type Suit string
@@ -19,10 +22,15 @@ const (
 	SuitHearts   = Suit("HEARTS")
 	SuitSpades   = Suit("SPADES")
 
+	// SuitBlack and SuitRed are the colors of jokers
+	SuitBlack = Suit("BLACK")
+	SuitRed   = Suit("RED")
+
 	ValueAce   = Value("ACE")
 	ValueJack  = Value("JACK")
 	ValueQueen = Value("QUEEN")
 	ValueKing  = Value("KING")
+	ValueJoker = Value("JOKER")
 )
 
 var suitsCodeMap = map[rune]Suit{
@@ -32,11 +40,22 @@ var suitsCodeMap = map[rune]Suit{
 	'S': SuitSpades,
 }
 
+var jokerSuitsCodeMap = map[rune]Suit{
+	'B': SuitBlack,
+	'R': SuitRed,
+}
+
 var alphaValuesCodeMap = map[rune]Value{
 	'A': ValueAce,
 	'J': ValueJack,
 	'Q': ValueQueen,
 	'K': ValueKing,
+	'X': ValueJoker,
+}
+
+var jokerSuits = []Suit{
+	SuitBlack,
+	SuitRed,
 }
 
 var suits = []Suit{
@@ -70,8 +89,11 @@ func (s Suit) Code() string {
 type Value string
 
 // Code returns first character of value if value is not numeric
-// returns value if numeric
+// returns value if numeric, returns X for jokers
 func (v Value) Code() string {
+	if v == ValueJoker {
+		return "X"
+	}
 	if _, err := strconv.Atoi(string(v)); err != nil {
 		return string([]rune(v)[0])
 	}
@@ -105,6 +127,48 @@ type CardStorage interface {
 type CardService interface {
 	CardStorage
 	ByCodesStr(codesStr string) ([]*Card, error)
+	ByComposition(c *Composition) ([]*Card, error)
+}
+
+// Composition describes the cards a deck is made of
+// Cards of the named composition are taken first, then the cards
+// matching Exclude rules are removed, Include cards and jokers are appended
+//
+// Exclude rules are card codes (AS), value wildcards (2*) or suit wildcards (*H)
+type Composition struct {
+	Name    string   `json:"name,omitempty"`
+	Jokers  int      `json:"jokers,omitempty"`
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+const (
+	CompositionStandard = "standard"
+	CompositionPiquet   = "piquet"
+	CompositionEuchre   = "euchre"
+	CompositionPinochle = "pinochle"
+)
+
+type compositionDef struct {
+	values []Value
+	copies int
+}
+
+var compositions = map[string]compositionDef{
+	CompositionStandard: {values: values, copies: 1},
+	CompositionPiquet:   {values: []Value{ValueAce, "7", "8", "9", "10", ValueJack, ValueQueen, ValueKing}, copies: 1},
+	CompositionEuchre:   {values: []Value{ValueAce, "9", "10", ValueJack, ValueQueen, ValueKing}, copies: 1},
+	CompositionPinochle: {values: []Value{ValueAce, "9", "10", ValueJack, ValueQueen, ValueKing}, copies: 2},
+}
+
+// has reports whether composition contains cards of the given value
+func (cd compositionDef) has(value Value) bool {
+	for _, v := range cd.values {
+		if v == value {
+			return true
+		}
+	}
+	return false
 }
 
 // NewCardService returns new CardService instance
@@ -138,6 +202,105 @@ func (cs *cardService) ByCodes(codes []string) ([]*Card, error) {
 	return cards, nil
 }
 
+// ByComposition is used to get cards of the given composition
+// Empty composition name means the standard composition
+// Returns ErrCompositionUnknown if composition name is unknown
+// Returns ErrCompositionJokersInvalid if jokers count is not between 0 and 2
+// Returns ErrCompositionRuleInvalid if an exclude rule is not valid
+// Returns ErrCardCodeValueInvalid if an include code is empty
+// Returns error from storage if an include code is not valid
+func (cs *cardService) ByComposition(c *Composition) ([]*Card, error) {
+	name := c.Name
+	if name == "" {
+		name = CompositionStandard
+	}
+	def, ok := compositions[name]
+	if !ok {
+		return nil, ErrCompositionUnknown
+	}
+	if c.Jokers < 0 || c.Jokers > len(jokerSuits) {
+		return nil, ErrCompositionJokersInvalid
+	}
+
+	excludes := make([]string, len(c.Exclude))
+	for i, rule := range c.Exclude {
+		rule = strings.ToUpper(strings.TrimSpace(rule))
+		if err := cs.checkRule(rule); err != nil {
+			return nil, err
+		}
+		excludes[i] = rule
+	}
+
+	all, err := cs.CardStorage.All()
+	if err != nil {
+		return nil, err
+	}
+
+	var cards []*Card
+	for i := 0; i < def.copies; i++ {
+		for _, card := range all {
+			if def.has(card.Value) && !matchesAnyRule(card, excludes) {
+				cards = append(cards, card)
+			}
+		}
+	}
+
+	for _, code := range c.Include {
+		if strings.TrimSpace(code) == "" {
+			return nil, ErrCardCodeValueInvalid
+		}
+	}
+	included, err := cs.ByCodes(c.Include)
+	if err != nil {
+		return nil, err
+	}
+	cards = append(cards, included...)
+
+	for _, suit := range jokerSuits[:c.Jokers] {
+		cards = append(cards, NewCard(ValueJoker, suit))
+	}
+	return cards, nil
+}
+
+// checkRule validates the normalized exclude rule
+func (cs *cardService) checkRule(rule string) error {
+	switch {
+	case len(rule) < 2:
+		return ErrCompositionRuleInvalid
+	case strings.HasPrefix(rule, "*"):
+		for _, suit := range suits {
+			if suit.Code() == rule[1:] {
+				return nil
+			}
+		}
+		return ErrCompositionRuleInvalid
+	case strings.HasSuffix(rule, "*"):
+		for _, value := range values {
+			if value.Code() == rule[:len(rule)-1] {
+				return nil
+			}
+		}
+		return ErrCompositionRuleInvalid
+	}
+	if _, err := cs.CardStorage.ByCode(rule); err != nil {
+		return ErrCompositionRuleInvalid
+	}
+	return nil
+}
+
+// matchesAnyRule reports whether card matches one of the normalized rules
+func matchesAnyRule(card *Card, rules []string) bool {
+	for _, rule := range rules {
+		switch {
+		case rule == card.Code,
+			rule == "*"+card.Suit.Code(),
+			rule == card.Value.Code()+"*":
+			return true
+		}
+	}
+	return false
+}
+
 type cardValFunc func(card *Card) error
 
 func runCardValFuncs(card *Card, fns ...cardValFunc) error {
@@ -177,7 +340,11 @@ func (cv *cardValidator) checkCodeValue(card *Card) error {
 func (cv *cardValidator) checkCodeSuit(card *Card) error {
 	if card.Code != "" {
 		r := []rune(card.Code)
-		if _, ok := suitsCodeMap[r[len(r)-1]]; !ok {
+		suitsMap := suitsCodeMap
+		if r[0] == 'X' {
+			suitsMap = jokerSuitsCodeMap
+		}
+		if _, ok := suitsMap[r[len(r)-1]]; !ok {
 			return ErrCardCodeSuitInvalid
 		}
 	}
@@ -205,11 +372,14 @@ type staticCardStorage struct{}
 // ByCode is used to get Card by code
 func (scs *staticCardStorage) ByCode(code string) (*Card, error) {
 	r := []rune(code)
-	suit := suitsCodeMap[r[len(r)-1]]
 	value, ok := alphaValuesCodeMap[r[0]]
 	if !ok {
 		value = Value(r[:len(r)-1])
 	}
+	suit := suitsCodeMap[r[len(r)-1]]
+	if value == ValueJoker {
+		suit = jokerSuitsCodeMap[r[len(r)-1]]
+	}
 
 	return NewCard(value, suit), nil
 }
@@ -100,6 +100,11 @@ func TestValue_Code(t *testing.T) {
 			v:    Value("10"),
 			want: "10",
 		},
+		{
+			name: "joker",
+			v:    ValueJoker,
+			want: "X",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -197,6 +202,42 @@ func Test_cardService_ByCodes(t *testing.T) {
 			want:    nil,
 			wantErr: true,
 		},
+		{
+			name: "valid jokers",
+			fields: fields{
+				CardStorage: &cs,
+			},
+			args: args{
+				codes: []string{"XB", "xr"},
+			},
+			want: []*Card{
+				{Value: ValueJoker, Suit: SuitBlack, Code: "XB"},
+				{Value: ValueJoker, Suit: SuitRed, Code: "XR"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid joker suit",
+			fields: fields{
+				CardStorage: &cs,
+			},
+			args: args{
+				codes: []string{"XS"},
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "invalid joker color on regular value",
+			fields: fields{
+				CardStorage: &cs,
+			},
+			args: args{
+				codes: []string{"AB"},
+			},
+			want:    nil,
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -298,6 +339,110 @@ func Test_cardService_ByCodesStr(t *testing.T) {
 	}
 }
 
+func Test_cardService_ByComposition(t *testing.T) {
+	cs := NewCardService()
+	tests := []struct {
+		name        string
+		composition Composition
+		wantLen     int
+		wantCodes   map[string]int
+		wantErr     error
+	}{
+		{
+			name:        "default standard",
+			composition: Composition{},
+			wantLen:     52,
+			wantCodes:   map[string]int{"AS": 1, "2S": 1, "KH": 1},
+		},
+		{
+			name:        "standard with jokers",
+			composition: Composition{Name: CompositionStandard, Jokers: 2},
+			wantLen:     54,
+			wantCodes:   map[string]int{"XB": 1, "XR": 1},
+		},
+		{
+			name:        "piquet",
+			composition: Composition{Name: CompositionPiquet},
+			wantLen:     32,
+			wantCodes:   map[string]int{"7S": 1, "AH": 1, "6S": 0, "2D": 0},
+		},
+		{
+			name:        "euchre",
+			composition: Composition{Name: CompositionEuchre},
+			wantLen:     24,
+			wantCodes:   map[string]int{"9C": 1, "8C": 0},
+		},
+		{
+			name:        "pinochle",
+			composition: Composition{Name: CompositionPinochle},
+			wantLen:     48,
+			wantCodes:   map[string]int{"9C": 2, "AS": 2, "8C": 0},
+		},
+		{
+			name:        "exclude rules",
+			composition: Composition{Exclude: []string{"2*", "*h", "AS"}},
+			wantLen:     52 - 4 - 12 - 1,
+			wantCodes:   map[string]int{"2S": 0, "3H": 0, "AS": 0, "AD": 1},
+		},
+		{
+			name:        "include cards",
+			composition: Composition{Name: CompositionEuchre, Include: []string{"2S", "XR"}},
+			wantLen:     26,
+			wantCodes:   map[string]int{"2S": 1, "XR": 1},
+		},
+		{
+			name:        "unknown name",
+			composition: Composition{Name: "canasta"},
+			wantErr:     ErrCompositionUnknown,
+		},
+		{
+			name:        "too many jokers",
+			composition: Composition{Jokers: 3},
+			wantErr:     ErrCompositionJokersInvalid,
+		},
+		{
+			name:        "invalid exclude rule",
+			composition: Composition{Exclude: []string{"*X"}},
+			wantErr:     ErrCompositionRuleInvalid,
+		},
+		{
+			name:        "invalid include code",
+			composition: Composition{Include: []string{"11S"}},
+			wantErr:     ErrCardCodeValueInvalid,
+		},
+		{
+			name:        "empty include code",
+			composition: Composition{Include: []string{"AS", ""}},
+			wantErr:     ErrCardCodeValueInvalid,
+		},
+		{
+			name:        "blank include code",
+			composition: Composition{Include: []string{" "}},
+			wantErr:     ErrCardCodeValueInvalid,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := cs.ByComposition(&tt.composition)
+			if err != tt.wantErr {
+				t.Fatalf("ByComposition() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != tt.wantLen {
+				t.Errorf("ByComposition() len got = %v, want %v", len(got), tt.wantLen)
+			}
+			counts := map[string]int{}
+			for _, card := range got {
+				counts[card.Code]++
+			}
+			for code, want := range tt.wantCodes {
+				if counts[code] != want {
+					t.Errorf("ByComposition() count of %s got = %v, want %v", code, counts[code], want)
+				}
+			}
+		})
+	}
+}
+
 func Test_staticCardStorage_All(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -3,78 +3,380 @@ package models
 import (
 	"errors"
 	"github.com/google/uuid"
-	"math/rand"
+	"math"
+	"sync"
+	"time"
 )
 
 var (
-	ErrNotEnoughCards = errors.New("there is not enough cards in the deck for the operation")
-	ErrDeckOpened     = errors.New("not permitted on opened deck")
-	ErrNotFound       = errors.New("resource not found")
-	ErrUUIDRequired   = errors.New("uuid is required")
-	ErrUUIDInvalid    = errors.New("uuid is not valid")
+	ErrPositionInvalid    = errors.New("position must be top, bottom or random")
+	ErrDecksInvalid       = errors.New("decks must be between 1 and 8")
+	ErrPenetrationInvalid = errors.New("penetration must be between 0 and 1")
+	ErrNotEnoughCards     = errors.New("there is not enough cards in the deck for the operation")
+	ErrDeckOpened         = errors.New("not permitted on opened deck")
+	ErrNotFound           = errors.New("resource not found")
+	ErrUUIDRequired       = errors.New("uuid is required")
+	ErrUUIDInvalid        = errors.New("uuid is not valid")
+	ErrCountInvalid       = errors.New("count must not be negative")
+	ErrVersionMismatch    = errors.New("deck version does not match")
 )
 
+// Positions in the deck which returned cards are put
+const (
+	PositionTop    = "top"
+	PositionBottom = "bottom"
+	PositionRandom = "random"
+)
+
+// maxShoeDecks is the maximum number of decks in a shoe
+const maxShoeDecks = 8
+
 // Deck is the representation of deck of cards
+// A deck made of multiple decks (Decks > 1) is a shoe,
+// its cut card is placed after CutCard cards by Penetration and
+// Reshuffle is set when dealt cards since the last shuffle reach the cut card
+//
+// Drawn cards are kept in Drawn until they are added to a pile,
+// so every card of the deck is either in Cards, Drawn or one of the Piles
+//
+// Decks with TTL (seconds) expire at ExpiresAt unless they are updated before.
+//
+// Version is 1 on create and incremented by every update of the storage,
+// updates of the service are conditional on IfMatch version if it is set.
+// Mutations of the service are recorded as events of the Actor.
+//
+// Random operations are done by the named Shuffler of the deck,
+// they are reproducible for a deck with Seed if the shuffler supports seeds.
+// Nonce counts the random operations done on the deck.
+// Decks of ShufflerFair carry the Fairness proof of their initial shuffle
+//
+// Owner is a free-text label set by the client, it grants no access.
+// Principal is the authenticated owner of the deck, empty if auth is disabled
 type Deck struct {
-	UUID      string  `json:"deck_id"`
-	Shuffled  bool    `json:"shuffled"`
-	Remaining int     `json:"remaining"`
-	Cards     []*Card `json:"cards"`
-	CardCodes string  `json:"-"`
-	Opened    bool    `json:"-"`
+	UUID        string            `json:"deck_id"`
+	Shuffled    bool              `json:"shuffled"`
+	Remaining   int               `json:"remaining"`
+	Cards       []*Card           `json:"cards"`
+	Composition *Composition      `json:"composition,omitempty"`
+	Decks       int               `json:"decks,omitempty"`
+	Penetration float64           `json:"penetration,omitempty"`
+	CutCard     int               `json:"cut_card,omitempty"`
+	Dealt       int               `json:"dealt,omitempty"`
+	Reshuffle   bool              `json:"reshuffle,omitempty"`
+	Drawn       []*Card           `json:"drawn,omitempty"`
+	Piles       map[string]*Pile  `json:"piles,omitempty"`
+	Seed        *int64            `json:"seed,omitempty"`
+	Shuffler    string            `json:"shuffler,omitempty"`
+	Fairness    *Fairness         `json:"fairness,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+	Owner       string            `json:"owner,omitempty"`
+	Tags        []string          `json:"tags,omitempty"`
+	Principal   string            `json:"principal,omitempty"`
+	Grants      []string          `json:"grants,omitempty"`
+	ACL         map[string]string `json:"acl,omitempty"`
+	Shares      []*Share          `json:"-"`
+	TTL         int               `json:"ttl,omitempty"`
+	ExpiresAt   time.Time         `json:"-"`
+	Version     int               `json:"-"`
+	IfMatch     int               `json:"-"`
+	Actor       string            `json:"-"`
+	Player      string            `json:"-"`
+	Nonce       int               `json:"-"`
+	CardCodes   string            `json:"-"`
+	Opened      bool              `json:"-"`
+
+	// shuffleRequest makes the validation layer shuffle remaining cards on update
+	shuffleRequest *ShuffleOptions
+	// pending is the event of the mutation being persisted, see PendingEvent
+	pending *DeckEvent
 }
 
+// DeckStorage is used to interact with decks storage
+// Implementations must be safe for concurrent use,
+// storagetest package can be used to validate them
 type DeckStorage interface {
+	// Create persists the given deck
 	Create(deck *Deck) error
+	// ByUUID retrieves deck by uuid, returns ErrNotFound if not exists
 	ByUUID(uuid string) (*Deck, error)
+	// Update replaces the stored deck by uuid if its version is not changed and increments the version
+	// Returns ErrNotFound if not exists, ErrVersionMismatch if stored version differs
 	Update(deck *Deck) error
 }
 
 type DeckService interface {
 	DeckStorage
 	Draw(deck *Deck, count int) ([]*Card, error)
+	Peek(deck *Deck, count int) ([]*Card, error)
 	Open(deck *Deck) error
+	Return(deck *Deck, codes []string, position string) error
+	Shuffle(deck *Deck, opts ShuffleOptions) error
+	AddToPile(deck *Deck, pile string, codes []string) error
+	DrawFromPile(deck *Deck, pile string, count int) ([]*Card, error)
+	MoveCards(deck *Deck, from, to string, codes []string, count int) ([]*Card, error)
+	Claim(deck *Deck, pile string) error
+	Deal(deck *Deck, pile string, count int) ([]*Card, error)
+	Reveal(deck *Deck, pile string, codes []string) error
+	Grant(deck *Deck, principals []string) error
+	SetACL(deck *Deck, acl map[string]string) error
+	Share(deck *Deck, role string) (*Share, error)
+	Unshare(deck *Deck, id string) error
+	List(filter DeckFilter) (DeckPage, error)
+	Delete(uuid string) error
+	Events(uuid string, after, limit int) (DeckEventPage, error)
+	Replay(uuid string, seq int) (*Deck, error)
+	Undo(deck *Deck) error
+}
+
+// DeckServiceOption is used to configure DeckService
+type DeckServiceOption func(*deckServiceConfig)
+
+type deckServiceConfig struct {
+	storage   DeckStorage
+	shufflers shufflers
+	ttl       time.Duration
+	undoDepth int
+	hub       *Hub
+	webhooks  *Webhooks
+}
+
+// WithDeckStorage sets the storage used by DeckService
+// Memory storage is used by default
+func WithDeckStorage(ds DeckStorage) DeckServiceOption {
+	return func(cfg *deckServiceConfig) {
+		cfg.storage = ds
+	}
+}
+
+// WithShuffler sets the name of the shuffler used by decks without shuffler
+// ShufflerMath is used by default
+func WithShuffler(name string) DeckServiceOption {
+	return func(cfg *deckServiceConfig) {
+		cfg.shufflers.fallback = name
+	}
+}
+
+// WithShufflerFactory makes the shuffler created by factory selectable by name
+// Overrides the default shufflers with the same name
+func WithShufflerFactory(name string, factory ShufflerFactory) DeckServiceOption {
+	return func(cfg *deckServiceConfig) {
+		cfg.shufflers.register(name, factory)
+	}
 }
 
 // NewDeckService returns deckService instance by defaults
-func NewDeckService(cs CardService) DeckService {
-	dm := deckMemory{decks: map[string]Deck{}}
-	dv := newDeckValidator(&dm, cs)
+// Defaults can be overridden by given options
+func NewDeckService(cs CardService, opts ...DeckServiceOption) DeckService {
+	cfg := deckServiceConfig{
+		storage:   NewDeckMemory(),
+		undoDepth: DefaultUndoDepth,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	dv := newDeckValidator(cfg.storage, cs)
+	dv.shufflers = &cfg.shufflers
+	dv.ttl = cfg.ttl
+	lister, _ := cfg.storage.(DeckLister)
+	deleter, _ := cfg.storage.(DeckDeleter)
+	events, _ := cfg.storage.(DeckEventLog)
 	return &deckService{
 		DeckStorage: dv,
+		shufflers:   &cfg.shufflers,
+		lister:      lister,
+		deleter:     deleter,
+		events:      events,
+		undoDepth:   cfg.undoDepth,
+		hub:         cfg.hub,
+		webhooks:    cfg.webhooks,
 	}
 }
 
 type deckService struct {
 	DeckStorage
+	locks     deckLocks
+	shufflers *shufflers
+	// lister, deleter and events are the storage if it implements them
+	lister  DeckLister
+	deleter DeckDeleter
+	events  DeckEventLog
+	// undoDepth is the number of the operations can be undone in a row
+	undoDepth int
+	// hub and webhooks receive the recorded events if they are set
+	hub      *Hub
+	webhooks *Webhooks
+}
+
+// Create persists the given deck and records its creation
+func (ds *deckService) Create(deck *Deck) error {
+	event := ds.pend(deck, &DeckEvent{Type: EventCreated})
+	if err := ds.DeckStorage.Create(deck); err != nil {
+		return err
+	}
+	ds.record(deck, event)
+	return nil
+}
+
+// Update replaces the stored deck and records the update
+func (ds *deckService) Update(deck *Deck) error {
+	event := ds.pend(deck, &DeckEvent{Type: EventUpdated})
+	if err := ds.DeckStorage.Update(deck); err != nil {
+		return err
+	}
+	ds.record(deck, event)
+	return nil
 }
 
 // Draw is used to release given amount of cards from the top of the given deck
+// Returns ErrCountInvalid if count is negative
 // Returns ErrDeckOpened if deck is opened before
 // Returns ErrNotEnoughCards if deck has not enough cards to draw
 // Returns error from DeckStorage if fails
 func (ds *deckService) Draw(deck *Deck, count int) ([]*Card, error) {
+	if count < 0 {
+		return nil, ErrCountInvalid
+	}
+	var cards []*Card
+	err := ds.modify(deck, &DeckEvent{Type: EventDrawn}, func(deck *Deck) ([]*Card, error) {
+		if deck.Opened {
+			return nil, ErrDeckOpened
+		}
 
-	if deck.Opened {
-		return nil, ErrDeckOpened
+		if count > deck.Remaining {
+			return nil, ErrNotEnoughCards
+		}
+
+		cards = deck.Cards[:count]
+		deck.Cards = deck.Cards[count:]
+		deck.Drawn = append(deck.Drawn, cards...)
+		deck.Dealt += count
+		return cards, nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	return cards, nil
+}
 
-	if count > deck.Remaining {
+// Peek returns given amount of cards from the top of the deck without drawing them
+// Returns ErrCountInvalid if count is negative
+// Returns ErrNotEnoughCards if deck has not enough cards
+func (ds *deckService) Peek(deck *Deck, count int) ([]*Card, error) {
+	if count < 0 {
+		return nil, ErrCountInvalid
+	}
+	if count > len(deck.Cards) {
 		return nil, ErrNotEnoughCards
 	}
+	return append([]*Card{}, deck.Cards[:count]...), nil
+}
 
-	cards := deck.Cards[:count]
-	deck.Cards = deck.Cards[count:]
-	if err := ds.DeckStorage.Update(deck); err != nil {
-		return nil, err
+// Return puts drawn cards of the given codes back to the deck
+// Position is one of PositionTop (default), PositionBottom or PositionRandom
+// Returns ErrPositionInvalid if position is unknown
+// Returns ErrCardsNotDrawn if a card is not among the drawn cards of the deck
+func (ds *deckService) Return(deck *Deck, codes []string, position string) error {
+	if position == "" {
+		position = PositionTop
 	}
-	return cards, nil
+	if position != PositionTop && position != PositionBottom && position != PositionRandom {
+		return ErrPositionInvalid
+	}
+	return ds.modify(deck, &DeckEvent{Type: EventReturned}, func(deck *Deck) ([]*Card, error) {
+		if deck.Opened {
+			return nil, ErrDeckOpened
+		}
+		taken, rest, ok := takeCards(deck.Drawn, codes)
+		if !ok || len(taken) == 0 {
+			return nil, ErrCardsNotDrawn
+		}
+		deck.Drawn = rest
+		switch position {
+		case PositionTop:
+			deck.Cards = append(taken, deck.Cards...)
+		case PositionBottom:
+			deck.Cards = append(deck.Cards, taken...)
+		case PositionRandom:
+			shuffler, err := ds.shufflers.forDeck(deck)
+			if err != nil {
+				return nil, err
+			}
+			for _, card := range taken {
+				idx := shuffler.Intn(len(deck.Cards) + 1)
+				deck.Cards = append(deck.Cards[:idx], append([]*Card{card}, deck.Cards[idx:]...)...)
+			}
+		}
+		return taken, nil
+	})
+}
+
+// Shuffle shuffles remaining cards of the deck in place by the strategy of the options
+// Cards of the discard pile are put back before shuffling if Discarded is set
+// Resets dealt cards counter of the cut card
+// Returns ErrStrategyUnknown if strategy is unknown
+// Returns ErrTimesInvalid if times is out of range
+func (ds *deckService) Shuffle(deck *Deck, opts ShuffleOptions) error {
+	if err := opts.normalize(); err != nil {
+		return err
+	}
+	return ds.modify(deck, &DeckEvent{Type: EventShuffled}, func(deck *Deck) ([]*Card, error) {
+		if deck.Opened {
+			return nil, ErrDeckOpened
+		}
+		if pile, ok := deck.Piles[DiscardPile]; ok && opts.Discarded {
+			deck.Cards = append(deck.Cards, pile.Cards...)
+			pile.Cards = nil
+		}
+		deck.Dealt = 0
+		deck.shuffleRequest = &opts
+		return nil, nil
+	})
 }
 
 // Open sets deck status to opened
+// Reveals the server seed of the fairness proof
 func (ds *deckService) Open(deck *Deck) error {
-	deck.Opened = true
-	return ds.DeckStorage.Update(deck)
+	return ds.modify(deck, &DeckEvent{Type: EventOpened}, func(deck *Deck) ([]*Card, error) {
+		deck.Opened = true
+		if deck.Fairness != nil {
+			deck.Fairness.ServerSeed = deck.Fairness.Secret
+		}
+		return nil, nil
+	})
+}
+
+// modify runs fn on the latest stored state of the given deck
+// while holding the deck lock and persists the result.
+// The event of the mutation is recorded with the cards returned by fn, fn may complete the event
+// Returns ErrVersionMismatch if IfMatch of the deck is set and differs from the stored version
+// Given deck is overwritten by the persisted state if succeed
+func (ds *deckService) modify(deck *Deck, event *DeckEvent, fn func(*Deck) ([]*Card, error)) error {
+	unlock := ds.locks.lock(deck.UUID)
+	defer unlock()
+
+	current, err := ds.DeckStorage.ByUUID(deck.UUID)
+	if err != nil {
+		return err
+	}
+	if deck.IfMatch != 0 && deck.IfMatch != current.Version {
+		return ErrVersionMismatch
+	}
+	cards, err := fn(current)
+	if err != nil {
+		return err
+	}
+	current.Actor = deck.Actor
+	current.Player = deck.Player
+	if len(cards) > 0 && !event.hidesCards(current) {
+		event.Cards = cardCodesOf(cards)
+	}
+	ds.pend(current, event)
+	if err := ds.DeckStorage.Update(current); err != nil {
+		return err
+	}
+	*deck = *current
+	ds.record(deck, event)
+	return nil
 }
 
 type deckValFunc func(*Deck) error
@@ -90,7 +392,10 @@ func runDeckValFuncs(deck *Deck, fns ...deckValFunc) error {
 
 type deckValidator struct {
 	DeckStorage
-	cs CardService
+	cs        CardService
+	shufflers *shufflers
+	// ttl is the default ttl of the created decks
+	ttl time.Duration
 }
 
 func newDeckValidator(ds DeckStorage, cs CardService) *deckValidator {
@@ -100,14 +405,82 @@ func newDeckValidator(ds DeckStorage, cs CardService) *deckValidator {
 	}
 }
 
+func (dv *deckValidator) setShuffler(deck *Deck) error {
+	if deck.Shuffler == "" {
+		deck.Shuffler = dv.shufflers.defaultName()
+	}
+	_, err := dv.shufflers.factory(deck.Shuffler)
+	return err
+}
+
+func (dv *deckValidator) checkShuffler(deck *Deck) error {
+	factory, err := dv.shufflers.factory(deck.Shuffler)
+	if err != nil {
+		return err
+	}
+	// probe on a copy, factories may consume the deck nonce
+	probe := *deck
+	_, err = factory(&probe)
+	return err
+}
+
+// setFairness draws the server seed of ShufflerFair decks
+// Fair decks are always shuffled, only the client seed is taken from the given fairness
+func (dv *deckValidator) setFairness(deck *Deck) error {
+	if deck.Shuffler != ShufflerFair {
+		deck.Fairness = nil
+		return nil
+	}
+	f := &Fairness{Secret: newServerSeed(), Nonce: deck.Nonce}
+	if deck.Fairness != nil {
+		f.ClientSeed = deck.Fairness.ClientSeed
+	}
+	f.ServerSeedHash = hashHex(f.Secret)
+	f.Initial = cardCodes(deck.Cards)
+	deck.Fairness = f
+	deck.Shuffled = true
+	return nil
+}
+
+// commitFairness publishes the commitment of the shuffled order
+func (dv *deckValidator) commitFairness(deck *Deck) error {
+	if deck.Fairness != nil {
+		deck.Fairness.Commitment = fairnessCommitment(deck.Fairness.Secret, cardCodes(deck.Cards))
+	}
+	return nil
+}
+
+// permute applies the named strategy to the cards of the deck given times
+// by a single shuffler of the deck
+func (dv *deckValidator) permute(deck *Deck, name string, times int) error {
+	strategy, ok := strategies[name]
+	if !ok {
+		return ErrStrategyUnknown
+	}
+	shuffler, err := dv.shufflers.forDeck(deck)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < times; i++ {
+		deck.Cards = strategy(deck.Cards, shuffler)
+	}
+	return nil
+}
+
 func (dv *deckValidator) shuffle(deck *Deck) error {
 	if deck.Shuffled == true {
-		cards := make([]*Card, deck.Remaining)
-		perm := rand.Perm(deck.Remaining)
-		for idx, permIdx := range perm {
-			cards[idx] = deck.Cards[permIdx]
+		return dv.permute(deck, StrategyUniform, 1)
+	}
+	return nil
+}
+
+func (dv *deckValidator) shuffleIfRequested(deck *Deck) error {
+	if req := deck.shuffleRequest; req != nil {
+		if err := dv.permute(deck, req.Strategy, req.Times); err != nil {
+			return err
 		}
-		deck.Cards = cards
+		deck.Shuffled = true
+		deck.shuffleRequest = nil
 	}
 	return nil
 }
@@ -119,6 +492,38 @@ func (dv *deckValidator) setUUIDIfUnset(deck *Deck) error {
 	return nil
 }
 
+func (dv *deckValidator) setCreatedAtIfUnset(deck *Deck) error {
+	if deck.CreatedAt.IsZero() {
+		deck.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	}
+	return nil
+}
+
+func (dv *deckValidator) setTTL(deck *Deck) error {
+	if deck.TTL < 0 {
+		return ErrTTLInvalid
+	}
+	if deck.TTL == 0 {
+		deck.TTL = int(dv.ttl / time.Second)
+	}
+	return nil
+}
+
+// setExpiresAt refreshes the expiry of the decks with ttl
+func (dv *deckValidator) setExpiresAt(deck *Deck) error {
+	if deck.TTL > 0 {
+		deck.ExpiresAt = time.Now().UTC().Add(time.Duration(deck.TTL) * time.Second).Truncate(time.Microsecond)
+	}
+	return nil
+}
+
+func (dv *deckValidator) notExpired(deck *Deck) error {
+	if deck.expired(time.Now()) {
+		return ErrNotFound
+	}
+	return nil
+}
+
 func (dv *deckValidator) setCardsByCodes(deck *Deck) error {
 	if deck.CardCodes != "" {
 		cards, err := dv.cs.ByCodesStr(deck.CardCodes)
@@ -133,7 +538,13 @@ func (dv *deckValidator) setCardsByCodes(deck *Deck) error {
 
 func (dv *deckValidator) setCardsIfEmpty(deck *Deck) error {
 	if deck.Cards == nil {
-		cards, err := dv.cs.All()
+		var cards []*Card
+		var err error
+		if deck.Composition != nil {
+			cards, err = dv.cs.ByComposition(deck.Composition)
+		} else {
+			cards, err = dv.cs.All()
+		}
 		if err != nil {
 			return err
 		}
@@ -142,8 +553,35 @@ func (dv *deckValidator) setCardsIfEmpty(deck *Deck) error {
 	return nil
 }
 
+func (dv *deckValidator) setShoe(deck *Deck) error {
+	if deck.Decks < 0 || deck.Decks > maxShoeDecks {
+		return ErrDecksInvalid
+	}
+	if deck.Penetration < 0 || deck.Penetration >= 1 {
+		return ErrPenetrationInvalid
+	}
+	if deck.Decks > 1 {
+		cards := make([]*Card, 0, len(deck.Cards)*deck.Decks)
+		for i := 0; i < deck.Decks; i++ {
+			cards = append(cards, deck.Cards...)
+		}
+		deck.Cards = cards
+	}
+	deck.CutCard = int(math.Round(float64(len(deck.Cards)) * deck.Penetration))
+	deck.Dealt = 0
+	return nil
+}
+
 func (dv *deckValidator) setRemaining(deck *Deck) error {
 	deck.Remaining = len(deck.Cards)
+	for _, pile := range deck.Piles {
+		pile.Remaining = len(pile.Cards)
+	}
+	return nil
+}
+
+func (dv *deckValidator) setReshuffle(deck *Deck) error {
+	deck.Reshuffle = deck.CutCard > 0 && deck.Dealt >= deck.CutCard
 	return nil
 }
 
@@ -168,10 +606,21 @@ func (dv deckValidator) Create(deck *Deck) error {
 	err := runDeckValFuncs(deck,
 		dv.setUUIDIfUnset,
 		dv.isValidUUID,
+		dv.checkGrants,
+		dv.checkACL,
+		dv.setCreatedAtIfUnset,
+		dv.setTTL,
+		dv.setExpiresAt,
 		dv.setCardsByCodes,
 		dv.setCardsIfEmpty,
+		dv.setShoe,
 		dv.setRemaining,
+		dv.setReshuffle,
+		dv.setShuffler,
+		dv.setFairness,
+		dv.checkShuffler,
 		dv.shuffle,
+		dv.commitFairness,
 	)
 	if err != nil {
 		return err
@@ -185,6 +634,9 @@ func (dv deckValidator) Update(deck *Deck) error {
 	err := runDeckValFuncs(deck,
 		dv.requireUUID,
 		dv.setRemaining,
+		dv.shuffleIfRequested,
+		dv.setReshuffle,
+		dv.setExpiresAt,
 	)
 	if err != nil {
 		return err
@@ -204,30 +656,100 @@ func (dv *deckValidator) ByUUID(uuid string) (*Deck, error) {
 		return nil, err
 	}
 
-	return dv.DeckStorage.ByUUID(deck.UUID)
+	found, err := dv.DeckStorage.ByUUID(deck.UUID)
+	if err != nil {
+		return nil, err
+	}
+	// expired decks are not found even before they are evicted
+	if err := dv.notExpired(found); err != nil {
+		return nil, err
+	}
+	return found, nil
+}
+
+// copyDeck returns a copy of the given deck
+// which does not share the cards slice with the original
+func copyDeck(deck *Deck) Deck {
+	c := *deck
+	if deck.Cards != nil {
+		c.Cards = make([]*Card, len(deck.Cards))
+		copy(c.Cards, deck.Cards)
+	}
+	if deck.Drawn != nil {
+		c.Drawn = append([]*Card{}, deck.Drawn...)
+	}
+	c.Piles = copyPiles(deck.Piles)
+	if deck.Tags != nil {
+		c.Tags = append([]string{}, deck.Tags...)
+	}
+	if deck.Grants != nil {
+		c.Grants = append([]string{}, deck.Grants...)
+	}
+	c.ACL = copyACL(deck.ACL)
+	c.Shares = copyShares(deck.Shares)
+	c.pending = nil
+	if deck.Fairness != nil {
+		f := *deck.Fairness
+		f.Initial = append([]string(nil), deck.Fairness.Initial...)
+		c.Fairness = &f
+	}
+	return c
+}
+
+// NewDeckMemory returns the in-memory DeckStorage implementation
+func NewDeckMemory() DeckStorage {
+	return &deckMemory{decks: map[string]Deck{}}
 }
 
+// deckMemory is the in-memory DeckStorage implementation
+// It is safe for concurrent use
 type deckMemory struct {
-	decks map[string]Deck
+	mu     sync.RWMutex
+	decks  map[string]Deck
+	events map[string][]DeckEvent
 }
 
 // Create persists given deck to storage
 func (dm *deckMemory) Create(deck *Deck) error {
-	dm.decks[deck.UUID] = *deck
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	deck.Version = 1
+	dm.decks[deck.UUID] = copyDeck(deck)
+	if event := deck.PendingEvent(); event != nil {
+		dm.appendEvent(event)
+	}
 	return nil
 }
 
 // ByUUID finds and returns deck by give uuid
 func (dm *deckMemory) ByUUID(uuid string) (*Deck, error) {
+	dm.mu.RLock()
+	defer dm.mu.RUnlock()
 	deck, ok := dm.decks[uuid]
 	if !ok {
 		return nil, ErrNotFound
 	}
+	deck = copyDeck(&deck)
 	return &deck, nil
 }
 
 // Update updates matching deck in the storage by given deck
+// Returns ErrNotFound if deck does not exist
+// Returns ErrVersionMismatch if deck is updated after it is read
 func (dm *deckMemory) Update(deck *Deck) error {
-	dm.decks[deck.UUID] = *deck
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	stored, ok := dm.decks[deck.UUID]
+	if !ok {
+		return ErrNotFound
+	}
+	if stored.Version != deck.Version {
+		return ErrVersionMismatch
+	}
+	deck.Version++
+	dm.decks[deck.UUID] = copyDeck(deck)
+	if event := deck.PendingEvent(); event != nil {
+		dm.appendEvent(event)
+	}
 	return nil
 }
@@ -0,0 +1,928 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrDialectUnsupported = errors.New("sql dialect is not supported")
+)
+
+// Dialect is the SQL dialect spoken by the database
+type Dialect string
+
+const (
+	DialectSQLite   = Dialect("sqlite3")
+	DialectPostgres = Dialect("postgres")
+)
+
+// rebind converts query placeholders from ? to the dialect bind variables
+func (d Dialect) rebind(query string) string {
+	if d != DialectPostgres {
+		return query
+	}
+	var sb strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			sb.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// deckSQLMigrations are the schema changes of the deck storage
+// Applied in order, new migrations must be appended to the end
+var deckSQLMigrations = []string{
+	`CREATE TABLE decks (
+		uuid VARCHAR(36) PRIMARY KEY,
+		shuffled BOOLEAN NOT NULL,
+		remaining INTEGER NOT NULL,
+		opened BOOLEAN NOT NULL
+	)`,
+	`CREATE TABLE deck_cards (
+		deck_uuid VARCHAR(36) NOT NULL REFERENCES decks(uuid) ON DELETE CASCADE,
+		position INTEGER NOT NULL,
+		value VARCHAR(16) NOT NULL,
+		suit VARCHAR(16) NOT NULL,
+		code VARCHAR(8) NOT NULL,
+		PRIMARY KEY (deck_uuid, position)
+	)`,
+	`ALTER TABLE decks ADD COLUMN composition TEXT`,
+	`ALTER TABLE decks ADD COLUMN decks INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE decks ADD COLUMN penetration DOUBLE PRECISION NOT NULL DEFAULT 0`,
+	`ALTER TABLE decks ADD COLUMN cut_card INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE decks ADD COLUMN dealt INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE decks ADD COLUMN reshuffle BOOLEAN NOT NULL DEFAULT FALSE`,
+	`CREATE TABLE deck_drawn_cards (
+		deck_uuid VARCHAR(36) NOT NULL REFERENCES decks(uuid) ON DELETE CASCADE,
+		position INTEGER NOT NULL,
+		value VARCHAR(16) NOT NULL,
+		suit VARCHAR(16) NOT NULL,
+		code VARCHAR(8) NOT NULL,
+		PRIMARY KEY (deck_uuid, position)
+	)`,
+	`CREATE TABLE deck_piles (
+		deck_uuid VARCHAR(36) NOT NULL REFERENCES decks(uuid) ON DELETE CASCADE,
+		name VARCHAR(64) NOT NULL,
+		PRIMARY KEY (deck_uuid, name)
+	)`,
+	`CREATE TABLE deck_pile_cards (
+		deck_uuid VARCHAR(36) NOT NULL,
+		pile VARCHAR(64) NOT NULL,
+		position INTEGER NOT NULL,
+		value VARCHAR(16) NOT NULL,
+		suit VARCHAR(16) NOT NULL,
+		code VARCHAR(8) NOT NULL,
+		PRIMARY KEY (deck_uuid, pile, position),
+		FOREIGN KEY (deck_uuid, pile) REFERENCES deck_piles(deck_uuid, name) ON DELETE CASCADE
+	)`,
+	`ALTER TABLE decks ADD COLUMN seed BIGINT`,
+	`ALTER TABLE decks ADD COLUMN nonce INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE decks ADD COLUMN shuffler VARCHAR(32) NOT NULL DEFAULT ''`,
+	`ALTER TABLE decks ADD COLUMN fairness TEXT`,
+	`ALTER TABLE decks ADD COLUMN server_seed VARCHAR(64) NOT NULL DEFAULT ''`,
+	`ALTER TABLE decks ADD COLUMN created_at TIMESTAMP`,
+	`ALTER TABLE decks ADD COLUMN owner VARCHAR(255) NOT NULL DEFAULT ''`,
+	`ALTER TABLE decks ADD COLUMN tags TEXT`,
+	`UPDATE decks SET created_at = CURRENT_TIMESTAMP WHERE created_at IS NULL`,
+	`ALTER TABLE decks ADD COLUMN ttl INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE decks ADD COLUMN expires_at TIMESTAMP`,
+	`CREATE INDEX decks_expires_at ON decks (expires_at)`,
+	`ALTER TABLE decks ADD COLUMN version INTEGER NOT NULL DEFAULT 1`,
+	`CREATE TABLE idempotency_keys (
+		idempotency_key VARCHAR(255) PRIMARY KEY,
+		fingerprint VARCHAR(64) NOT NULL,
+		status INTEGER NOT NULL DEFAULT 0,
+		header TEXT,
+		body TEXT,
+		expires_at TIMESTAMP NOT NULL
+	)`,
+	`CREATE INDEX idempotency_keys_expires_at ON idempotency_keys (expires_at)`,
+	`CREATE TABLE deck_events (
+		deck_uuid VARCHAR(36) NOT NULL,
+		seq INTEGER NOT NULL,
+		type VARCHAR(32) NOT NULL,
+		at TIMESTAMP NOT NULL,
+		actor VARCHAR(255) NOT NULL DEFAULT '',
+		cards TEXT,
+		pile VARCHAR(64) NOT NULL DEFAULT '',
+		to_pile VARCHAR(64) NOT NULL DEFAULT '',
+		state TEXT,
+		PRIMARY KEY (deck_uuid, seq)
+	)`,
+	`ALTER TABLE deck_events ADD COLUMN reverts INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE deck_piles ADD COLUMN owner VARCHAR(64) NOT NULL DEFAULT ''`,
+	`ALTER TABLE deck_piles ADD COLUMN revealed TEXT`,
+	`ALTER TABLE decks ADD COLUMN principal VARCHAR(255) NOT NULL DEFAULT ''`,
+	`ALTER TABLE decks ADD COLUMN grants TEXT`,
+	`ALTER TABLE decks ADD COLUMN acl TEXT`,
+	`ALTER TABLE decks ADD COLUMN shares TEXT`,
+}
+
+// deckSQLColumns are the columns of decks table except uuid
+// Order must match deckSQL.values and deckSQL.scan
+var deckSQLColumns = []string{
+	"shuffled",
+	"remaining",
+	"opened",
+	"composition",
+	"decks",
+	"penetration",
+	"cut_card",
+	"dealt",
+	"reshuffle",
+	"seed",
+	"nonce",
+	"shuffler",
+	"fairness",
+	"server_seed",
+	"created_at",
+	"owner",
+	"tags",
+	"ttl",
+	"expires_at",
+	"version",
+	"principal",
+	"grants",
+	"acl",
+	"shares",
+}
+
+// NewDeckSQL returns DeckStorage backed by the given database
+// Applies pending schema migrations before returning
+// Returns ErrDialectUnsupported if dialect is unknown
+func NewDeckSQL(db *sql.DB, dialect Dialect) (DeckStorage, error) {
+	if dialect != DialectSQLite && dialect != DialectPostgres {
+		return nil, ErrDialectUnsupported
+	}
+	ds := &deckSQL{db: db, dialect: dialect}
+	if err := ds.migrate(); err != nil {
+		return nil, err
+	}
+	return ds, nil
+}
+
+// deckSQL is the database/sql DeckStorage implementation
+type deckSQL struct {
+	db      *sql.DB
+	dialect Dialect
+}
+
+// migrate applies schema migrations which are not applied yet
+func (ds *deckSQL) migrate() error {
+	_, err := ds.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`)
+	if err != nil {
+		return err
+	}
+
+	var version int
+	row := ds.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`)
+	if err := row.Scan(&version); err != nil {
+		return err
+	}
+
+	for ; version < len(deckSQLMigrations); version++ {
+		err := ds.inTx(func(tx *sql.Tx) error {
+			if _, err := tx.Exec(deckSQLMigrations[version]); err != nil {
+				return err
+			}
+			_, err := tx.Exec(ds.dialect.rebind(`INSERT INTO schema_migrations (version) VALUES (?)`), version+1)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// inTx runs fn in a transaction
+// Commits if fn succeeds, rolls back otherwise
+func (ds *deckSQL) inTx(fn func(tx *sql.Tx) error) error {
+	tx, err := ds.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// inReadTx runs fn in a read only transaction which reads a single snapshot of the database
+// Statements of the default postgres isolation level would read the commits in between
+func (ds *deckSQL) inReadTx(fn func(tx *sql.Tx) error) error {
+	tx, err := ds.db.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// values returns the column values of the given deck by deckSQLColumns order
+func (ds *deckSQL) values(deck *Deck) ([]interface{}, error) {
+	composition, err := marshalNullJSON(deck.Composition)
+	if err != nil {
+		return nil, err
+	}
+	var tags sql.NullString
+	if len(deck.Tags) > 0 {
+		if tags, err = marshalNullJSON(deck.Tags); err != nil {
+			return nil, err
+		}
+	}
+	var grants sql.NullString
+	if len(deck.Grants) > 0 {
+		if grants, err = marshalNullJSON(deck.Grants); err != nil {
+			return nil, err
+		}
+	}
+	var acl, shares sql.NullString
+	if len(deck.ACL) > 0 {
+		if acl, err = marshalNullJSON(deck.ACL); err != nil {
+			return nil, err
+		}
+	}
+	if len(deck.Shares) > 0 {
+		if shares, err = marshalNullJSON(deck.Shares); err != nil {
+			return nil, err
+		}
+	}
+	var expiresAt sql.NullTime
+	if !deck.ExpiresAt.IsZero() {
+		expiresAt = sql.NullTime{Time: deck.ExpiresAt.UTC(), Valid: true}
+	}
+	// server seed is not marshaled to keep it secret until reveal
+	fairness, err := marshalNullJSON(deck.Fairness)
+	if err != nil {
+		return nil, err
+	}
+	serverSeed := ""
+	if deck.Fairness != nil {
+		serverSeed = deck.Fairness.Secret
+	}
+	return []interface{}{
+		deck.Shuffled,
+		deck.Remaining,
+		deck.Opened,
+		composition,
+		deck.Decks,
+		deck.Penetration,
+		deck.CutCard,
+		deck.Dealt,
+		deck.Reshuffle,
+		deck.Seed,
+		deck.Nonce,
+		deck.Shuffler,
+		fairness,
+		serverSeed,
+		deck.CreatedAt.UTC(),
+		deck.Owner,
+		tags,
+		deck.TTL,
+		expiresAt,
+		deck.Version,
+		deck.Principal,
+		grants,
+		acl,
+		shares,
+	}, nil
+}
+
+// scan reads the deckSQLColumns of the row into the given deck
+func (ds *deckSQL) scan(row *sql.Row, deck *Deck) error {
+	var composition, fairness, tags, grants, acl, shares sql.NullString
+	var seed sql.NullInt64
+	var serverSeed string
+	var createdAt, expiresAt sql.NullTime
+	err := row.Scan(
+		&deck.Shuffled,
+		&deck.Remaining,
+		&deck.Opened,
+		&composition,
+		&deck.Decks,
+		&deck.Penetration,
+		&deck.CutCard,
+		&deck.Dealt,
+		&deck.Reshuffle,
+		&seed,
+		&deck.Nonce,
+		&deck.Shuffler,
+		&fairness,
+		&serverSeed,
+		&createdAt,
+		&deck.Owner,
+		&tags,
+		&deck.TTL,
+		&expiresAt,
+		&deck.Version,
+		&deck.Principal,
+		&grants,
+		&acl,
+		&shares,
+	)
+	if err != nil {
+		return err
+	}
+	if seed.Valid {
+		deck.Seed = &seed.Int64
+	}
+	if createdAt.Valid {
+		deck.CreatedAt = createdAt.Time.UTC()
+	}
+	if expiresAt.Valid {
+		deck.ExpiresAt = expiresAt.Time.UTC()
+	}
+	if err := unmarshalNullJSON(composition, &deck.Composition); err != nil {
+		return err
+	}
+	if err := unmarshalNullJSON(fairness, &deck.Fairness); err != nil {
+		return err
+	}
+	if err := unmarshalNullJSON(tags, &deck.Tags); err != nil {
+		return err
+	}
+	if err := unmarshalNullJSON(grants, &deck.Grants); err != nil {
+		return err
+	}
+	if err := unmarshalNullJSON(acl, &deck.ACL); err != nil {
+		return err
+	}
+	if err := unmarshalNullJSON(shares, &deck.Shares); err != nil {
+		return err
+	}
+	if deck.Fairness != nil {
+		deck.Fairness.Secret = serverSeed
+	}
+	return nil
+}
+
+// Create persists given deck to storage
+func (ds *deckSQL) Create(deck *Deck) error {
+	deck.Version = 1
+	values, err := ds.values(deck)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO decks (uuid, ` + strings.Join(deckSQLColumns, ", ") + `) VALUES (?` +
+		strings.Repeat(", ?", len(deckSQLColumns)) + `)`
+
+	return ds.inTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(ds.dialect.rebind(query), append([]interface{}{deck.UUID}, values...)...)
+		if err != nil {
+			return err
+		}
+		if err := ds.insertCards(tx, deck); err != nil {
+			return err
+		}
+		return ds.insertPendingEvent(tx, deck)
+	})
+}
+
+// ByUUID finds and returns deck by give uuid
+// Deck and its cards are read in a single transaction, so they are of the same version
+// Returns ErrNotFound if deck does not exist
+func (ds *deckSQL) ByUUID(uuid string) (*Deck, error) {
+	deck := Deck{UUID: uuid}
+	err := ds.inReadTx(func(tx *sql.Tx) error {
+		row := tx.QueryRow(ds.dialect.rebind(
+			`SELECT `+strings.Join(deckSQLColumns, ", ")+` FROM decks WHERE uuid = ?`), uuid)
+		err := ds.scan(row, &deck)
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		if deck.Cards, err = ds.selectCards(tx, `deck_cards`, uuid); err != nil {
+			return err
+		}
+		if deck.Drawn, err = ds.selectCards(tx, `deck_drawn_cards`, uuid); err != nil {
+			return err
+		}
+		deck.Piles, err = ds.selectPiles(tx, uuid)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &deck, nil
+}
+
+// selectCards returns the ordered cards of the deck from the given cards table
+func (ds *deckSQL) selectCards(tx *sql.Tx, table string, uuid string) ([]*Card, error) {
+	rows, err := tx.Query(ds.dialect.rebind(
+		`SELECT value, suit, code FROM `+table+` WHERE deck_uuid = ? ORDER BY position`), uuid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var cards []*Card
+	for rows.Next() {
+		card := Card{}
+		if err := rows.Scan(&card.Value, &card.Suit, &card.Code); err != nil {
+			return nil, err
+		}
+		cards = append(cards, &card)
+	}
+	return cards, rows.Err()
+}
+
+// selectPiles returns the piles of the deck with their ordered cards
+func (ds *deckSQL) selectPiles(tx *sql.Tx, uuid string) (map[string]*Pile, error) {
+	rows, err := tx.Query(ds.dialect.rebind(
+		`SELECT name, owner, revealed FROM deck_piles WHERE deck_uuid = ?`), uuid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var piles map[string]*Pile
+	for rows.Next() {
+		var name string
+		var revealed sql.NullString
+		pile := &Pile{}
+		if err := rows.Scan(&name, &pile.Owner, &revealed); err != nil {
+			return nil, err
+		}
+		if err := unmarshalNullJSON(revealed, &pile.Revealed); err != nil {
+			return nil, err
+		}
+		if piles == nil {
+			piles = map[string]*Pile{}
+		}
+		piles[name] = pile
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	rows, err = tx.Query(ds.dialect.rebind(
+		`SELECT pile, value, suit, code FROM deck_pile_cards WHERE deck_uuid = ? ORDER BY pile, position`), uuid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		card := Card{}
+		if err := rows.Scan(&name, &card.Value, &card.Suit, &card.Code); err != nil {
+			return nil, err
+		}
+		pile := piles[name]
+		pile.Cards = append(pile.Cards, &card)
+		pile.Remaining++
+	}
+	return piles, rows.Err()
+}
+
+// List returns the page of the stored decks matching the filter
+func (ds *deckSQL) List(filter DeckFilter) (DeckPage, error) {
+	limit, after, err := filter.page()
+	if err != nil {
+		return DeckPage{}, err
+	}
+
+	var conds []string
+	var args []interface{}
+	where := func(cond string, arg ...interface{}) {
+		conds = append(conds, cond)
+		args = append(args, arg...)
+	}
+	if filter.Opened != nil {
+		where(`opened = ?`, *filter.Opened)
+	}
+	if filter.Shuffled != nil {
+		where(`shuffled = ?`, *filter.Shuffled)
+	}
+	if !filter.CreatedAfter.IsZero() {
+		where(`created_at > ?`, filter.CreatedAfter.UTC())
+	}
+	if !filter.CreatedBefore.IsZero() {
+		where(`created_at < ?`, filter.CreatedBefore.UTC())
+	}
+	if filter.MinRemaining != nil {
+		where(`remaining >= ?`, *filter.MinRemaining)
+	}
+	if filter.MaxRemaining != nil {
+		where(`remaining <= ?`, *filter.MaxRemaining)
+	}
+	if filter.Owner != "" {
+		where(`owner = ?`, filter.Owner)
+	}
+	if filter.Principal != "" {
+		where(`principal = ?`, filter.Principal)
+	}
+	if !filter.ExpiresAfter.IsZero() {
+		where(`(expires_at IS NULL OR expires_at >= ?)`, filter.ExpiresAfter.UTC())
+	}
+	if filter.Tag != "" {
+		// tags are stored as json array, match the quoted tag
+		tag, err := json.Marshal(filter.Tag)
+		if err != nil {
+			return DeckPage{}, err
+		}
+		where(`tags LIKE ? ESCAPE '\'`, "%"+escapeLike(string(tag))+"%")
+	}
+	if filter.Viewer != "" {
+		// grants and acl are stored as json, match the quoted principal like tags
+		viewer, err := json.Marshal(filter.Viewer)
+		if err != nil {
+			return DeckPage{}, err
+		}
+		quoted := escapeLike(string(viewer))
+		where(`(principal = '' OR principal = ? OR acl IS NULL OR grants LIKE ? ESCAPE '\' OR acl LIKE ? ESCAPE '\')`,
+			filter.Viewer, "%"+quoted+"%", "%"+quoted+":%")
+	}
+	if after != nil {
+		where(`(created_at > ? OR (created_at = ? AND uuid > ?))`, after.createdAt.UTC(), after.createdAt.UTC(), after.uuid)
+	}
+
+	query := `SELECT uuid, created_at FROM decks`
+	if len(conds) > 0 {
+		query += ` WHERE ` + strings.Join(conds, ` AND `)
+	}
+	query += ` ORDER BY created_at, uuid LIMIT ?`
+	rows, err := ds.db.Query(ds.dialect.rebind(query), append(args, limit+1)...)
+	if err != nil {
+		return DeckPage{}, err
+	}
+	var cursors []deckCursor
+	for rows.Next() {
+		var c deckCursor
+		if err := rows.Scan(&c.uuid, &c.createdAt); err != nil {
+			rows.Close()
+			return DeckPage{}, err
+		}
+		cursors = append(cursors, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return DeckPage{}, err
+	}
+
+	page := DeckPage{Decks: make([]*Deck, 0, len(cursors)), Limit: limit}
+	if len(cursors) > limit {
+		cursors = cursors[:limit]
+		page.NextCursor = cursors[limit-1].String()
+	}
+	for _, c := range cursors {
+		deck, err := ds.ByUUID(c.uuid)
+		if err == ErrNotFound {
+			// deleted after listed
+			continue
+		}
+		if err != nil {
+			return DeckPage{}, err
+		}
+		page.Decks = append(page.Decks, deck)
+	}
+	return page, nil
+}
+
+// escapeLike escapes the wildcards of the LIKE pattern by backslash
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// Update updates matching deck in the storage by given deck
+// Returns ErrNotFound if deck does not exist
+// Returns ErrVersionMismatch if deck is updated after it is read
+func (ds *deckSQL) Update(deck *Deck) error {
+	next := *deck
+	next.Version++
+	values, err := ds.values(&next)
+	if err != nil {
+		return err
+	}
+	query := `UPDATE decks SET ` + strings.Join(deckSQLColumns, " = ?, ") + ` = ? WHERE uuid = ? AND version = ?`
+
+	err = ds.inTx(func(tx *sql.Tx) error {
+		res, err := tx.Exec(ds.dialect.rebind(query), append(values, deck.UUID, deck.Version)...)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ds.updateMissed(tx, deck.UUID)
+		}
+
+		for _, table := range deckSQLCardTables {
+			_, err = tx.Exec(ds.dialect.rebind(`DELETE FROM `+table+` WHERE deck_uuid = ?`), deck.UUID)
+			if err != nil {
+				return err
+			}
+		}
+		if err := ds.insertCards(tx, &next); err != nil {
+			return err
+		}
+		return ds.insertPendingEvent(tx, &next)
+	})
+	if err != nil {
+		return err
+	}
+	deck.Version = next.Version
+	return nil
+}
+
+// updateMissed returns the reason of an update matching no deck
+// Returns ErrVersionMismatch if deck exists, ErrNotFound otherwise
+func (ds *deckSQL) updateMissed(tx *sql.Tx, uuid string) error {
+	var found int
+	err := tx.QueryRow(ds.dialect.rebind(`SELECT 1 FROM decks WHERE uuid = ?`), uuid).Scan(&found)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return ErrVersionMismatch
+}
+
+// deckSQLCardTables are the tables of the deck cards and piles
+// Order is safe to delete from
+var deckSQLCardTables = []string{`deck_cards`, `deck_drawn_cards`, `deck_pile_cards`, `deck_piles`}
+
+// Delete removes the deck and its events by uuid
+// Returns ErrNotFound if deck does not exist
+func (ds *deckSQL) Delete(uuid string) error {
+	return ds.inTx(func(tx *sql.Tx) error {
+		for _, table := range append(deckSQLCardTables, `deck_events`) {
+			_, err := tx.Exec(ds.dialect.rebind(`DELETE FROM `+table+` WHERE deck_uuid = ?`), uuid)
+			if err != nil {
+				return err
+			}
+		}
+		res, err := tx.Exec(ds.dialect.rebind(`DELETE FROM decks WHERE uuid = ?`), uuid)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
+
+// DeleteExpired removes the decks and their events which expire before now
+func (ds *deckSQL) DeleteExpired(now time.Time) (int, error) {
+	var n int64
+	err := ds.inTx(func(tx *sql.Tx) error {
+		expired := `SELECT uuid FROM decks WHERE expires_at IS NOT NULL AND expires_at < ?`
+		for _, table := range append(deckSQLCardTables, `deck_events`) {
+			_, err := tx.Exec(ds.dialect.rebind(`DELETE FROM `+table+` WHERE deck_uuid IN (`+expired+`)`), now.UTC())
+			if err != nil {
+				return err
+			}
+		}
+		res, err := tx.Exec(ds.dialect.rebind(`DELETE FROM decks WHERE uuid IN (`+expired+`)`), now.UTC())
+		if err != nil {
+			return err
+		}
+		n, err = res.RowsAffected()
+		return err
+	})
+	return int(n), err
+}
+
+// AppendEvent appends the event to the events of its deck
+func (ds *deckSQL) AppendEvent(event *DeckEvent) error {
+	return ds.inTx(func(tx *sql.Tx) error {
+		return ds.insertEvent(tx, event)
+	})
+}
+
+// insertPendingEvent appends the pending event of the deck if any
+func (ds *deckSQL) insertPendingEvent(tx *sql.Tx, deck *Deck) error {
+	if event := deck.PendingEvent(); event != nil {
+		return ds.insertEvent(tx, event)
+	}
+	return nil
+}
+
+// insertEvent appends the event to the events of its deck
+func (ds *deckSQL) insertEvent(tx *sql.Tx, event *DeckEvent) error {
+	var cards sql.NullString
+	var err error
+	if len(event.Cards) > 0 {
+		if cards, err = marshalNullJSON(event.Cards); err != nil {
+			return err
+		}
+	}
+	state, err := marshalNullJSON(event.State)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ds.dialect.rebind(`INSERT INTO deck_events `+
+		`(deck_uuid, seq, type, at, actor, cards, pile, to_pile, reverts, state) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`),
+		event.DeckID, event.Seq, event.Type, event.At.UTC(), event.Actor, cards, event.Pile, event.To, event.Reverts, state)
+	if err != nil {
+		return err
+	}
+	return ds.boundEvents(tx, event)
+}
+
+// boundEvents drops the events and states of the deck beyond the bounds, sequences are contiguous
+func (ds *deckSQL) boundEvents(tx *sql.Tx, event *DeckEvent) error {
+	if _, err := tx.Exec(ds.dialect.rebind(`DELETE FROM deck_events WHERE deck_uuid = ? AND seq <= ?`),
+		event.DeckID, event.Seq-EventLimit); err != nil {
+		return err
+	}
+	_, err := tx.Exec(ds.dialect.rebind(`UPDATE deck_events SET state = NULL `+
+		`WHERE deck_uuid = ? AND seq <= ? AND state IS NOT NULL`), event.DeckID, event.Seq-EventStates)
+	return err
+}
+
+// Events returns the events of the deck after the sequence in order
+func (ds *deckSQL) Events(uuid string, after, limit int) ([]*DeckEvent, error) {
+	query := `SELECT seq, type, at, actor, cards, pile, to_pile, reverts, state FROM deck_events ` +
+		`WHERE deck_uuid = ? AND seq > ? ORDER BY seq`
+	args := []interface{}{uuid, after}
+	if limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, limit)
+	}
+	rows, err := ds.db.Query(ds.dialect.rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]*DeckEvent, 0)
+	for rows.Next() {
+		event := &DeckEvent{DeckID: uuid}
+		var cards, state sql.NullString
+		err := rows.Scan(&event.Seq, &event.Type, &event.At, &event.Actor, &cards, &event.Pile, &event.To, &event.Reverts, &state)
+		if err != nil {
+			return nil, err
+		}
+		event.At = event.At.UTC()
+		if err := unmarshalNullJSON(cards, &event.Cards); err != nil {
+			return nil, err
+		}
+		if err := unmarshalNullJSON(state, &event.State); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// Reserve stores the pending record if there is no unexpired record of its key
+// Expired records are evicted on reservation
+func (ds *deckSQL) Reserve(rec *IdempotencyRecord) (*IdempotencyRecord, error) {
+	var stored *IdempotencyRecord
+	err := ds.inTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(ds.dialect.rebind(`DELETE FROM idempotency_keys WHERE expires_at < ?`), time.Now().UTC())
+		if err != nil {
+			return err
+		}
+		res, err := tx.Exec(ds.dialect.rebind(`INSERT INTO idempotency_keys (idempotency_key, fingerprint, expires_at) `+
+			`VALUES (?, ?, ?) ON CONFLICT DO NOTHING`), rec.Key, rec.Fingerprint, rec.ExpiresAt.UTC())
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 1 {
+			return err
+		}
+
+		stored = &IdempotencyRecord{Key: rec.Key}
+		var header, body sql.NullString
+		row := tx.QueryRow(ds.dialect.rebind(`SELECT fingerprint, status, header, body, expires_at `+
+			`FROM idempotency_keys WHERE idempotency_key = ?`), rec.Key)
+		if err := row.Scan(&stored.Fingerprint, &stored.Status, &header, &body, &stored.ExpiresAt); err != nil {
+			return err
+		}
+		if body.Valid {
+			stored.Body = []byte(body.String)
+		}
+		stored.ExpiresAt = stored.ExpiresAt.UTC()
+		return unmarshalNullJSON(header, &stored.Header)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stored, nil
+}
+
+// Save stores the response of the reserved record
+// Returns ErrNotFound if record is not reserved
+func (ds *deckSQL) Save(rec *IdempotencyRecord) error {
+	var header sql.NullString
+	if rec.Header != nil {
+		var err error
+		if header, err = marshalNullJSON(rec.Header); err != nil {
+			return err
+		}
+	}
+	res, err := ds.db.Exec(ds.dialect.rebind(`UPDATE idempotency_keys SET status = ?, header = ?, body = ? `+
+		`WHERE idempotency_key = ?`), rec.Status, header, string(rec.Body), rec.Key)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Release removes the pending record of the key so its request can be retried
+func (ds *deckSQL) Release(key string) error {
+	_, err := ds.db.Exec(ds.dialect.rebind(`DELETE FROM idempotency_keys WHERE idempotency_key = ? AND status = 0`), key)
+	return err
+}
+
+// insertCards persists cards, drawn cards and piles of the given deck by their order
+func (ds *deckSQL) insertCards(tx *sql.Tx, deck *Deck) error {
+	if err := ds.insertCardRows(tx, `deck_cards`, deck.UUID, deck.Cards); err != nil {
+		return err
+	}
+	if err := ds.insertCardRows(tx, `deck_drawn_cards`, deck.UUID, deck.Drawn); err != nil {
+		return err
+	}
+	for name, pile := range deck.Piles {
+		revealed, err := marshalNullJSON(pile.Revealed)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ds.dialect.rebind(
+			`INSERT INTO deck_piles (deck_uuid, name, owner, revealed) VALUES (?, ?, ?, ?)`),
+			deck.UUID, name, pile.Owner, revealed)
+		if err != nil {
+			return err
+		}
+		if err := ds.insertCardRows(tx, `deck_pile_cards`, deck.UUID, pile.Cards, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insertCardRows inserts cards with their positions into the given cards table
+// Optional pile name is stored for the pile cards table
+func (ds *deckSQL) insertCardRows(tx *sql.Tx, table string, uuid string, cards []*Card, pile ...string) error {
+	if len(cards) == 0 {
+		return nil
+	}
+	columns, prefix := `deck_uuid, position`, []interface{}{uuid}
+	if len(pile) > 0 {
+		columns, prefix = `deck_uuid, pile, position`, []interface{}{uuid, pile[0]}
+	}
+	stmt, err := tx.Prepare(ds.dialect.rebind(
+		`INSERT INTO ` + table + ` (` + columns + `, value, suit, code) VALUES (?` +
+			strings.Repeat(", ?", len(prefix)+3) + `)`))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for i, card := range cards {
+		args := append(append([]interface{}{}, prefix...), i, card.Value, card.Suit, card.Code)
+		if _, err := stmt.Exec(args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// marshalNullJSON encodes v as json, nil values are encoded as NULL
+func marshalNullJSON(v interface{}) (sql.NullString, error) {
+	if v == nil || reflect.ValueOf(v).IsNil() {
+		return sql.NullString{}, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(b), Valid: true}, nil
+}
+
+// unmarshalNullJSON decodes json column into the value pointed by v
+// NULL values leave v untouched
+func unmarshalNullJSON(ns sql.NullString, v interface{}) error {
+	if !ns.Valid {
+		return nil
+	}
+	return json.Unmarshal([]byte(ns.String), v)
+}
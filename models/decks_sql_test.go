@@ -0,0 +1,158 @@
+package models
+
+import (
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// openTestSQLite opens a sqlite database on a temporary file
+func openTestSQLite(t *testing.T) *sql.DB {
+	dsn := "file:" + filepath.Join(t.TempDir(), "decks.db") + "?_foreign_keys=on&_busy_timeout=5000"
+	db, err := sql.Open(string(DialectSQLite), dsn)
+	if err != nil {
+		t.Fatalf("sql.Open() err = %s, want nil", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestNewDeckSQL(t *testing.T) {
+	db := openTestSQLite(t)
+
+	t.Run("unsupported dialect", func(t *testing.T) {
+		if _, err := NewDeckSQL(db, Dialect("oracle")); err != ErrDialectUnsupported {
+			t.Errorf("NewDeckSQL() err = %v, want ErrDialectUnsupported", err)
+		}
+	})
+
+	t.Run("migrations applied once", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			if _, err := NewDeckSQL(db, DialectSQLite); err != nil {
+				t.Fatalf("NewDeckSQL() err = %s, want nil", err)
+			}
+		}
+		var count int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM schema_migrations`).Scan(&count); err != nil {
+			t.Fatalf("count migrations err = %s, want nil", err)
+		}
+		if count != len(deckSQLMigrations) {
+			t.Errorf("migrations got = %v, want %v", count, len(deckSQLMigrations))
+		}
+	})
+}
+
+func TestDeckSQL(t *testing.T) {
+	ds, err := NewDeckSQL(openTestSQLite(t), DialectSQLite)
+	if err != nil {
+		t.Fatalf("NewDeckSQL() err = %s, want nil", err)
+	}
+	t.Run("cards order", func(t *testing.T) {
+		deck := Deck{UUID: "0b0c1b9e-6b7e-4a57-9c53-6f0a5c1e7d11", Cards: allCards[10:20], Remaining: 10}
+		if err := ds.Create(&deck); err != nil {
+			t.Fatalf("Create() err = %s, want nil", err)
+		}
+		found, err := ds.ByUUID(deck.UUID)
+		if err != nil {
+			t.Fatalf("ByUUID() err = %s, want nil", err)
+		}
+		if !reflect.DeepEqual(found, &deck) {
+			t.Errorf("ByUUID() got = %v, want %v", found, &deck)
+		}
+	})
+
+	t.Run("update not found", func(t *testing.T) {
+		deck := Deck{UUID: "5f4d2f7e-1d7e-4c1a-8e7c-1d2b9a0e3c44"}
+		if err := ds.Update(&deck); err != ErrNotFound {
+			t.Errorf("Update() err = %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestDeckService_SQL(t *testing.T) {
+	storage, err := NewDeckSQL(openTestSQLite(t), DialectSQLite)
+	if err != nil {
+		t.Fatalf("NewDeckSQL() err = %s, want nil", err)
+	}
+	ds := NewDeckService(NewCardService(), WithDeckStorage(storage))
+	deck := Deck{}
+	if err := ds.Create(&deck); err != nil {
+		t.Fatalf("Create() err = %s, want nil", err)
+	}
+
+	cards, err := ds.Draw(&deck, 3)
+	if err != nil {
+		t.Fatalf("Draw() err = %s, want nil", err)
+	}
+	if !reflect.DeepEqual(cards, allCards[:3]) {
+		t.Errorf("Draw() got = %v, want %v", cards, allCards[:3])
+	}
+
+	found, err := ds.ByUUID(deck.UUID)
+	if err != nil {
+		t.Fatalf("ByUUID() err = %s, want nil", err)
+	}
+	if !reflect.DeepEqual(found.Cards, allCards[3:]) || found.Remaining != len(allCards)-3 {
+		t.Errorf("ByUUID() got = %v, want remaining %v", found, allCards[3:])
+	}
+}
+
+func TestDialect_rebind(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect Dialect
+		query   string
+		want    string
+	}{
+		{
+			name:    "sqlite",
+			dialect: DialectSQLite,
+			query:   "SELECT a FROM b WHERE c = ? AND d = ?",
+			want:    "SELECT a FROM b WHERE c = ? AND d = ?",
+		},
+		{
+			name:    "postgres",
+			dialect: DialectPostgres,
+			query:   "SELECT a FROM b WHERE c = ? AND d = ?",
+			want:    "SELECT a FROM b WHERE c = $1 AND d = $2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.dialect.rebind(tt.query); got != tt.want {
+				t.Errorf("rebind() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeckSQL_EventInUpdateTx(t *testing.T) {
+	storage, err := NewDeckSQL(openTestSQLite(t), DialectSQLite)
+	if err != nil {
+		t.Fatalf("NewDeckSQL() err = %s, want nil", err)
+	}
+	ds := NewDeckService(NewCardService(), WithDeckStorage(storage))
+	deck := &Deck{}
+	if err := ds.Create(deck); err != nil {
+		t.Fatalf("Create() err = %s, want nil", err)
+	}
+	// the event of the next version is taken, so appending the event of the draw fails
+	taken := &DeckEvent{DeckID: deck.UUID, Seq: deck.Version + 1, Type: EventUpdated}
+	if err := storage.(DeckEventLog).AppendEvent(taken); err != nil {
+		t.Fatalf("AppendEvent() err = %s, want nil", err)
+	}
+	if _, err := ds.Draw(deck, 1); err == nil {
+		t.Fatalf("Draw() err = nil, want the failed event append")
+	}
+	found, err := ds.ByUUID(deck.UUID)
+	if err != nil {
+		t.Fatalf("ByUUID() err = %s, want nil", err)
+	}
+	if found.Remaining != 52 || found.Version != 1 {
+		t.Errorf("ByUUID() got remaining %v and version %v, want the draw rolled back", found.Remaining, found.Version)
+	}
+}
@@ -3,12 +3,14 @@ package models
 import (
 	"github.com/google/uuid"
 	"reflect"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestNewDeckService(t *testing.T) {
 	cs := cardService{}
-	dv := deckValidator{DeckStorage: &deckMemory{decks: map[string]Deck{}}, cs: &cs}
+	dv := deckValidator{DeckStorage: &deckMemory{decks: map[string]Deck{}}, cs: &cs, shufflers: &shufflers{}}
 	type args struct {
 		cs CardService
 	}
@@ -20,7 +22,14 @@ func TestNewDeckService(t *testing.T) {
 		{
 			name: "default service",
 			args: args{cs: &cs},
-			want: &deckService{DeckStorage: &dv},
+			want: &deckService{
+				DeckStorage: &dv,
+				shufflers:   &shufflers{},
+				lister:      dv.DeckStorage.(DeckLister),
+				deleter:     dv.DeckStorage.(DeckDeleter),
+				events:      dv.DeckStorage.(DeckEventLog),
+				undoDepth:   DefaultUndoDepth,
+			},
 		},
 	}
 	for _, tt := range tests {
@@ -32,57 +41,6 @@ func TestNewDeckService(t *testing.T) {
 	}
 }
 
-func testDeckStorage(ds DeckStorage) func(t *testing.T) {
-	return func(t *testing.T) {
-		uuidStr := uuid.NewString()
-		uuidStrUnused := uuid.NewString()
-		deck := Deck{UUID: uuidStr}
-
-		t.Run("Create", func(t *testing.T) {
-			if err := ds.Create(&deck); err != nil {
-				t.Errorf("Create() err = %s, want nil", err)
-			}
-		})
-
-		t.Run("Update", func(t *testing.T) {
-			deck.Remaining = 1
-			if err := ds.Update(&deck); err != nil {
-				t.Errorf("Update() err = %s, want nil", err)
-			}
-		})
-
-		t.Run("ByUID", func(t *testing.T) {
-			if _, err := ds.ByUUID(uuidStrUnused); err != ErrNotFound {
-				t.Errorf("ByID(UUID) err = nil, want ErrNotFound")
-			}
-
-			foundDeck, err := ds.ByUUID(uuidStr)
-			if err != nil {
-				t.Errorf("ByID(UUID) err = %s, want nil", err)
-			}
-
-			if !reflect.DeepEqual(&deck, foundDeck) {
-				t.Errorf("ByID(UUID) got = %v, want %v", foundDeck, &deck)
-			}
-		})
-	}
-}
-
-func TestDeckMemory(t *testing.T) {
-	ds := deckMemory{decks: map[string]Deck{}}
-	t.Run("TestDeckMemory", testDeckStorage(&ds))
-}
-
-func TestDeckService(t *testing.T) {
-	ds := NewDeckService(NewCardService())
-	t.Run("TestDeckService", testDeckStorage(ds))
-}
-
-func TestDeckValidator(t *testing.T) {
-	ds := newDeckValidator(&deckMemory{decks: map[string]Deck{}}, NewCardService())
-	t.Run("TestDeckValidator", testDeckStorage(ds))
-}
-
 func Test_deckService_Draw(t *testing.T) {
 	uuidStr := uuid.NewString()
 	deck := Deck{UUID: uuidStr, Cards: allCards, Remaining: len(allCards)}
@@ -127,6 +85,13 @@ func Test_deckService_Draw(t *testing.T) {
 			want:    nil,
 			wantErr: true,
 		},
+		{
+			name:    "negative count",
+			fields:  fields{&dm},
+			args:    args{&deck, -1},
+			want:    nil,
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -165,7 +130,7 @@ func Test_newDeckValidator(t *testing.T) {
 		{
 			name: "default",
 			args: args{&deckMemory{}, NewCardService()},
-			want: &deckValidator{&deckMemory{}, NewCardService()},
+			want: &deckValidator{DeckStorage: &deckMemory{}, cs: NewCardService()},
 		},
 	}
 	for _, tt := range tests {
@@ -236,6 +201,7 @@ func Test_deckValidator_Create(t *testing.T) {
 		cs:          cs,
 	}
 	validUUID := uuid.NewString()
+	createdAt := time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
 	tests := []struct {
 		name    string
 		deck    *Deck
@@ -250,14 +216,23 @@ func Test_deckValidator_Create(t *testing.T) {
 		},
 		{
 			name:    "valid fill cards",
-			deck:    &Deck{UUID: validUUID},
-			want:    &Deck{UUID: validUUID, Remaining: 52, Cards: allCards},
+			deck:    &Deck{UUID: validUUID, CreatedAt: createdAt},
+			want:    &Deck{UUID: validUUID, CreatedAt: createdAt, Remaining: 52, Cards: allCards, Shuffler: ShufflerMath, Version: 1},
+			wantErr: false,
+		},
+		{
+			name: "valid joker card codes",
+			deck: &Deck{UUID: validUUID, CreatedAt: createdAt, CardCodes: "AS,XB"},
+			want: &Deck{UUID: validUUID, CreatedAt: createdAt, Remaining: 2, Shuffler: ShufflerMath, Version: 1, Cards: []*Card{
+				NewCard(ValueAce, SuitSpades),
+				NewCard(ValueJoker, SuitBlack),
+			}},
 			wantErr: false,
 		},
 		{
 			name: "valid card codes",
-			deck: &Deck{UUID: validUUID, CardCodes: "AS,10D"},
-			want: &Deck{UUID: validUUID, Remaining: 2, Cards: []*Card{
+			deck: &Deck{UUID: validUUID, CreatedAt: createdAt, CardCodes: "AS,10D"},
+			want: &Deck{UUID: validUUID, CreatedAt: createdAt, Remaining: 2, Shuffler: ShufflerMath, Version: 1, Cards: []*Card{
 				NewCard(ValueAce, SuitSpades),
 				NewCard(Value("10"), SuitDiamonds),
 			}},
@@ -275,6 +250,65 @@ func Test_deckValidator_Create(t *testing.T) {
 		})
 	}
 
+	t.Run("created at", func(t *testing.T) {
+		before := time.Now()
+		deck := Deck{}
+		if err := dv.Create(&deck); err != nil {
+			t.Fatalf("Create() error = %v, want nil", err)
+		}
+		if deck.CreatedAt.Before(before.Truncate(time.Microsecond)) || deck.CreatedAt.After(time.Now()) {
+			t.Errorf("Create() created at = %v, want now", deck.CreatedAt)
+		}
+	})
+
+	t.Run("composition", func(t *testing.T) {
+		deck := Deck{Composition: &Composition{Name: CompositionPiquet, Jokers: 1}}
+		if err := dv.Create(&deck); err != nil {
+			t.Fatalf("Create() error = %v, want nil", err)
+		}
+		if deck.Remaining != 33 {
+			t.Errorf("Create() remaining got = %v, want 33", deck.Remaining)
+		}
+	})
+
+	t.Run("invalid composition", func(t *testing.T) {
+		deck := Deck{Composition: &Composition{Name: "canasta"}}
+		if err := dv.Create(&deck); err != ErrCompositionUnknown {
+			t.Errorf("Create() error = %v, want ErrCompositionUnknown", err)
+		}
+	})
+
+	t.Run("shoe", func(t *testing.T) {
+		deck := Deck{Decks: 6, Penetration: 0.75, Shuffled: true}
+		if err := dv.Create(&deck); err != nil {
+			t.Fatalf("Create() error = %v, want nil", err)
+		}
+		if deck.Remaining != 312 {
+			t.Errorf("Create() remaining got = %v, want 312", deck.Remaining)
+		}
+		if deck.CutCard != 234 {
+			t.Errorf("Create() cut card got = %v, want 234", deck.CutCard)
+		}
+		counts := map[string]int{}
+		for _, card := range deck.Cards {
+			counts[card.Code]++
+		}
+		for _, card := range allCards {
+			if counts[card.Code] != 6 {
+				t.Errorf("Create() count of %s got = %v, want 6", card.Code, counts[card.Code])
+			}
+		}
+	})
+
+	t.Run("invalid shoe", func(t *testing.T) {
+		if err := dv.Create(&Deck{Decks: 9}); err != ErrDecksInvalid {
+			t.Errorf("Create() error = %v, want ErrDecksInvalid", err)
+		}
+		if err := dv.Create(&Deck{Decks: 2, Penetration: 1}); err != ErrPenetrationInvalid {
+			t.Errorf("Create() error = %v, want ErrPenetrationInvalid", err)
+		}
+	})
+
 	t.Run("empty uuid", func(t *testing.T) {
 		deck := Deck{}
 		_ = dv.Create(&deck)
@@ -305,6 +339,7 @@ func Test_deckValidator_Update(t *testing.T) {
 		cs:          cs,
 	}
 	validUUID := uuid.NewString()
+	_ = ds.Create(&Deck{UUID: validUUID})
 
 	tests := []struct {
 		name    string
@@ -314,8 +349,8 @@ func Test_deckValidator_Update(t *testing.T) {
 	}{
 		{
 			name:    "valid",
-			deck:    &Deck{UUID: validUUID},
-			want:    &Deck{UUID: validUUID},
+			deck:    &Deck{UUID: validUUID, Version: 1},
+			want:    &Deck{UUID: validUUID, Version: 2},
 			wantErr: false,
 		},
 		{
@@ -326,10 +361,16 @@ func Test_deckValidator_Update(t *testing.T) {
 		},
 		{
 			name:    "remaining",
-			deck:    &Deck{UUID: validUUID, Cards: allCards[0:5]},
-			want:    &Deck{UUID: validUUID, Cards: allCards[0:5], Remaining: 5},
+			deck:    &Deck{UUID: validUUID, Cards: allCards[0:5], Version: 2},
+			want:    &Deck{UUID: validUUID, Cards: allCards[0:5], Remaining: 5, Version: 3},
 			wantErr: false,
 		},
+		{
+			name:    "version mismatch",
+			deck:    &Deck{UUID: validUUID, Version: 1},
+			want:    &Deck{UUID: validUUID, Version: 1},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -342,3 +383,336 @@ func Test_deckValidator_Update(t *testing.T) {
 		})
 	}
 }
+
+func TestDeckMemory_Concurrent(t *testing.T) {
+	dm := deckMemory{decks: map[string]Deck{}}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			deck := Deck{UUID: uuid.NewString(), Cards: allCards}
+			if err := dm.Create(&deck); err != nil {
+				t.Errorf("Create() err = %s, want nil", err)
+				return
+			}
+			for j := 0; j < 10; j++ {
+				found, err := dm.ByUUID(deck.UUID)
+				if err != nil {
+					t.Errorf("ByUUID() err = %s, want nil", err)
+					return
+				}
+				found.Cards = found.Cards[1:]
+				if err := dm.Update(found); err != nil {
+					t.Errorf("Update() err = %s, want nil", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, deck := range dm.decks {
+		if got, want := len(deck.Cards), len(allCards)-10; got != want {
+			t.Errorf("len(Cards) got = %v, want %v", got, want)
+		}
+	}
+}
+
+func Test_deckService_Draw_Concurrent(t *testing.T) {
+	ds := NewDeckService(NewCardService())
+	deck := Deck{}
+	if err := ds.Create(&deck); err != nil {
+		t.Fatalf("Create() err = %s, want nil", err)
+	}
+
+	mu := sync.Mutex{}
+	drawn := map[string]int{}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				// every goroutine works on its own stale copy of the deck
+				stale := Deck{UUID: deck.UUID, Cards: deck.Cards, Remaining: deck.Remaining}
+				cards, err := ds.Draw(&stale, 1)
+				if err == ErrNotEnoughCards {
+					return
+				}
+				if err != nil {
+					t.Errorf("Draw() err = %s, want nil", err)
+					return
+				}
+				mu.Lock()
+				drawn[cards[0].Code]++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(drawn) != len(allCards) {
+		t.Errorf("Draw() distinct cards got = %v, want %v", len(drawn), len(allCards))
+	}
+	for code, n := range drawn {
+		if n != 1 {
+			t.Errorf("Draw() card %s drawn %v times, want 1", code, n)
+		}
+	}
+}
+
+func Test_deckService_Open_Concurrent(t *testing.T) {
+	ds := NewDeckService(NewCardService())
+	deck := Deck{}
+	if err := ds.Create(&deck); err != nil {
+		t.Fatalf("Create() err = %s, want nil", err)
+	}
+
+	mu := sync.Mutex{}
+	count := 0
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			stale := Deck{UUID: deck.UUID}
+			cards, err := ds.Draw(&stale, 1)
+			if err == nil {
+				mu.Lock()
+				count += len(cards)
+				mu.Unlock()
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			stale := Deck{UUID: deck.UUID}
+			_ = ds.Open(&stale)
+		}()
+	}
+	wg.Wait()
+
+	found, err := ds.ByUUID(deck.UUID)
+	if err != nil {
+		t.Fatalf("ByUUID() err = %s, want nil", err)
+	}
+	if !found.Opened {
+		t.Errorf("Open() opened = false, want true")
+	}
+	if got, want := found.Remaining, len(allCards)-count; got != want {
+		t.Errorf("Remaining got = %v, want %v", got, want)
+	}
+}
+
+func Test_deckService_Draw_Shoe(t *testing.T) {
+	ds := NewDeckService(NewCardService())
+	deck := Deck{Decks: 2, Penetration: 0.5}
+	if err := ds.Create(&deck); err != nil {
+		t.Fatalf("Create() err = %s, want nil", err)
+	}
+
+	counts := map[string]int{}
+	for i := 0; i < 104; i += 4 {
+		cards, err := ds.Draw(&deck, 4)
+		if err != nil {
+			t.Fatalf("Draw() err = %s, want nil", err)
+		}
+		for _, card := range cards {
+			counts[card.Code]++
+		}
+		if want := deck.Dealt >= 52; deck.Reshuffle != want {
+			t.Errorf("Draw() reshuffle after %v cards got = %v, want %v", deck.Dealt, deck.Reshuffle, want)
+		}
+	}
+
+	for _, card := range allCards {
+		if counts[card.Code] != 2 {
+			t.Errorf("Draw() count of %s got = %v, want 2", card.Code, counts[card.Code])
+		}
+	}
+}
+
+func Test_deckService_Return(t *testing.T) {
+	tests := []struct {
+		name     string
+		codes    []string
+		position string
+		wantTop  []*Card
+		wantLast []*Card
+		wantErr  error
+	}{
+		{
+			name:    "default top",
+			codes:   []string{"2s", "AS"},
+			wantTop: []*Card{allCards[1], allCards[0], allCards[3]},
+		},
+		{
+			name:     "bottom",
+			codes:    []string{"AS"},
+			position: PositionBottom,
+			wantTop:  []*Card{allCards[3]},
+			wantLast: []*Card{allCards[0]},
+		},
+		{
+			name:     "random",
+			codes:    []string{"AS", "2S"},
+			position: PositionRandom,
+		},
+		{
+			name:     "invalid position",
+			codes:    []string{"AS"},
+			position: "middle",
+			wantErr:  ErrPositionInvalid,
+		},
+		{
+			name:    "never part of the deck",
+			codes:   []string{"XB"},
+			wantErr: ErrCardsNotDrawn,
+		},
+		{
+			name:    "not drawn",
+			codes:   []string{"KH"},
+			wantErr: ErrCardsNotDrawn,
+		},
+		{
+			name:    "returned twice",
+			codes:   []string{"AS", "AS"},
+			wantErr: ErrCardsNotDrawn,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ds := NewDeckService(NewCardService())
+			deck := Deck{}
+			_ = ds.Create(&deck)
+			_, _ = ds.Draw(&deck, 3)
+
+			err := ds.Return(&deck, tt.codes, tt.position)
+			if err != tt.wantErr {
+				t.Fatalf("Return() err = %v, want %v", err, tt.wantErr)
+			}
+			found, _ := ds.ByUUID(deck.UUID)
+			if err != nil {
+				if found.Remaining != len(allCards)-3 || len(found.Drawn) != 3 {
+					t.Errorf("Return() failed but changed the deck %v", found)
+				}
+				return
+			}
+			if found.Remaining != len(allCards)-3+len(tt.codes) {
+				t.Errorf("Return() remaining got = %v, want %v", found.Remaining, len(allCards)-3+len(tt.codes))
+			}
+			if len(found.Drawn) != 3-len(tt.codes) {
+				t.Errorf("Return() drawn got = %v, want %v", len(found.Drawn), 3-len(tt.codes))
+			}
+			if got := found.Cards[:len(tt.wantTop)]; !reflect.DeepEqual(got, tt.wantTop) && len(tt.wantTop) > 0 {
+				t.Errorf("Return() top got = %v, want %v", got, tt.wantTop)
+			}
+			if got := found.Cards[len(found.Cards)-len(tt.wantLast):]; !reflect.DeepEqual(got, tt.wantLast) && len(tt.wantLast) > 0 {
+				t.Errorf("Return() bottom got = %v, want %v", got, tt.wantLast)
+			}
+		})
+	}
+}
+
+func Test_deckService_Shuffle(t *testing.T) {
+	ds := NewDeckService(NewCardService())
+	deck := Deck{Decks: 2, Penetration: 0.25}
+	_ = ds.Create(&deck)
+	_, _ = ds.Draw(&deck, 30)
+	_ = ds.AddToPile(&deck, DiscardPile, nil)
+	if !deck.Reshuffle {
+		t.Fatalf("Draw() reshuffle = false, want true")
+	}
+
+	if err := ds.Shuffle(&deck, ShuffleOptions{}); err != nil {
+		t.Fatalf("Shuffle() err = %s, want nil", err)
+	}
+	if !deck.Shuffled || deck.Reshuffle || deck.Dealt != 0 {
+		t.Errorf("Shuffle() shuffled/reshuffle/dealt = %v/%v/%v, want true/false/0", deck.Shuffled, deck.Reshuffle, deck.Dealt)
+	}
+	if deck.Remaining != 104-30 {
+		t.Errorf("Shuffle() remaining got = %v, want %v", deck.Remaining, 104-30)
+	}
+	if reflect.DeepEqual(deck.Cards, append(allCards[30:], allCards...)) {
+		t.Errorf("Shuffle() not shuffled")
+	}
+
+	if err := ds.Shuffle(&deck, ShuffleOptions{Discarded: true}); err != nil {
+		t.Fatalf("Shuffle() err = %s, want nil", err)
+	}
+	if deck.Remaining != 104 || deck.Piles[DiscardPile].Remaining != 0 {
+		t.Errorf("Shuffle() remaining got = %v, want 104", deck.Remaining)
+	}
+	counts := map[string]int{}
+	for _, card := range deck.Cards {
+		counts[card.Code]++
+	}
+	for _, card := range allCards {
+		if counts[card.Code] != 2 {
+			t.Errorf("Shuffle() count of %s got = %v, want 2", card.Code, counts[card.Code])
+		}
+	}
+
+	_ = ds.Open(&deck)
+	if err := ds.Shuffle(&deck, ShuffleOptions{}); err != ErrDeckOpened {
+		t.Errorf("Shuffle() err = %v, want ErrDeckOpened", err)
+	}
+}
+
+func Test_deckService_Peek(t *testing.T) {
+	ds := NewDeckService(NewCardService())
+	deck := Deck{CardCodes: "AS,KH,QD"}
+	if err := ds.Create(&deck); err != nil {
+		t.Fatalf("Create() err = %s, want nil", err)
+	}
+	tests := []struct {
+		name    string
+		count   int
+		want    []*Card
+		wantErr error
+	}{
+		{name: "top", count: 2, want: deck.Cards[:2]},
+		{name: "none", count: 0, want: []*Card{}},
+		{name: "negative", count: -1, wantErr: ErrCountInvalid},
+		{name: "not enough", count: 4, wantErr: ErrNotEnoughCards},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ds.Peek(&deck, tt.count)
+			if err != tt.wantErr {
+				t.Fatalf("Peek() err = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) && tt.wantErr == nil {
+				t.Errorf("Peek() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	stored, _ := ds.ByUUID(deck.UUID)
+	if stored.Remaining != 3 || len(stored.Drawn) != 0 {
+		t.Errorf("Peek() changed the deck, remaining/drawn = %v/%v, want 3/0", stored.Remaining, len(stored.Drawn))
+	}
+}
+
+func Test_deckService_IfMatch(t *testing.T) {
+	ds := NewDeckService(NewCardService())
+	deck := &Deck{}
+	if err := ds.Create(deck); err != nil {
+		t.Fatalf("Create() err = %s, want nil", err)
+	}
+
+	stale := &Deck{UUID: deck.UUID, IfMatch: deck.Version}
+	deck.IfMatch = deck.Version
+	if _, err := ds.Draw(deck, 1); err != nil {
+		t.Fatalf("Draw() err = %s, want nil", err)
+	}
+	if deck.Version != 2 {
+		t.Errorf("Draw() Version = %v, want 2", deck.Version)
+	}
+	if err := ds.Open(stale); err != ErrVersionMismatch {
+		t.Errorf("Open() err = %v, want ErrVersionMismatch", err)
+	}
+	if _, err := ds.Draw(deck, 1); err != nil {
+		t.Errorf("Draw() without IfMatch err = %v, want nil", err)
+	}
+}
@@ -0,0 +1,272 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrEventsNotSupported = errors.New("deck storage does not support events")
+	ErrEventNotFound      = errors.New("event not found")
+)
+
+// Types of the deck events
+const (
+	EventCreated     = "created"
+	EventUpdated     = "updated"
+	EventDrawn       = "drawn"
+	EventReturned    = "returned"
+	EventShuffled    = "shuffled"
+	EventOpened      = "opened"
+	EventPileAdded   = "pile_added"
+	EventPileDrawn   = "pile_drawn"
+	EventCardsMoved  = "cards_moved"
+	EventUndone      = "undone"
+	EventPileClaimed = "pile_claimed"
+	EventDealt       = "dealt"
+	EventRevealed    = "revealed"
+	EventGranted     = "granted"
+	EventACLChanged  = "acl_changed"
+	EventShared      = "shared"
+	EventUnshared    = "unshared"
+)
+
+// DeckEvent is a recorded mutation of the deck
+// Seq is the version of the deck after the mutation, Cards are the codes of the affected cards
+// Cards put in a hand are not recorded
+// Reverts is the sequence of the event reverted by an undo event
+// State is the deck state after the mutation, it is not marshaled to keep the card order secret
+type DeckEvent struct {
+	DeckID  string     `json:"deck_id"`
+	Seq     int        `json:"seq"`
+	Type    string     `json:"type"`
+	At      time.Time  `json:"at"`
+	Actor   string     `json:"actor,omitempty"`
+	Cards   []string   `json:"cards,omitempty"`
+	Pile    string     `json:"pile,omitempty"`
+	To      string     `json:"to,omitempty"`
+	Reverts int        `json:"reverts,omitempty"`
+	State   *DeckState `json:"-"`
+}
+
+// DeckState is the mutable state of the deck recorded by the events
+type DeckState struct {
+	Cards     []*Card          `json:"cards"`
+	Drawn     []*Card          `json:"drawn,omitempty"`
+	Piles     map[string]*Pile `json:"piles,omitempty"`
+	Shuffled  bool             `json:"shuffled"`
+	Opened    bool             `json:"opened"`
+	Dealt     int              `json:"dealt"`
+	Reshuffle bool             `json:"reshuffle"`
+	Nonce     int              `json:"nonce"`
+}
+
+// DeckEventLog is implemented by the storages which can record deck events
+// Storages implementing it must append the PendingEvent of the deck in the same transaction as its Create and Update
+// Storages are not required to implement it
+type DeckEventLog interface {
+	// AppendEvent appends the event to the events of its deck
+	AppendEvent(event *DeckEvent) error
+	// Events returns the events of the deck after the sequence in order
+	// All remaining events are returned if limit is not positive
+	Events(uuid string, after, limit int) ([]*DeckEvent, error)
+}
+
+// DeckEventPage is a page of the deck events
+// Next is the sequence to continue after, zero on the last page
+type DeckEventPage struct {
+	Events []*DeckEvent
+	Limit  int
+	Next   int
+}
+
+// Events returns the page of the deck events after the sequence
+// Returns ErrEventsNotSupported if storage does not implement DeckEventLog
+// Returns ErrLimitInvalid if limit is out of range
+func (ds *deckService) Events(uuid string, after, limit int) (DeckEventPage, error) {
+	if ds.events == nil {
+		return DeckEventPage{}, ErrEventsNotSupported
+	}
+	if limit == 0 {
+		limit = DefaultListLimit
+	}
+	if limit < 1 || limit > MaxListLimit {
+		return DeckEventPage{}, ErrLimitInvalid
+	}
+	if _, err := ds.ByUUID(uuid); err != nil {
+		return DeckEventPage{}, err
+	}
+	events, err := ds.events.Events(uuid, after, limit+1)
+	if err != nil {
+		return DeckEventPage{}, err
+	}
+	page := DeckEventPage{Events: events, Limit: limit}
+	if len(events) > limit {
+		page.Events = events[:limit]
+		page.Next = events[limit-1].Seq
+	}
+	return page, nil
+}
+
+// Replay returns the deck in its state after the event of the sequence
+// Returns ErrEventsNotSupported if storage does not implement DeckEventLog
+// Returns ErrEventNotFound if deck has no event of the sequence
+func (ds *deckService) Replay(uuid string, seq int) (*Deck, error) {
+	if ds.events == nil {
+		return nil, ErrEventsNotSupported
+	}
+	deck, err := ds.ByUUID(uuid)
+	if err != nil {
+		return nil, err
+	}
+	events, err := ds.events.Events(uuid, seq-1, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(events) == 0 || events[0].Seq != seq || events[0].State == nil {
+		return nil, ErrEventNotFound
+	}
+	deck.setState(events[0].State)
+	deck.Version = seq
+	return deck, nil
+}
+
+// pend completes the event of the deck mutation and sets it as the pending event of the deck
+// if storage implements DeckEventLog, so the storage appends it with the mutation
+func (ds *deckService) pend(deck *Deck, event *DeckEvent) *DeckEvent {
+	event.At = time.Now().UTC().Truncate(time.Microsecond)
+	event.Actor = deck.Actor
+	if ds.events != nil {
+		deck.pending = event
+	}
+	return event
+}
+
+// record publishes the event of the persisted deck mutation to the hub and notifies the webhooks
+func (ds *deckService) record(deck *Deck, event *DeckEvent) {
+	deck.pending = nil
+	event.DeckID = deck.UUID
+	event.Seq = deck.Version
+	if ds.hub != nil {
+		published := *event
+		ds.hub.Publish(&published)
+	}
+	if ds.webhooks != nil {
+		ds.webhooks.Notify(deck, *event)
+	}
+}
+
+// PendingEvent returns the event of the mutation being persisted with the deck, nil if there is none
+// DeckID, Seq and State of the event are the uuid, version and state of the deck,
+// so storages call it after incrementing the version
+func (d *Deck) PendingEvent() *DeckEvent {
+	if d.pending == nil {
+		return nil
+	}
+	event := copyDeckEvent(d.pending)
+	event.DeckID = d.UUID
+	event.Seq = d.Version
+	event.State = d.state()
+	return &event
+}
+
+// state returns the copy of the deck state
+func (d *Deck) state() *DeckState {
+	c := copyDeck(d)
+	return &DeckState{
+		Cards:     c.Cards,
+		Drawn:     c.Drawn,
+		Piles:     c.Piles,
+		Shuffled:  c.Shuffled,
+		Opened:    c.Opened,
+		Dealt:     c.Dealt,
+		Reshuffle: c.Reshuffle,
+		Nonce:     c.Nonce,
+	}
+}
+
+// setState replaces the deck state by the copy of the given state
+func (d *Deck) setState(s *DeckState) {
+	c := copyDeck(&Deck{Cards: s.Cards, Drawn: s.Drawn, Piles: s.Piles})
+	d.Cards = c.Cards
+	d.Drawn = c.Drawn
+	d.Piles = c.Piles
+	d.Remaining = len(c.Cards)
+	d.Shuffled = s.Shuffled
+	d.Opened = s.Opened
+	d.Dealt = s.Dealt
+	d.Reshuffle = s.Reshuffle
+	d.Nonce = s.Nonce
+}
+
+// cardCodesOf returns the codes of the cards
+func cardCodesOf(cards []*Card) []string {
+	if len(cards) == 0 {
+		return nil
+	}
+	codes := make([]string, len(cards))
+	for i, card := range cards {
+		codes[i] = card.Code
+	}
+	return codes
+}
+
+// Bounds of the events kept per deck by the storages
+// Oldest events are dropped beyond EventLimit, states of the events
+// older than the latest EventStates are dropped so they can not be replayed or undone
+const (
+	EventLimit  = 1000
+	EventStates = 100
+)
+
+// AppendEvent appends the event to the events of its deck
+func (dm *deckMemory) AppendEvent(event *DeckEvent) error {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	dm.appendEvent(event)
+	return nil
+}
+
+// appendEvent appends the event within the bounds of the deck events, caller must hold the lock
+func (dm *deckMemory) appendEvent(event *DeckEvent) {
+	if dm.events == nil {
+		dm.events = map[string][]DeckEvent{}
+	}
+	events := append(dm.events[event.DeckID], copyDeckEvent(event))
+	if n := len(events); n > EventStates {
+		events[n-1-EventStates].State = nil
+	}
+	if len(events) > EventLimit {
+		events = events[len(events)-EventLimit:]
+	}
+	dm.events[event.DeckID] = events
+}
+
+// Events returns the events of the deck after the sequence in order
+func (dm *deckMemory) Events(uuid string, after, limit int) ([]*DeckEvent, error) {
+	dm.mu.RLock()
+	defer dm.mu.RUnlock()
+	events := make([]*DeckEvent, 0)
+	for i := range dm.events[uuid] {
+		if limit > 0 && len(events) == limit {
+			break
+		}
+		if dm.events[uuid][i].Seq > after {
+			c := copyDeckEvent(&dm.events[uuid][i])
+			events = append(events, &c)
+		}
+	}
+	return events, nil
+}
+
+func copyDeckEvent(event *DeckEvent) DeckEvent {
+	c := *event
+	c.Cards = append([]string(nil), event.Cards...)
+	if event.State != nil {
+		s := *event.State
+		d := copyDeck(&Deck{Cards: s.Cards, Drawn: s.Drawn, Piles: s.Piles})
+		s.Cards, s.Drawn, s.Piles = d.Cards, d.Drawn, d.Piles
+		c.State = &s
+	}
+	return c
+}
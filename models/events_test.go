@@ -0,0 +1,92 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_deckService_Events(t *testing.T) {
+	ds := NewDeckService(NewCardService())
+	deck := &Deck{Actor: "host"}
+	if err := ds.Create(deck); err != nil {
+		t.Fatalf("Create() err = %s, want nil", err)
+	}
+	states := []Deck{copyDeck(deck)}
+	mutations := []func() error{
+		func() error { _, err := ds.Draw(deck, 2); return err },
+		func() error { return ds.AddToPile(deck, "hand", nil) },
+		func() error { return ds.Shuffle(deck, ShuffleOptions{Strategy: StrategyRiffle}) },
+		func() error { _, err := ds.MoveCards(deck, "hand", DiscardPile, nil, 1); return err },
+		func() error { return ds.Open(deck) },
+	}
+	for _, mutate := range mutations {
+		deck.Actor = "player"
+		if err := mutate(); err != nil {
+			t.Fatalf("mutation err = %s, want nil", err)
+		}
+		states = append(states, copyDeck(deck))
+	}
+
+	page, err := ds.Events(deck.UUID, 0, 0)
+	if err != nil {
+		t.Fatalf("Events() err = %s, want nil", err)
+	}
+	wantTypes := []string{EventCreated, EventDrawn, EventPileAdded, EventShuffled, EventCardsMoved, EventOpened}
+	var gotTypes []string
+	for i, event := range page.Events {
+		gotTypes = append(gotTypes, event.Type)
+		if event.Seq != i+1 {
+			t.Errorf("Events()[%d] Seq = %v, want %v", i, event.Seq, i+1)
+		}
+	}
+	if !reflect.DeepEqual(gotTypes, wantTypes) {
+		t.Errorf("Events() types = %v, want %v", gotTypes, wantTypes)
+	}
+	if got := page.Events[0].Actor; got != "host" {
+		t.Errorf("Events()[0] Actor = %v, want host", got)
+	}
+	if got, want := page.Events[1].Cards, cardCodesOf(states[1].Drawn); !reflect.DeepEqual(got, want) {
+		t.Errorf("Events()[1] Cards = %v, want %v", got, want)
+	}
+	if got := page.Events[4]; got.Actor != "player" || got.Pile != "hand" || got.To != DiscardPile {
+		t.Errorf("Events()[4] = %+v, want moved from hand to discard by player", got)
+	}
+
+	for _, want := range states {
+		got, err := ds.Replay(deck.UUID, want.Version)
+		if err != nil {
+			t.Fatalf("Replay(%d) err = %s, want nil", want.Version, err)
+		}
+		if !reflect.DeepEqual(got.state(), want.state()) || got.Remaining != want.Remaining {
+			t.Errorf("Replay(%d) got = %+v, want %+v", want.Version, got.state(), want.state())
+		}
+	}
+	if _, err := ds.Replay(deck.UUID, 7); err != ErrEventNotFound {
+		t.Errorf("Replay() err = %v, want ErrEventNotFound", err)
+	}
+
+	page, err = ds.Events(deck.UUID, 2, 3)
+	if err != nil {
+		t.Fatalf("Events() err = %s, want nil", err)
+	}
+	if len(page.Events) != 3 || page.Events[0].Seq != 3 || page.Next != 5 {
+		t.Errorf("Events() page = %v events from %v next %v, want 3 from 3 next 5", len(page.Events), page.Events[0].Seq, page.Next)
+	}
+	if _, err := ds.Events(deck.UUID, 0, MaxListLimit+1); err != ErrLimitInvalid {
+		t.Errorf("Events() err = %v, want ErrLimitInvalid", err)
+	}
+	if _, err := ds.Events("5f4d2f7e-1d7e-4c1a-8e7c-1d2b9a0e3c44", 0, 0); err != ErrNotFound {
+		t.Errorf("Events() err = %v, want ErrNotFound", err)
+	}
+}
+
+func Test_deckService_Events_NotSupported(t *testing.T) {
+	storage := struct{ DeckStorage }{NewDeckMemory()}
+	ds := NewDeckService(NewCardService(), WithDeckStorage(storage))
+	if _, err := ds.Events("uuid", 0, 0); err != ErrEventsNotSupported {
+		t.Errorf("Events() err = %v, want ErrEventsNotSupported", err)
+	}
+	if _, err := ds.Replay("uuid", 1); err != ErrEventsNotSupported {
+		t.Errorf("Replay() err = %v, want ErrEventsNotSupported", err)
+	}
+}
@@ -0,0 +1,151 @@
+package models
+
+import (
+	"errors"
+	"expvar"
+	"log"
+	"sync"
+	"time"
+)
+
+var (
+	ErrDeleteNotSupported = errors.New("deck storage does not support deletion")
+	ErrTTLInvalid         = errors.New("ttl must not be negative")
+)
+
+// DeckDeleter is implemented by the storages which can delete decks
+// Storages are not required to implement it
+type DeckDeleter interface {
+	// Delete removes the deck by uuid, returns ErrNotFound if not exists
+	Delete(uuid string) error
+}
+
+// DeckExpirer is implemented by the storages which can evict expired decks
+// Storages are not required to implement it
+type DeckExpirer interface {
+	// DeleteExpired removes the decks which expire before now
+	// Returns the number of removed decks
+	DeleteExpired(now time.Time) (int, error)
+}
+
+// WithDeckTTL sets the ttl of the decks created without ttl
+// Decks do not expire by default
+func WithDeckTTL(ttl time.Duration) DeckServiceOption {
+	return func(cfg *deckServiceConfig) {
+		cfg.ttl = ttl
+	}
+}
+
+// Delete removes the deck and its webhooks by uuid
+// Expired decks are not found like ByUUID, they are left to the eviction
+// Returns ErrDeleteNotSupported if storage does not implement DeckDeleter
+// Returns ErrNotFound if deck does not exist or is expired
+func (ds *deckService) Delete(uuid string) error {
+	if ds.deleter == nil {
+		return ErrDeleteNotSupported
+	}
+	unlock := ds.locks.lock(uuid)
+	defer unlock()
+	if _, err := ds.DeckStorage.ByUUID(uuid); err != nil {
+		return err
+	}
+	if err := ds.deleter.Delete(uuid); err != nil {
+		return err
+	}
+	if ds.webhooks != nil {
+		ds.webhooks.forget(uuid)
+	}
+	return nil
+}
+
+// expired reports whether the deck expires before now
+func (d *Deck) expired(now time.Time) bool {
+	return !d.ExpiresAt.IsZero() && d.ExpiresAt.Before(now)
+}
+
+// Delete removes the deck and its webhooks by uuid
+// Returns ErrNotFound if deck does not exist
+func (dm *deckMemory) Delete(uuid string) error {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	if _, ok := dm.decks[uuid]; !ok {
+		return ErrNotFound
+	}
+	delete(dm.decks, uuid)
+	delete(dm.events, uuid)
+	return nil
+}
+
+// DeleteExpired removes the decks which expire before now
+func (dm *deckMemory) DeleteExpired(now time.Time) (int, error) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	n := 0
+	for uuid, deck := range dm.decks {
+		if deck.expired(now) {
+			delete(dm.decks, uuid)
+			delete(dm.events, uuid)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// janitorMetrics are published by expvar as janitor
+// runs, evicted and errors count the janitor runs, evicted decks and failed runs
+var janitorMetrics = expvar.NewMap("janitor")
+
+// Janitor evicts expired decks of a storage periodically
+type Janitor struct {
+	expirer  DeckExpirer
+	interval time.Duration
+	stop     chan struct{}
+	done     chan struct{}
+	once     sync.Once
+}
+
+// StartJanitor starts evicting expired decks of the storage every interval
+// Stop must be called to release the janitor goroutine
+func StartJanitor(expirer DeckExpirer, interval time.Duration) *Janitor {
+	j := &Janitor{
+		expirer:  expirer,
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go j.run()
+	return j
+}
+
+// Stop stops the janitor and waits its goroutine to exit
+// It is safe to call Stop more than once
+func (j *Janitor) Stop() {
+	j.once.Do(func() { close(j.stop) })
+	<-j.done
+}
+
+func (j *Janitor) run() {
+	defer close(j.done)
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-j.stop:
+			return
+		case now := <-ticker.C:
+			j.evict(now)
+		}
+	}
+}
+
+// evict removes decks expired before now and records the metrics
+func (j *Janitor) evict(now time.Time) {
+	janitorMetrics.Add("runs", 1)
+	n, err := j.expirer.DeleteExpired(now)
+	if err != nil {
+		janitorMetrics.Add("errors", 1)
+		log.Printf("janitor: evict expired decks: %s", err)
+		return
+	}
+	janitorMetrics.Add("evicted", int64(n))
+}
@@ -0,0 +1,118 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_deckService_Delete_NotSupported(t *testing.T) {
+	storage := struct{ DeckStorage }{NewDeckMemory()}
+	ds := NewDeckService(NewCardService(), WithDeckStorage(storage))
+	if err := ds.Delete("uuid"); err != ErrDeleteNotSupported {
+		t.Errorf("Delete() err = %v, want ErrDeleteNotSupported", err)
+	}
+}
+
+func Test_deckService_TTL(t *testing.T) {
+	ds := NewDeckService(NewCardService(), WithDeckTTL(time.Hour))
+
+	deck := &Deck{}
+	if err := ds.Create(deck); err != nil {
+		t.Fatalf("Create() err = %v, want nil", err)
+	}
+	if deck.TTL != 3600 {
+		t.Errorf("Create() TTL = %v, want 3600", deck.TTL)
+	}
+	if deck.ExpiresAt.IsZero() {
+		t.Fatal("Create() ExpiresAt is zero, want set")
+	}
+
+	expiresAt := deck.ExpiresAt
+	time.Sleep(time.Millisecond)
+	if _, err := ds.Draw(deck, 1); err != nil {
+		t.Fatalf("Draw() err = %v, want nil", err)
+	}
+	if !deck.ExpiresAt.After(expiresAt) {
+		t.Errorf("Draw() ExpiresAt = %v, want after %v", deck.ExpiresAt, expiresAt)
+	}
+
+	if err := ds.Create(&Deck{TTL: -1}); err != ErrTTLInvalid {
+		t.Errorf("Create() err = %v, want ErrTTLInvalid", err)
+	}
+}
+
+func Test_deckService_ByUUID_Expired(t *testing.T) {
+	storage := NewDeckMemory()
+	ds := NewDeckService(NewCardService(), WithDeckStorage(storage))
+	deck := &Deck{TTL: 60}
+	if err := ds.Create(deck); err != nil {
+		t.Fatalf("Create() err = %v, want nil", err)
+	}
+
+	deck.ExpiresAt = time.Now().Add(-time.Second)
+	if err := storage.Update(deck); err != nil {
+		t.Fatalf("Update() err = %v, want nil", err)
+	}
+	if _, err := ds.ByUUID(deck.UUID); err != ErrNotFound {
+		t.Errorf("ByUUID() err = %v, want ErrNotFound", err)
+	}
+}
+
+func Test_deckService_Expired_ListDelete(t *testing.T) {
+	storage := NewDeckMemory()
+	ds := NewDeckService(NewCardService(), WithDeckStorage(storage))
+	expired := &Deck{Owner: "expiry"}
+	alive := &Deck{Owner: "expiry", TTL: 60}
+	for _, deck := range []*Deck{expired, alive} {
+		if err := ds.Create(deck); err != nil {
+			t.Fatalf("Create() err = %v, want nil", err)
+		}
+	}
+	expired.ExpiresAt = time.Now().Add(-time.Second)
+	if err := storage.Update(expired); err != nil {
+		t.Fatalf("Update() err = %v, want nil", err)
+	}
+
+	page, err := ds.List(DeckFilter{Owner: "expiry"})
+	if err != nil {
+		t.Fatalf("List() err = %v, want nil", err)
+	}
+	if len(page.Decks) != 1 || page.Decks[0].UUID != alive.UUID {
+		t.Errorf("List() got %d decks, want only the unexpired deck", len(page.Decks))
+	}
+	if err := ds.Delete(expired.UUID); err != ErrNotFound {
+		t.Errorf("Delete() of expired deck err = %v, want ErrNotFound", err)
+	}
+	if err := ds.Delete(alive.UUID); err != nil {
+		t.Errorf("Delete() err = %v, want nil", err)
+	}
+}
+
+func TestStartJanitor(t *testing.T) {
+	storage := NewDeckMemory()
+	expired := &Deck{UUID: "expired", ExpiresAt: time.Now().Add(-time.Second)}
+	live := &Deck{UUID: "live", ExpiresAt: time.Now().Add(time.Hour)}
+	for _, deck := range []*Deck{expired, live} {
+		if err := storage.Create(deck); err != nil {
+			t.Fatalf("Create() err = %v, want nil", err)
+		}
+	}
+
+	j := StartJanitor(storage.(DeckExpirer), time.Millisecond)
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, err := storage.ByUUID(expired.UUID); err == ErrNotFound {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("janitor did not evict the expired deck")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	j.Stop()
+	j.Stop()
+
+	if _, err := storage.ByUUID(live.UUID); err != nil {
+		t.Errorf("ByUUID() err = %v, want nil", err)
+	}
+}
@@ -0,0 +1,147 @@
+package models
+
+import (
+	"crypto/hmac"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrFairnessMissing     = errors.New("fairness commitment of the deck is missing")
+	ErrFairnessNotRevealed = errors.New("server seed is not revealed yet")
+	ErrFairnessInvalid     = errors.New("fairness proof does not match the commitment")
+)
+
+// ShufflerFair is the provably fair shuffler
+// Shuffles are derived from a secret server seed and the client seed,
+// the commitment is published on creation and the server seed is revealed on open
+const ShufflerFair = "fair"
+
+// Fairness is the commit/reveal proof of a deck shuffled by ShufflerFair
+//
+// On creation ServerSeedHash (sha256 of the server seed) and Commitment
+// (sha256 of the server seed and the shuffled order) are published,
+// ServerSeed is revealed when the deck is opened so anyone can recompute
+// the order from the Initial cards by VerifyFairness
+type Fairness struct {
+	ServerSeedHash string   `json:"server_seed_hash"`
+	Commitment     string   `json:"commitment"`
+	ClientSeed     string   `json:"client_seed"`
+	Nonce          int      `json:"nonce"`
+	Initial        []string `json:"initial"`
+	ServerSeed     string   `json:"server_seed,omitempty"`
+	// Secret is the server seed kept until reveal
+	Secret string `json:"-"`
+}
+
+// NewFairShuffler returns Fisher-Yates shuffler backed by HMAC-SHA256 stream
+// of the deck server seed, client seed and nonce
+func NewFairShuffler(deck *Deck) (Shuffler, error) {
+	if deck.Seed != nil {
+		return nil, ErrSeedNotSupported
+	}
+	if deck.Fairness == nil || deck.Fairness.Secret == "" {
+		return nil, ErrFairnessMissing
+	}
+	src := newHMACSource(deck.Fairness.Secret, deck.Fairness.ClientSeed, deck.Nonce)
+	deck.Nonce++
+	return &fisherYates{src}, nil
+}
+
+// VerifyFairness recomputes the shuffled order of a revealed fairness proof
+// Returns the card codes of the order which can be compared with the dealt cards
+// Returns ErrFairnessNotRevealed if the server seed is not revealed
+// Returns ErrFairnessInvalid if the server seed or the order does not match the commitment
+func VerifyFairness(f *Fairness) ([]string, error) {
+	if f.ServerSeed == "" {
+		return nil, ErrFairnessNotRevealed
+	}
+	if hashHex(f.ServerSeed) != f.ServerSeedHash {
+		return nil, ErrFairnessInvalid
+	}
+
+	cards := make([]*Card, len(f.Initial))
+	for i, code := range f.Initial {
+		cards[i] = &Card{Code: code}
+	}
+	shuffler := fisherYates{newHMACSource(f.ServerSeed, f.ClientSeed, f.Nonce)}
+	shuffler.Shuffle(cards)
+
+	order := cardCodes(cards)
+	if fairnessCommitment(f.ServerSeed, order) != f.Commitment {
+		return nil, ErrFairnessInvalid
+	}
+	return order, nil
+}
+
+// fairnessCommitment returns the commitment of the server seed and the card order
+func fairnessCommitment(serverSeed string, order []string) string {
+	return hashHex(serverSeed + ":" + strings.Join(order, ","))
+}
+
+func hashHex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// cardCodes returns codes of the cards
+func cardCodes(cards []*Card) []string {
+	codes := make([]string, len(cards))
+	for i, card := range cards {
+		codes[i] = card.Code
+	}
+	return codes
+}
+
+// newServerSeed returns a random hex encoded server seed
+func newServerSeed() string {
+	b := make([]byte, 32)
+	if _, err := crand.Read(b); err != nil {
+		panic("crypto/rand is unavailable: " + err.Error())
+	}
+	return hex.EncodeToString(b)
+}
+
+// hmacSource is the int source reading HMAC-SHA256(serverSeed, clientSeed:nonce:counter) blocks
+type hmacSource struct {
+	key     []byte
+	msg     string
+	counter int
+	buf     []byte
+}
+
+func newHMACSource(serverSeed, clientSeed string, nonce int) *hmacSource {
+	return &hmacSource{
+		key: []byte(serverSeed),
+		msg: clientSeed + ":" + strconv.Itoa(nonce) + ":",
+	}
+}
+
+// uint64 returns the next 8 bytes of the stream
+func (hs *hmacSource) uint64() uint64 {
+	if len(hs.buf) < 8 {
+		mac := hmac.New(sha256.New, hs.key)
+		mac.Write([]byte(hs.msg + strconv.Itoa(hs.counter)))
+		hs.counter++
+		hs.buf = mac.Sum(nil)
+	}
+	v := binary.BigEndian.Uint64(hs.buf[:8])
+	hs.buf = hs.buf[8:]
+	return v
+}
+
+// Intn returns a uniform random number in [0,n)
+// Values above the largest multiple of n are rejected to avoid modulo bias
+func (hs *hmacSource) Intn(n int) int {
+	limit := ^uint64(0) - ^uint64(0)%uint64(n)
+	for {
+		if v := hs.uint64(); v < limit {
+			return int(v % uint64(n))
+		}
+	}
+}
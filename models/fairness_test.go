@@ -0,0 +1,90 @@
+package models
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_deckService_Fairness(t *testing.T) {
+	ds := NewDeckService(NewCardService())
+	deck := Deck{Shuffler: ShufflerFair, Fairness: &Fairness{ClientSeed: "lucky", ServerSeed: "injected"}}
+	if err := ds.Create(&deck); err != nil {
+		t.Fatalf("Create() err = %s, want nil", err)
+	}
+	f := deck.Fairness
+	if !deck.Shuffled {
+		t.Errorf("Create() shuffled = false, want true")
+	}
+	if f.ClientSeed != "lucky" || f.ServerSeed != "" || f.Secret == "" {
+		t.Errorf("Create() fairness = %+v, want client seed and hidden server seed", f)
+	}
+	if f.ServerSeedHash != hashHex(f.Secret) {
+		t.Errorf("Create() server seed hash = %v, want %v", f.ServerSeedHash, hashHex(f.Secret))
+	}
+	if _, err := VerifyFairness(f); err != ErrFairnessNotRevealed {
+		t.Errorf("VerifyFairness() err = %v, want ErrFairnessNotRevealed", err)
+	}
+	order := cardCodes(deck.Cards)
+
+	if _, err := ds.Draw(&deck, 3); err != nil {
+		t.Fatalf("Draw() err = %s, want nil", err)
+	}
+	if err := ds.Open(&deck); err != nil {
+		t.Fatalf("Open() err = %s, want nil", err)
+	}
+	if deck.Fairness.ServerSeed != f.Secret {
+		t.Errorf("Open() server seed = %v, want %v", deck.Fairness.ServerSeed, f.Secret)
+	}
+	got, err := VerifyFairness(deck.Fairness)
+	if err != nil {
+		t.Fatalf("VerifyFairness() err = %s, want nil", err)
+	}
+	if !reflect.DeepEqual(got, order) {
+		t.Errorf("VerifyFairness() got = %v, want %v", got, order)
+	}
+}
+
+func TestVerifyFairness(t *testing.T) {
+	initial := []string{"AS", "2S", "3S", "4S", "5S", "6S"}
+	proof := func() *Fairness {
+		f := &Fairness{ClientSeed: "client", Nonce: 2, Initial: initial, ServerSeed: "server"}
+		cards, _ := NewCardService().ByCodesStr(strings.Join(initial, ","))
+		shuffler, _ := NewFairShuffler(&Deck{Nonce: 2, Fairness: &Fairness{Secret: "server", ClientSeed: "client"}})
+		shuffler.Shuffle(cards)
+		f.ServerSeedHash = hashHex("server")
+		f.Commitment = fairnessCommitment("server", cardCodes(cards))
+		return f
+	}
+	tests := []struct {
+		name    string
+		tamper  func(f *Fairness)
+		wantErr error
+	}{
+		{name: "valid", tamper: func(f *Fairness) {}},
+		{name: "not revealed", tamper: func(f *Fairness) { f.ServerSeed = "" }, wantErr: ErrFairnessNotRevealed},
+		{name: "server seed", tamper: func(f *Fairness) { f.ServerSeed = "other" }, wantErr: ErrFairnessInvalid},
+		{name: "client seed", tamper: func(f *Fairness) { f.ClientSeed = "other" }, wantErr: ErrFairnessInvalid},
+		{name: "nonce", tamper: func(f *Fairness) { f.Nonce = 3 }, wantErr: ErrFairnessInvalid},
+		{name: "commitment", tamper: func(f *Fairness) { f.Commitment = hashHex("other") }, wantErr: ErrFairnessInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := proof()
+			tt.tamper(f)
+			if _, err := VerifyFairness(f); err != tt.wantErr {
+				t.Errorf("VerifyFairness() err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewFairShuffler(t *testing.T) {
+	seed := int64(7)
+	if _, err := NewFairShuffler(&Deck{Seed: &seed}); err != ErrSeedNotSupported {
+		t.Errorf("NewFairShuffler() err = %v, want ErrSeedNotSupported", err)
+	}
+	if _, err := NewFairShuffler(&Deck{}); err != ErrFairnessMissing {
+		t.Errorf("NewFairShuffler() err = %v, want ErrFairnessMissing", err)
+	}
+}
@@ -0,0 +1,52 @@
+package models
+
+import "errors"
+
+var (
+	ErrPrincipalInvalid = errors.New("principals must be 1 to 255 characters and at most 50 per deck")
+)
+
+// MaxGrants is the number of the principals can be granted on a deck
+const MaxGrants = 50
+
+// Grant replaces the principals granted to change the deck besides its owner
+// Returns ErrPrincipalInvalid if a principal is empty, too long or there are too many
+func (ds *deckService) Grant(deck *Deck, principals []string) error {
+	if err := checkPrincipals(principals); err != nil {
+		return err
+	}
+	return ds.modify(deck, &DeckEvent{Type: EventGranted}, func(deck *Deck) ([]*Card, error) {
+		deck.Grants = append([]string(nil), principals...)
+		return nil, nil
+	})
+}
+
+// MutableBy reports whether the principal can change the deck
+// Decks without owner principal can be changed by anyone
+func (d *Deck) MutableBy(principal string) bool {
+	if d.Principal == "" || d.Principal == principal {
+		return true
+	}
+	for _, granted := range d.Grants {
+		if granted == principal {
+			return true
+		}
+	}
+	return false
+}
+
+func (dv *deckValidator) checkGrants(deck *Deck) error {
+	return checkPrincipals(deck.Grants)
+}
+
+func checkPrincipals(principals []string) error {
+	if len(principals) > MaxGrants {
+		return ErrPrincipalInvalid
+	}
+	for _, p := range principals {
+		if p == "" || len(p) > 255 {
+			return ErrPrincipalInvalid
+		}
+	}
+	return nil
+}
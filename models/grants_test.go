@@ -0,0 +1,61 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDeck_MutableBy(t *testing.T) {
+	tests := []struct {
+		name      string
+		deck      Deck
+		principal string
+		want      bool
+	}{
+		{"no owner", Deck{}, "bob", true},
+		{"owner", Deck{Principal: "alice"}, "alice", true},
+		{"granted", Deck{Principal: "alice", Grants: []string{"bob"}}, "bob", true},
+		{"other", Deck{Principal: "alice", Grants: []string{"bob"}}, "carol", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.deck.MutableBy(tt.principal); got != tt.want {
+				t.Errorf("MutableBy() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_deckService_Grant(t *testing.T) {
+	ds := NewDeckService(NewCardService())
+	deck := &Deck{Principal: "alice"}
+	if err := ds.Create(deck); err != nil {
+		t.Fatalf("Create() err = %s, want nil", err)
+	}
+
+	tests := []struct {
+		name       string
+		principals []string
+		wantErr    error
+	}{
+		{"grant", []string{"bob", "carol"}, nil},
+		{"revoke all", nil, nil},
+		{"empty principal", []string{""}, ErrPrincipalInvalid},
+		{"long principal", []string{strings.Repeat("a", 256)}, ErrPrincipalInvalid},
+		{"too many", make([]string, MaxGrants+1), ErrPrincipalInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ds.Grant(deck, tt.principals)
+			if err != tt.wantErr {
+				t.Fatalf("Grant() err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && len(deck.Grants) != len(tt.principals) {
+				t.Errorf("Grant() got grants = %v, want %v", deck.Grants, tt.principals)
+			}
+		})
+	}
+	if err := ds.Create(&Deck{Grants: []string{""}}); err != ErrPrincipalInvalid {
+		t.Errorf("Create() with invalid grants err = %v, want %v", err, ErrPrincipalInvalid)
+	}
+}
@@ -0,0 +1,191 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+)
+
+var (
+	ErrPlayerTokenRequired = errors.New("player token is required")
+	ErrPileClaimed         = errors.New("pile is already claimed or has cards")
+	ErrPileNotOwned        = errors.New("pile is the hand of another player")
+)
+
+// PlayerKey returns the identity of the player token, it is stored as the owner of the hands
+// Returns empty string if token is empty
+func PlayerKey(token string) string {
+	if token == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Claim makes the named pile the hand of the deck player
+// Cards of the hand are visible only to its owner unless they are revealed
+// Pile is created if not exists
+// Returns ErrPlayerTokenRequired if Player of the deck is not set
+// Returns ErrPileClaimed if pile is owned or has cards
+func (ds *deckService) Claim(deck *Deck, pile string) error {
+	if err := checkPileName(pile); err != nil {
+		return err
+	}
+	player := deck.Player
+	if player == "" {
+		return ErrPlayerTokenRequired
+	}
+	return ds.modify(deck, &DeckEvent{Type: EventPileClaimed, Pile: pile}, func(deck *Deck) ([]*Card, error) {
+		if deck.Opened {
+			return nil, ErrDeckOpened
+		}
+		if p, ok := deck.Piles[pile]; ok && (p.Owner != "" || len(p.Cards) > 0) {
+			return nil, ErrPileClaimed
+		}
+		putOnPile(deck, pile, nil)
+		deck.Piles[pile].Owner = player
+		return nil, nil
+	})
+}
+
+// Deal draws given amount of cards from the top of the deck on top of the named pile
+// Dealt cards are not returned to the dealer if the pile is a hand
+// Pile is created if not exists
+// Returns ErrCountInvalid if count is negative
+// Returns ErrNotEnoughCards if deck has not enough cards
+func (ds *deckService) Deal(deck *Deck, pile string, count int) ([]*Card, error) {
+	if err := checkPileName(pile); err != nil {
+		return nil, err
+	}
+	if count < 0 {
+		return nil, ErrCountInvalid
+	}
+	var cards []*Card
+	err := ds.modify(deck, &DeckEvent{Type: EventDealt, Pile: pile}, func(deck *Deck) ([]*Card, error) {
+		if deck.Opened {
+			return nil, ErrDeckOpened
+		}
+		if count > deck.Remaining {
+			return nil, ErrNotEnoughCards
+		}
+		cards = deck.Cards[:count]
+		deck.Cards = deck.Cards[count:]
+		deck.Dealt += count
+		putOnPile(deck, pile, cards)
+		return cards, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cards, nil
+}
+
+// Reveal makes the cards of the given codes in the named hand visible to everyone
+// All cards of the hand are revealed if no code is given
+// Only the owner of the hand can reveal its cards
+// Returns ErrPileNotFound if deck has no such pile
+// Returns ErrPileNotOwned if pile is the hand of another player
+// Returns ErrCardsNotInPile if a card is not in the pile
+func (ds *deckService) Reveal(deck *Deck, pile string, codes []string) error {
+	player := deck.Player
+	return ds.modify(deck, &DeckEvent{Type: EventRevealed, Pile: pile}, func(deck *Deck) ([]*Card, error) {
+		p, err := deck.Pile(pile)
+		if err != nil {
+			return nil, err
+		}
+		if p.hiddenFrom(player) {
+			return nil, ErrPileNotOwned
+		}
+		revealed, ok := p.Cards, true
+		if len(codes) > 0 {
+			revealed, _, ok = takeCards(p.Cards, codes)
+		}
+		if !ok {
+			return nil, ErrCardsNotInPile
+		}
+		for _, card := range revealed {
+			if !p.revealed(card.Code) {
+				p.Revealed = append(p.Revealed, card.Code)
+			}
+		}
+		return revealed, nil
+	})
+}
+
+// Redact hides the cards of the hands not owned by the player except their revealed cards
+// Remaining counts of the hands are kept
+func (d *Deck) Redact(player string) {
+	for name, p := range d.Piles {
+		if p.hiddenFrom(player) {
+			d.Piles[name] = p.redacted()
+		}
+	}
+}
+
+// Redacted returns the pile as seen by the player
+// Cards of a hand not owned by the player are hidden except the revealed ones
+func (p *Pile) Redacted(player string) *Pile {
+	if p.hiddenFrom(player) {
+		return p.redacted()
+	}
+	return p
+}
+
+// redacted returns the copy of the pile with only the revealed cards
+func (p *Pile) redacted() *Pile {
+	c := *p
+	c.Cards = make([]*Card, 0)
+	for _, card := range p.Cards {
+		if p.revealed(card.Code) {
+			c.Cards = append(c.Cards, card)
+		}
+	}
+	return &c
+}
+
+// hiddenFrom reports whether the pile is the hand of another player
+func (p *Pile) hiddenFrom(player string) bool {
+	return p.Owner != "" && p.Owner != player
+}
+
+// revealed reports whether the cards of the code in the pile are revealed
+func (p *Pile) revealed(code string) bool {
+	for _, c := range p.Revealed {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// pruneRevealed forgets the revealed codes of the cards which left the pile
+// Cards put back in the pile are hidden again
+func (p *Pile) pruneRevealed() {
+	if len(p.Revealed) == 0 {
+		return
+	}
+	var kept []string
+	for _, code := range p.Revealed {
+		for _, card := range p.Cards {
+			if card.Code == code {
+				kept = append(kept, code)
+				break
+			}
+		}
+	}
+	p.Revealed = kept
+}
+
+// hidesCards reports whether the event puts cards in a hand, so its cards must not be recorded
+func (e *DeckEvent) hidesCards(deck *Deck) bool {
+	pile := e.Pile
+	switch e.Type {
+	case EventPileAdded, EventDealt:
+	case EventCardsMoved:
+		pile = e.To
+	default:
+		return false
+	}
+	p, ok := deck.Piles[pile]
+	return ok && p.Owner != ""
+}
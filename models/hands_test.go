@@ -0,0 +1,95 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_deckService_Hands(t *testing.T) {
+	ds := NewDeckService(NewCardService())
+	deck := &Deck{}
+	if err := ds.Create(deck); err != nil {
+		t.Fatalf("Create() err = %s, want nil", err)
+	}
+	alice, bob := PlayerKey("alice-token"), PlayerKey("bob-token")
+
+	if err := ds.Claim(deck, "alice"); err != ErrPlayerTokenRequired {
+		t.Errorf("Claim() without player err = %v, want %v", err, ErrPlayerTokenRequired)
+	}
+	deck.Player = alice
+	if err := ds.Claim(deck, "alice"); err != nil {
+		t.Fatalf("Claim() err = %s, want nil", err)
+	}
+	deck.Player = bob
+	if err := ds.Claim(deck, "alice"); err != ErrPileClaimed {
+		t.Errorf("Claim() of claimed pile err = %v, want %v", err, ErrPileClaimed)
+	}
+
+	deck.Player = ""
+	dealt, err := ds.Deal(deck, "alice", 2)
+	if err != nil {
+		t.Fatalf("Deal() err = %s, want nil", err)
+	}
+	if deck.Remaining != 50 || deck.Piles["alice"].Remaining != 2 || deck.Piles["alice"].Owner != alice {
+		t.Errorf("Deal() got deck remaining %v and hand %+v, want 50 and 2 cards of alice", deck.Remaining, deck.Piles["alice"])
+	}
+	if _, err := ds.Deal(deck, "alice", -1); err != ErrCountInvalid {
+		t.Errorf("Deal() of negative count err = %v, want %v", err, ErrCountInvalid)
+	}
+
+	deck.Player = bob
+	if _, err := ds.DrawFromPile(deck, "alice", 1); err != ErrPileNotOwned {
+		t.Errorf("DrawFromPile() of other hand err = %v, want %v", err, ErrPileNotOwned)
+	}
+	if _, err := ds.MoveCards(deck, "alice", DiscardPile, nil, 1); err != ErrPileNotOwned {
+		t.Errorf("MoveCards() of other hand err = %v, want %v", err, ErrPileNotOwned)
+	}
+	if err := ds.Reveal(deck, "alice", nil); err != ErrPileNotOwned {
+		t.Errorf("Reveal() of other hand err = %v, want %v", err, ErrPileNotOwned)
+	}
+	seen := copyDeck(deck)
+	seen.Redact(bob)
+	if got := seen.Piles["alice"]; len(got.Cards) != 0 || got.Remaining != 2 {
+		t.Errorf("Redact() got hand %+v, want no cards of 2 remaining", got)
+	}
+
+	deck.Player = alice
+	if err := ds.Reveal(deck, "alice", []string{"XX"}); err != ErrCardsNotInPile {
+		t.Errorf("Reveal() of missing card err = %v, want %v", err, ErrCardsNotInPile)
+	}
+	if err := ds.Reveal(deck, "alice", []string{dealt[1].Code}); err != nil {
+		t.Fatalf("Reveal() err = %s, want nil", err)
+	}
+	seen = copyDeck(deck)
+	seen.Redact(bob)
+	if got := cardCodesOf(seen.Piles["alice"].Cards); !reflect.DeepEqual(got, []string{dealt[1].Code}) {
+		t.Errorf("Redact() got hand cards %v, want revealed %v", got, dealt[1].Code)
+	}
+	if got := deck.Piles["alice"].Redacted(alice); len(got.Cards) != 2 {
+		t.Errorf("Redacted() for owner got %v cards, want 2", len(got.Cards))
+	}
+
+	moved, err := ds.MoveCards(deck, "alice", DiscardPile, []string{dealt[1].Code}, 0)
+	if err != nil {
+		t.Fatalf("MoveCards() err = %s, want nil", err)
+	}
+	if got := deck.Piles["alice"].Revealed; len(got) != 0 {
+		t.Errorf("MoveCards() left revealed %v in hand, want none", got)
+	}
+
+	page, err := ds.Events(deck.UUID, 0, 0)
+	if err != nil {
+		t.Fatalf("Events() err = %s, want nil", err)
+	}
+	wantCards := map[string][]string{
+		EventPileClaimed: nil,
+		EventDealt:       nil,
+		EventRevealed:    {dealt[1].Code},
+		EventCardsMoved:  cardCodesOf(moved),
+	}
+	for _, event := range page.Events[1:] {
+		if want, ok := wantCards[event.Type]; !ok || !reflect.DeepEqual(event.Cards, want) {
+			t.Errorf("Events() %v cards = %v, want %v", event.Type, event.Cards, want)
+		}
+	}
+}
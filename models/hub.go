@@ -0,0 +1,137 @@
+package models
+
+import (
+	"errors"
+	"expvar"
+	"sync"
+)
+
+var (
+	ErrSubscriberLagged = errors.New("subscriber is too slow to receive the events")
+	ErrHubClosed        = errors.New("event hub is closed")
+)
+
+// DefaultHubBuffer is the number of the events buffered per subscriber by default
+const DefaultHubBuffer = 64
+
+// hubMetrics are published by expvar as hub
+// published and lagged count the published events and the subscribers dropped for lagging
+var hubMetrics = expvar.NewMap("hub")
+
+// WithHub makes the service publish the events of the decks to the hub
+func WithHub(hub *Hub) DeckServiceOption {
+	return func(cfg *deckServiceConfig) {
+		cfg.hub = hub
+	}
+}
+
+// Hub is the in-process publisher of the deck events
+// Publishing never blocks, subscribers falling behind by more than the buffer are dropped
+type Hub struct {
+	mu     sync.Mutex
+	buffer int
+	subs   map[string]map[*Subscription]struct{}
+	closed bool
+}
+
+// NewHub returns the hub buffering given number of events per subscriber
+// DefaultHubBuffer is used if buffer is not positive
+func NewHub(buffer int) *Hub {
+	if buffer <= 0 {
+		buffer = DefaultHubBuffer
+	}
+	return &Hub{buffer: buffer, subs: map[string]map[*Subscription]struct{}{}}
+}
+
+// Subscription receives the events of a deck published after it is created
+// Events is closed when the subscription ends, Err tells the reason
+type Subscription struct {
+	Events <-chan *DeckEvent
+	events chan *DeckEvent
+	hub    *Hub
+	uuid   string
+	err    error
+}
+
+// Subscribe returns the subscription to the events of the deck
+// Subscription must be closed by Close when it is not used
+func (h *Hub) Subscribe(uuid string) *Subscription {
+	events := make(chan *DeckEvent, h.buffer)
+	sub := &Subscription{Events: events, events: events, hub: h, uuid: uuid}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		sub.end(ErrHubClosed)
+		return sub
+	}
+	if h.subs[uuid] == nil {
+		h.subs[uuid] = map[*Subscription]struct{}{}
+	}
+	h.subs[uuid][sub] = struct{}{}
+	return sub
+}
+
+// Publish sends the event to the subscribers of its deck
+// Subscribers with full buffer are dropped with ErrSubscriberLagged
+func (h *Hub) Publish(event *DeckEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hubMetrics.Add("published", 1)
+	for sub := range h.subs[event.DeckID] {
+		select {
+		case sub.events <- event:
+		default:
+			hubMetrics.Add("lagged", 1)
+			h.remove(sub)
+			sub.end(ErrSubscriberLagged)
+		}
+	}
+}
+
+// Close ends every subscription with ErrHubClosed
+// Subscriptions created after are ended immediately
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for _, subs := range h.subs {
+		for sub := range subs {
+			sub.end(ErrHubClosed)
+		}
+	}
+	h.subs = map[string]map[*Subscription]struct{}{}
+}
+
+// remove deletes the subscription from the hub, hub must be locked
+func (h *Hub) remove(sub *Subscription) {
+	delete(h.subs[sub.uuid], sub)
+	if len(h.subs[sub.uuid]) == 0 {
+		delete(h.subs, sub.uuid)
+	}
+}
+
+// Close ends the subscription
+// It is safe to call Close more than once
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	if _, ok := s.hub.subs[s.uuid][s]; ok {
+		s.hub.remove(s)
+		s.end(nil)
+	}
+}
+
+// Err returns the reason of the subscription end
+// Returns nil if the subscription is not ended or closed by Close
+func (s *Subscription) Err() error {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	return s.err
+}
+
+// end closes the events with the reason, hub must be locked
+func (s *Subscription) end(err error) {
+	s.err = err
+	close(s.events)
+}
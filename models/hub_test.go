@@ -0,0 +1,107 @@
+package models
+
+import (
+	"testing"
+)
+
+func TestHub_Publish(t *testing.T) {
+	hub := NewHub(2)
+	sub := hub.Subscribe("deck")
+	defer sub.Close()
+	other := hub.Subscribe("other")
+	defer other.Close()
+
+	hub.Publish(&DeckEvent{DeckID: "deck", Seq: 1})
+	hub.Publish(&DeckEvent{DeckID: "deck", Seq: 2})
+	for want := 1; want <= 2; want++ {
+		if got := <-sub.Events; got.Seq != want {
+			t.Errorf("Events got Seq = %v, want %v", got.Seq, want)
+		}
+	}
+	select {
+	case event := <-other.Events:
+		t.Errorf("Events of other deck got = %+v, want none", event)
+	default:
+	}
+}
+
+func TestHub_Lagged(t *testing.T) {
+	hub := NewHub(1)
+	slow := hub.Subscribe("deck")
+	fast := hub.Subscribe("deck")
+	defer fast.Close()
+
+	hub.Publish(&DeckEvent{DeckID: "deck", Seq: 1})
+	<-fast.Events
+	hub.Publish(&DeckEvent{DeckID: "deck", Seq: 2})
+
+	if got := <-slow.Events; got.Seq != 1 {
+		t.Errorf("Events got Seq = %v, want 1", got.Seq)
+	}
+	if _, ok := <-slow.Events; ok {
+		t.Errorf("Events of slow subscriber are not closed")
+	}
+	if err := slow.Err(); err != ErrSubscriberLagged {
+		t.Errorf("Err() = %v, want %v", err, ErrSubscriberLagged)
+	}
+	if got := <-fast.Events; got.Seq != 2 {
+		t.Errorf("Events got Seq = %v, want 2", got.Seq)
+	}
+	slow.Close()
+}
+
+func TestHub_Close(t *testing.T) {
+	hub := NewHub(0)
+	sub := hub.Subscribe("deck")
+	closed := hub.Subscribe("deck")
+	closed.Close()
+	closed.Close()
+	if err := closed.Err(); err != nil {
+		t.Errorf("Err() = %v, want nil", err)
+	}
+
+	hub.Close()
+	if _, ok := <-sub.Events; ok {
+		t.Errorf("Events are not closed")
+	}
+	if err := sub.Err(); err != ErrHubClosed {
+		t.Errorf("Err() = %v, want %v", err, ErrHubClosed)
+	}
+	sub.Close()
+
+	late := hub.Subscribe("deck")
+	if _, ok := <-late.Events; ok || late.Err() != ErrHubClosed {
+		t.Errorf("Subscribe() after Close got open subscription, want ended by %v", ErrHubClosed)
+	}
+}
+
+func Test_deckService_Publish(t *testing.T) {
+	hub := NewHub(0)
+	ds := NewDeckService(NewCardService(), WithHub(hub))
+	deck := &Deck{}
+	if err := ds.Create(deck); err != nil {
+		t.Fatalf("Create() err = %s, want nil", err)
+	}
+	sub := hub.Subscribe(deck.UUID)
+	defer sub.Close()
+
+	deck.Actor = "player"
+	cards, err := ds.Draw(deck, 2)
+	if err != nil {
+		t.Fatalf("Draw() err = %s, want nil", err)
+	}
+	if err := ds.Open(deck); err != nil {
+		t.Fatalf("Open() err = %s, want nil", err)
+	}
+
+	drawn := <-sub.Events
+	if drawn.Type != EventDrawn || drawn.Seq != 2 || drawn.Actor != "player" || len(drawn.Cards) != len(cards) {
+		t.Errorf("Events got = %+v, want drawn event of 2 cards", drawn)
+	}
+	if drawn.State != nil {
+		t.Errorf("Events got State = %+v, want nil", drawn.State)
+	}
+	if opened := <-sub.Events; opened.Type != EventOpened || opened.Seq != 3 {
+		t.Errorf("Events got = %+v, want opened event", opened)
+	}
+}
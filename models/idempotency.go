@@ -0,0 +1,145 @@
+package models
+
+import (
+	"container/heap"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	ErrIdempotencyKeyReused     = errors.New("idempotency key is already used by a different request")
+	ErrIdempotencyKeyInProgress = errors.New("request of the idempotency key is in progress")
+)
+
+// IdempotencyRecord is the first response to the requests of an idempotency key
+// Fingerprint identifies the request, Status is zero until the response is saved
+type IdempotencyRecord struct {
+	Key         string
+	Fingerprint string
+	Status      int
+	Header      map[string][]string
+	Body        []byte
+	ExpiresAt   time.Time
+}
+
+// Pending reports whether the response of the record is not saved yet
+func (rec *IdempotencyRecord) Pending() bool {
+	return rec.Status == 0
+}
+
+// IdempotencyStore keeps the responses of the idempotency keys until they expire
+// Implementations must be safe for concurrent use,
+// storagetest package can be used to validate them
+type IdempotencyStore interface {
+	// Reserve stores the pending record if there is no unexpired record of its key
+	// Returns the existing record otherwise, nil if the key is reserved
+	Reserve(rec *IdempotencyRecord) (*IdempotencyRecord, error)
+	// Save stores the response of the reserved record
+	Save(rec *IdempotencyRecord) error
+	// Release removes the pending record of the key so its request can be retried
+	// Saved records are kept
+	Release(key string) error
+}
+
+// NewIdempotencyMemory returns the in-memory IdempotencyStore implementation
+// Expired records are evicted on reservation in the order of their expiry
+func NewIdempotencyMemory() IdempotencyStore {
+	return &idempotencyMemory{records: map[string]IdempotencyRecord{}}
+}
+
+type idempotencyMemory struct {
+	mu      sync.Mutex
+	records map[string]IdempotencyRecord
+	// expiries orders the keys by their expiry, entries of released or replaced records are skipped on eviction
+	expiries idempotencyExpiries
+}
+
+// Reserve stores the pending record if there is no unexpired record of its key
+func (im *idempotencyMemory) Reserve(rec *IdempotencyRecord) (*IdempotencyRecord, error) {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	im.evict(time.Now())
+	if stored, ok := im.records[rec.Key]; ok {
+		c := copyIdempotencyRecord(&stored)
+		return &c, nil
+	}
+	im.store(rec)
+	return nil, nil
+}
+
+// Save stores the response of the reserved record
+// Returns ErrNotFound if record is not reserved
+func (im *idempotencyMemory) Save(rec *IdempotencyRecord) error {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	if _, ok := im.records[rec.Key]; !ok {
+		return ErrNotFound
+	}
+	im.store(rec)
+	return nil
+}
+
+// store puts the copy of the record and queues its expiry if it is not queued yet
+func (im *idempotencyMemory) store(rec *IdempotencyRecord) {
+	if stored, ok := im.records[rec.Key]; !ok || !stored.ExpiresAt.Equal(rec.ExpiresAt) {
+		heap.Push(&im.expiries, idempotencyExpiry{key: rec.Key, expiresAt: rec.ExpiresAt})
+	}
+	im.records[rec.Key] = copyIdempotencyRecord(rec)
+}
+
+// evict removes the records which expire before now
+func (im *idempotencyMemory) evict(now time.Time) {
+	for len(im.expiries) > 0 && im.expiries[0].expiresAt.Before(now) {
+		e := heap.Pop(&im.expiries).(idempotencyExpiry)
+		if stored, ok := im.records[e.key]; ok && stored.ExpiresAt.Equal(e.expiresAt) {
+			delete(im.records, e.key)
+		}
+	}
+}
+
+// Release removes the pending record of the key so its request can be retried
+func (im *idempotencyMemory) Release(key string) error {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	if stored, ok := im.records[key]; ok && stored.Pending() {
+		delete(im.records, key)
+	}
+	return nil
+}
+
+// idempotencyExpiry is the expiry of a stored key
+type idempotencyExpiry struct {
+	key       string
+	expiresAt time.Time
+}
+
+// idempotencyExpiries is the min-heap of the expiries, it implements heap.Interface
+type idempotencyExpiries []idempotencyExpiry
+
+func (q idempotencyExpiries) Len() int           { return len(q) }
+func (q idempotencyExpiries) Less(i, j int) bool { return q[i].expiresAt.Before(q[j].expiresAt) }
+func (q idempotencyExpiries) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+
+func (q *idempotencyExpiries) Push(x interface{}) {
+	*q = append(*q, x.(idempotencyExpiry))
+}
+
+func (q *idempotencyExpiries) Pop() interface{} {
+	old := *q
+	e := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return e
+}
+
+func copyIdempotencyRecord(rec *IdempotencyRecord) IdempotencyRecord {
+	c := *rec
+	if rec.Header != nil {
+		c.Header = make(map[string][]string, len(rec.Header))
+		for name, values := range rec.Header {
+			c.Header[name] = append([]string(nil), values...)
+		}
+	}
+	c.Body = append([]byte(nil), rec.Body...)
+	return c
+}
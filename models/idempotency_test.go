@@ -0,0 +1,37 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_idempotencyMemory_Reserve_Evicts(t *testing.T) {
+	im := NewIdempotencyMemory().(*idempotencyMemory)
+	now := time.Now()
+	for _, key := range []string{"expired-1", "expired-2", "expired-3"} {
+		if _, err := im.Reserve(&IdempotencyRecord{Key: key, ExpiresAt: now.Add(-time.Minute)}); err != nil {
+			t.Fatalf("Reserve() err = %s, want nil", err)
+		}
+	}
+	live := &IdempotencyRecord{Key: "live", ExpiresAt: now.Add(time.Hour)}
+	if _, err := im.Reserve(live); err != nil {
+		t.Fatalf("Reserve() err = %s, want nil", err)
+	}
+	live.Status = 200
+	if err := im.Save(live); err != nil {
+		t.Fatalf("Save() err = %s, want nil", err)
+	}
+	if err := im.Release("expired-1"); err != nil {
+		t.Fatalf("Release() err = %s, want nil", err)
+	}
+
+	if _, err := im.Reserve(&IdempotencyRecord{Key: "next", ExpiresAt: now.Add(time.Hour)}); err != nil {
+		t.Fatalf("Reserve() err = %s, want nil", err)
+	}
+	if len(im.records) != 2 || len(im.expiries) != 2 {
+		t.Errorf("Reserve() kept %d records and %d expiries, want 2 and 2", len(im.records), len(im.expiries))
+	}
+	if _, ok := im.records["live"]; !ok {
+		t.Errorf("Reserve() evicted the unexpired record")
+	}
+}
@@ -0,0 +1,190 @@
+package models
+
+import (
+	"encoding/base64"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	ErrListNotSupported = errors.New("deck storage does not support listing")
+	ErrCursorInvalid    = errors.New("cursor is not valid")
+	ErrLimitInvalid     = errors.New("limit must be between 1 and 100")
+)
+
+// Page sizes of the deck listing
+const (
+	DefaultListLimit = 20
+	MaxListLimit     = 100
+)
+
+// DeckFilter selects the decks to list, zero values do not filter
+// Decks are ordered by creation time and uuid, Cursor continues after the previous page
+type DeckFilter struct {
+	Opened        *bool
+	Shuffled      *bool
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	MinRemaining  *int
+	MaxRemaining  *int
+	// Owner matches the free-text owner label, not the authenticated principal
+	Owner string
+	// Principal matches the authenticated owner of the deck
+	Principal string
+	Tag       string
+	// Viewer lists only the decks the principal has a role on, see Deck.RoleOf
+	Viewer string
+	// ExpiresAfter lists only the decks which do not expire before it, the service lists the unexpired decks
+	ExpiresAfter time.Time
+	Cursor       string
+	// Limit is the page size, DefaultListLimit if zero
+	Limit int
+}
+
+// DeckPage is a page of the listed decks
+// NextCursor is empty on the last page
+type DeckPage struct {
+	Decks      []*Deck
+	Limit      int
+	NextCursor string
+}
+
+// DeckLister is implemented by the storages which can enumerate decks
+// Storages are not required to implement it
+type DeckLister interface {
+	// List returns the page of the decks matching the filter
+	// Returns ErrCursorInvalid if cursor is malformed
+	// Returns ErrLimitInvalid if limit is out of range
+	List(filter DeckFilter) (DeckPage, error)
+}
+
+// List returns the page of the decks matching the filter
+// Expired decks are not listed even before they are evicted
+// Returns ErrListNotSupported if storage does not implement DeckLister
+func (ds *deckService) List(filter DeckFilter) (DeckPage, error) {
+	if ds.lister == nil {
+		return DeckPage{}, ErrListNotSupported
+	}
+	if filter.ExpiresAfter.IsZero() {
+		filter.ExpiresAfter = time.Now()
+	}
+	return ds.lister.List(filter)
+}
+
+// List returns the page of the stored decks matching the filter
+func (dm *deckMemory) List(filter DeckFilter) (DeckPage, error) {
+	limit, after, err := filter.page()
+	if err != nil {
+		return DeckPage{}, err
+	}
+
+	dm.mu.RLock()
+	matched := make([]*Deck, 0)
+	for uuid := range dm.decks {
+		deck := dm.decks[uuid]
+		if filter.match(&deck) && (after == nil || after.before(&deck)) {
+			c := copyDeck(&deck)
+			matched = append(matched, &c)
+		}
+	}
+	dm.mu.RUnlock()
+
+	sort.Slice(matched, func(i, j int) bool {
+		return cursorOf(matched[i]).before(matched[j])
+	})
+	page := DeckPage{Decks: matched, Limit: limit}
+	if len(matched) > limit {
+		page.Decks = matched[:limit]
+		page.NextCursor = cursorOf(matched[limit-1]).String()
+	}
+	return page, nil
+}
+
+// page returns the limit and the decoded cursor of the filter
+func (f DeckFilter) page() (int, *deckCursor, error) {
+	limit := f.Limit
+	if limit == 0 {
+		limit = DefaultListLimit
+	}
+	if limit < 1 || limit > MaxListLimit {
+		return 0, nil, ErrLimitInvalid
+	}
+	if f.Cursor == "" {
+		return limit, nil, nil
+	}
+	c, err := parseDeckCursor(f.Cursor)
+	if err != nil {
+		return 0, nil, err
+	}
+	return limit, c, nil
+}
+
+// match reports whether the deck satisfies every filter
+func (f DeckFilter) match(deck *Deck) bool {
+	switch {
+	case f.Opened != nil && deck.Opened != *f.Opened,
+		f.Shuffled != nil && deck.Shuffled != *f.Shuffled,
+		!f.CreatedAfter.IsZero() && !deck.CreatedAt.After(f.CreatedAfter),
+		!f.CreatedBefore.IsZero() && !deck.CreatedAt.Before(f.CreatedBefore),
+		f.MinRemaining != nil && deck.Remaining < *f.MinRemaining,
+		f.MaxRemaining != nil && deck.Remaining > *f.MaxRemaining,
+		f.Owner != "" && deck.Owner != f.Owner,
+		f.Principal != "" && deck.Principal != f.Principal,
+		f.Viewer != "" && deck.RoleOf(f.Viewer) == "",
+		!f.ExpiresAfter.IsZero() && deck.expired(f.ExpiresAfter):
+		return false
+	}
+	if f.Tag == "" {
+		return true
+	}
+	for _, tag := range deck.Tags {
+		if tag == f.Tag {
+			return true
+		}
+	}
+	return false
+}
+
+// deckCursor is the position of a deck in the listing order
+type deckCursor struct {
+	createdAt time.Time
+	uuid      string
+}
+
+func cursorOf(deck *Deck) deckCursor {
+	return deckCursor{createdAt: deck.CreatedAt, uuid: deck.UUID}
+}
+
+// before reports whether the cursor is positioned before the deck
+func (c deckCursor) before(deck *Deck) bool {
+	if !c.createdAt.Equal(deck.CreatedAt) {
+		return c.createdAt.Before(deck.CreatedAt)
+	}
+	return c.uuid < deck.UUID
+}
+
+// String returns the opaque representation of the cursor
+func (c deckCursor) String() string {
+	raw := c.createdAt.UTC().Format(time.RFC3339Nano) + "|" + c.uuid
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// parseDeckCursor decodes the opaque cursor
+// Returns ErrCursorInvalid if cursor is malformed
+func parseDeckCursor(s string) (*deckCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrCursorInvalid
+	}
+	parts := strings.SplitN(string(raw), "|", 2)
+	if len(parts) != 2 {
+		return nil, ErrCursorInvalid
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return nil, ErrCursorInvalid
+	}
+	return &deckCursor{createdAt: createdAt, uuid: parts[1]}, nil
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_deckService_List_NotSupported(t *testing.T) {
+	storage := struct{ DeckStorage }{NewDeckMemory()}
+	ds := NewDeckService(NewCardService(), WithDeckStorage(storage))
+	if _, err := ds.List(DeckFilter{}); err != ErrListNotSupported {
+		t.Errorf("List() err = %v, want ErrListNotSupported", err)
+	}
+}
+
+func Test_parseDeckCursor(t *testing.T) {
+	tests := []struct {
+		name   string
+		cursor deckCursor
+	}{
+		{name: "valid", cursor: deckCursor{createdAt: time.Date(2022, 1, 2, 3, 4, 5, 6, time.UTC), uuid: "id|with|bars"}},
+		{name: "zero time", cursor: deckCursor{uuid: "id"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseDeckCursor(tt.cursor.String())
+			if err != nil {
+				t.Fatalf("parseDeckCursor() err = %v, want nil", err)
+			}
+			if !got.createdAt.Equal(tt.cursor.createdAt) || got.uuid != tt.cursor.uuid {
+				t.Errorf("parseDeckCursor() got = %v, want %v", got, tt.cursor)
+			}
+		})
+	}
+
+	for _, s := range []string{"!", "bm8tc2VwYXJhdG9y", "bm90LWF8dGltZQ"} {
+		if _, err := parseDeckCursor(s); err != ErrCursorInvalid {
+			t.Errorf("parseDeckCursor(%q) err = %v, want ErrCursorInvalid", s, err)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package models
+
+import "sync"
+
+// deckLocks provides mutual exclusion per deck uuid
+// Zero value is ready to use
+type deckLocks struct {
+	mu    sync.Mutex
+	locks map[string]*deckLock
+}
+
+type deckLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lock acquires the lock of the given deck uuid
+// Returns the function which releases the lock
+func (dl *deckLocks) lock(uuid string) func() {
+	dl.mu.Lock()
+	if dl.locks == nil {
+		dl.locks = map[string]*deckLock{}
+	}
+	l, ok := dl.locks[uuid]
+	if !ok {
+		l = &deckLock{}
+		dl.locks[uuid] = l
+	}
+	l.refs++
+	dl.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		dl.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(dl.locks, uuid)
+		}
+		dl.mu.Unlock()
+	}
+}
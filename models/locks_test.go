@@ -0,0 +1,29 @@
+package models
+
+import (
+	"sync"
+	"testing"
+)
+
+func Test_deckLocks_lock(t *testing.T) {
+	dl := deckLocks{}
+	counter := 0
+	wg := sync.WaitGroup{}
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock := dl.lock("uuid")
+			defer unlock()
+			counter++
+		}()
+	}
+	wg.Wait()
+
+	if counter != 100 {
+		t.Errorf("lock() counter = %v, want %v", counter, 100)
+	}
+	if len(dl.locks) != 0 {
+		t.Errorf("lock() not released locks = %v, want 0", len(dl.locks))
+	}
+}
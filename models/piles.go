@@ -0,0 +1,217 @@
+package models
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrPileNameInvalid = errors.New("pile name must be 1 to 64 letters, digits, - or _")
+	ErrPileNotFound    = errors.New("pile not found")
+	ErrCardsNotDrawn   = errors.New("cards are not drawn from the deck")
+	ErrCardsNotInPile  = errors.New("cards are not in the pile")
+)
+
+// DiscardPile is the conventional name of the discard pile
+const DiscardPile = "discard"
+
+var pileNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Pile is a named set of cards attached to a deck like discard pile or player hands
+// First card is the top of the pile
+// Owner is the player key of the hand, cards of a hand are visible to others only if their codes are revealed
+type Pile struct {
+	Cards     []*Card  `json:"cards"`
+	Remaining int      `json:"remaining"`
+	Owner     string   `json:"owner,omitempty"`
+	Revealed  []string `json:"revealed,omitempty"`
+}
+
+// Pile returns the pile of the deck by name
+// Returns ErrPileNotFound if deck has no such pile
+func (d *Deck) Pile(name string) (*Pile, error) {
+	pile, ok := d.Piles[name]
+	if !ok {
+		return nil, ErrPileNotFound
+	}
+	return pile, nil
+}
+
+// AddToPile moves drawn cards of the given codes on top of the named pile
+// All drawn cards are moved if no code is given
+// Pile is created if not exists
+// Returns ErrPileNameInvalid if pile name is not valid
+// Returns ErrCardsNotDrawn if a card is not among the drawn cards
+func (ds *deckService) AddToPile(deck *Deck, pile string, codes []string) error {
+	if err := checkPileName(pile); err != nil {
+		return err
+	}
+	return ds.modify(deck, &DeckEvent{Type: EventPileAdded, Pile: pile}, func(deck *Deck) ([]*Card, error) {
+		if deck.Opened {
+			return nil, ErrDeckOpened
+		}
+		taken, rest, ok := deck.Drawn, []*Card(nil), true
+		if len(codes) > 0 {
+			taken, rest, ok = takeCards(deck.Drawn, codes)
+		}
+		if !ok {
+			return nil, ErrCardsNotDrawn
+		}
+		deck.Drawn = rest
+		putOnPile(deck, pile, taken)
+		return taken, nil
+	})
+}
+
+// DrawFromPile releases given amount of cards from the top of the named pile
+// Released cards are kept as drawn cards of the deck
+// Returns ErrPileNotFound if deck has no such pile
+// Returns ErrPileNotOwned if pile is the hand of another player
+// Returns ErrCountInvalid if count is negative
+// Returns ErrNotEnoughCards if pile has not enough cards to draw
+func (ds *deckService) DrawFromPile(deck *Deck, pile string, count int) ([]*Card, error) {
+	if count < 0 {
+		return nil, ErrCountInvalid
+	}
+	player := deck.Player
+	var cards []*Card
+	err := ds.modify(deck, &DeckEvent{Type: EventPileDrawn, Pile: pile}, func(deck *Deck) ([]*Card, error) {
+		if deck.Opened {
+			return nil, ErrDeckOpened
+		}
+		p, err := deck.Pile(pile)
+		if err != nil {
+			return nil, err
+		}
+		if p.hiddenFrom(player) {
+			return nil, ErrPileNotOwned
+		}
+		if count > len(p.Cards) {
+			return nil, ErrNotEnoughCards
+		}
+		cards = p.Cards[:count]
+		p.Cards = p.Cards[count:]
+		p.pruneRevealed()
+		deck.Drawn = append(deck.Drawn, cards...)
+		return cards, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cards, nil
+}
+
+// MoveCards moves cards from a pile on top of another pile
+// Cards of the given codes are moved if codes is not empty,
+// otherwise given amount of cards are moved from the top
+// Target pile is created if not exists
+// Returns ErrPileNotFound if source pile does not exist
+// Returns ErrPileNotOwned if source pile is the hand of another player
+// Returns ErrCardsNotInPile if a card is not in the source pile
+// Returns ErrCountInvalid if count is negative
+// Returns ErrNotEnoughCards if source pile has not enough cards to move
+func (ds *deckService) MoveCards(deck *Deck, from, to string, codes []string, count int) ([]*Card, error) {
+	if err := checkPileName(to); err != nil {
+		return nil, err
+	}
+	if count < 0 {
+		return nil, ErrCountInvalid
+	}
+	player := deck.Player
+	var cards []*Card
+	err := ds.modify(deck, &DeckEvent{Type: EventCardsMoved, Pile: from, To: to}, func(deck *Deck) ([]*Card, error) {
+		if deck.Opened {
+			return nil, ErrDeckOpened
+		}
+		p, err := deck.Pile(from)
+		if err != nil {
+			return nil, err
+		}
+		if p.hiddenFrom(player) {
+			return nil, ErrPileNotOwned
+		}
+		if len(codes) > 0 {
+			taken, rest, ok := takeCards(p.Cards, codes)
+			if !ok {
+				return nil, ErrCardsNotInPile
+			}
+			cards, p.Cards = taken, rest
+		} else {
+			if count > len(p.Cards) {
+				return nil, ErrNotEnoughCards
+			}
+			cards, p.Cards = p.Cards[:count], p.Cards[count:]
+		}
+		p.pruneRevealed()
+		putOnPile(deck, to, cards)
+		return cards, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cards, nil
+}
+
+func checkPileName(name string) error {
+	if !pileNameRegexp.MatchString(name) {
+		return ErrPileNameInvalid
+	}
+	return nil
+}
+
+// putOnPile places cards on top of the named pile, creates the pile if not exists
+func putOnPile(deck *Deck, name string, cards []*Card) {
+	if deck.Piles == nil {
+		deck.Piles = map[string]*Pile{}
+	}
+	p, ok := deck.Piles[name]
+	if !ok {
+		p = &Pile{}
+		deck.Piles[name] = p
+	}
+	p.Cards = append(append([]*Card{}, cards...), p.Cards...)
+}
+
+// takeCards removes the first card of each given code from cards
+// Codes are normalized before the search
+// Returns removed cards, remaining cards and false if a code is not found
+func takeCards(cards []*Card, codes []string) ([]*Card, []*Card, bool) {
+	rest := append([]*Card{}, cards...)
+	taken := make([]*Card, 0, len(codes))
+	for _, code := range codes {
+		code = strings.ToUpper(strings.TrimSpace(code))
+		found := false
+		for i, card := range rest {
+			if card.Code == code {
+				taken = append(taken, card)
+				rest = append(rest[:i], rest[i+1:]...)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, nil, false
+		}
+	}
+	return taken, rest, true
+}
+
+// copyPiles returns a copy of piles which does not share pile data with the original
+func copyPiles(piles map[string]*Pile) map[string]*Pile {
+	if piles == nil {
+		return nil
+	}
+	c := make(map[string]*Pile, len(piles))
+	for name, pile := range piles {
+		p := *pile
+		if pile.Cards != nil {
+			p.Cards = append([]*Card{}, pile.Cards...)
+		}
+		if pile.Revealed != nil {
+			p.Revealed = append([]string{}, pile.Revealed...)
+		}
+		c[name] = &p
+	}
+	return c
+}
@@ -0,0 +1,157 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func newPilesTestDeck(t *testing.T) (DeckService, *Deck) {
+	ds := NewDeckService(NewCardService())
+	deck := Deck{}
+	if err := ds.Create(&deck); err != nil {
+		t.Fatalf("Create() err = %s, want nil", err)
+	}
+	if _, err := ds.Draw(&deck, 5); err != nil {
+		t.Fatalf("Draw() err = %s, want nil", err)
+	}
+	return ds, &deck
+}
+
+func Test_deckService_AddToPile(t *testing.T) {
+	tests := []struct {
+		name      string
+		pile      string
+		codes     []string
+		wantPile  []*Card
+		wantDrawn []*Card
+		wantErr   error
+	}{
+		{
+			name:      "selected cards",
+			pile:      DiscardPile,
+			codes:     []string{"3s", "AS"},
+			wantPile:  []*Card{allCards[2], allCards[0]},
+			wantDrawn: []*Card{allCards[1], allCards[3], allCards[4]},
+		},
+		{
+			name:     "all drawn cards",
+			pile:     "player-1",
+			wantPile: allCards[:5],
+		},
+		{
+			name:    "not drawn card",
+			pile:    DiscardPile,
+			codes:   []string{"KH"},
+			wantErr: ErrCardsNotDrawn,
+		},
+		{
+			name:    "invalid pile name",
+			pile:    "player 1",
+			codes:   []string{"AS"},
+			wantErr: ErrPileNameInvalid,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ds, deck := newPilesTestDeck(t)
+			err := ds.AddToPile(deck, tt.pile, tt.codes)
+			if err != tt.wantErr {
+				t.Fatalf("AddToPile() err = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			found, _ := ds.ByUUID(deck.UUID)
+			pile, err := found.Pile(tt.pile)
+			if err != nil {
+				t.Fatalf("Pile() err = %v, want nil", err)
+			}
+			if !reflect.DeepEqual(pile.Cards, tt.wantPile) || pile.Remaining != len(tt.wantPile) {
+				t.Errorf("AddToPile() pile got = %v, want %v", pile.Cards, tt.wantPile)
+			}
+			if !reflect.DeepEqual(found.Drawn, tt.wantDrawn) {
+				t.Errorf("AddToPile() drawn got = %v, want %v", found.Drawn, tt.wantDrawn)
+			}
+		})
+	}
+}
+
+func Test_deckService_DrawFromPile(t *testing.T) {
+	ds, deck := newPilesTestDeck(t)
+	if err := ds.AddToPile(deck, DiscardPile, nil); err != nil {
+		t.Fatalf("AddToPile() err = %s, want nil", err)
+	}
+
+	if _, err := ds.DrawFromPile(deck, "unknown", 1); err != ErrPileNotFound {
+		t.Errorf("DrawFromPile() err = %v, want ErrPileNotFound", err)
+	}
+	if _, err := ds.DrawFromPile(deck, DiscardPile, 6); err != ErrNotEnoughCards {
+		t.Errorf("DrawFromPile() err = %v, want ErrNotEnoughCards", err)
+	}
+	if _, err := ds.DrawFromPile(deck, DiscardPile, -1); err != ErrCountInvalid {
+		t.Errorf("DrawFromPile() err = %v, want ErrCountInvalid", err)
+	}
+
+	cards, err := ds.DrawFromPile(deck, DiscardPile, 2)
+	if err != nil {
+		t.Fatalf("DrawFromPile() err = %s, want nil", err)
+	}
+	if !reflect.DeepEqual(cards, allCards[:2]) {
+		t.Errorf("DrawFromPile() got = %v, want %v", cards, allCards[:2])
+	}
+	if !reflect.DeepEqual(deck.Drawn, allCards[:2]) {
+		t.Errorf("DrawFromPile() drawn got = %v, want %v", deck.Drawn, allCards[:2])
+	}
+	if pile, _ := deck.Pile(DiscardPile); pile.Remaining != 3 {
+		t.Errorf("DrawFromPile() pile remaining got = %v, want 3", pile.Remaining)
+	}
+}
+
+func Test_deckService_MoveCards(t *testing.T) {
+	ds, deck := newPilesTestDeck(t)
+	if err := ds.AddToPile(deck, "player-1", nil); err != nil {
+		t.Fatalf("AddToPile() err = %s, want nil", err)
+	}
+
+	cards, err := ds.MoveCards(deck, "player-1", DiscardPile, []string{"4S"}, 0)
+	if err != nil {
+		t.Fatalf("MoveCards() err = %s, want nil", err)
+	}
+	if !reflect.DeepEqual(cards, []*Card{allCards[3]}) {
+		t.Errorf("MoveCards() got = %v, want %v", cards, allCards[3:4])
+	}
+
+	cards, err = ds.MoveCards(deck, "player-1", DiscardPile, nil, 2)
+	if err != nil {
+		t.Fatalf("MoveCards() err = %s, want nil", err)
+	}
+	if !reflect.DeepEqual(cards, allCards[:2]) {
+		t.Errorf("MoveCards() got = %v, want %v", cards, allCards[:2])
+	}
+
+	discard, _ := deck.Pile(DiscardPile)
+	want := []*Card{allCards[0], allCards[1], allCards[3]}
+	if !reflect.DeepEqual(discard.Cards, want) {
+		t.Errorf("MoveCards() discard got = %v, want %v", discard.Cards, want)
+	}
+
+	if _, err := ds.MoveCards(deck, "player-1", DiscardPile, []string{"4S"}, 0); err != ErrCardsNotInPile {
+		t.Errorf("MoveCards() err = %v, want ErrCardsNotInPile", err)
+	}
+	if _, err := ds.MoveCards(deck, "player-1", DiscardPile, nil, 3); err != ErrNotEnoughCards {
+		t.Errorf("MoveCards() err = %v, want ErrNotEnoughCards", err)
+	}
+	if _, err := ds.MoveCards(deck, "player-1", DiscardPile, nil, -1); err != ErrCountInvalid {
+		t.Errorf("MoveCards() err = %v, want ErrCountInvalid", err)
+	}
+	if _, err := ds.MoveCards(deck, "unknown", DiscardPile, nil, 1); err != ErrPileNotFound {
+		t.Errorf("MoveCards() err = %v, want ErrPileNotFound", err)
+	}
+
+	if err := ds.Open(deck); err != nil {
+		t.Fatalf("Open() err = %s, want nil", err)
+	}
+	if _, err := ds.MoveCards(deck, DiscardPile, "player-1", nil, 1); err != ErrDeckOpened {
+		t.Errorf("MoveCards() err = %v, want ErrDeckOpened", err)
+	}
+}
@@ -0,0 +1,160 @@
+package models
+
+import (
+	crand "crypto/rand"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"math/rand"
+)
+
+var (
+	ErrShufflerUnknown  = errors.New("shuffler is unknown")
+	ErrSeedNotSupported = errors.New("seed is not supported by the shuffler")
+)
+
+// Names of the shufflers shipped by default
+const (
+	// ShufflerMath is the seedable math/rand backed shuffler
+	ShufflerMath = "math"
+	// ShufflerCrypto is the crypto/rand backed shuffler for games with stakes
+	ShufflerCrypto = "crypto"
+)
+
+// Shuffler is used to randomize cards
+type Shuffler interface {
+	// Shuffle permutes the cards in place
+	Shuffle(cards []*Card)
+	// Intn returns a uniform random number in [0,n)
+	Intn(n int) int
+}
+
+// ShufflerFactory returns the shuffler for the next random operation on the deck
+// Returns ErrSeedNotSupported if deck has a seed which the shuffler cannot use
+type ShufflerFactory func(deck *Deck) (Shuffler, error)
+
+// NewMathShuffler returns Fisher-Yates shuffler backed by math/rand
+// Shuffles are reproducible for decks with seed
+func NewMathShuffler(deck *Deck) (Shuffler, error) {
+	return &fisherYates{deckRand(deck)}, nil
+}
+
+// NewCryptoShuffler returns Fisher-Yates shuffler backed by crypto/rand
+func NewCryptoShuffler(deck *Deck) (Shuffler, error) {
+	if deck.Seed != nil {
+		return nil, ErrSeedNotSupported
+	}
+	return &fisherYates{cryptoSource{}}, nil
+}
+
+// shufflers selects the shuffler of the decks by name
+// Zero value and nil provide the default shufflers and ShufflerMath as fallback
+type shufflers struct {
+	factories map[string]ShufflerFactory
+	fallback  string
+}
+
+// register adds the named shuffler factory
+func (s *shufflers) register(name string, factory ShufflerFactory) {
+	if s.factories == nil {
+		s.factories = map[string]ShufflerFactory{}
+	}
+	s.factories[name] = factory
+}
+
+// factory returns the factory of the named shuffler
+// Returns ErrShufflerUnknown if there is no such shuffler
+func (s *shufflers) factory(name string) (ShufflerFactory, error) {
+	if s != nil {
+		if factory, ok := s.factories[name]; ok {
+			return factory, nil
+		}
+	}
+	switch name {
+	case ShufflerMath:
+		return NewMathShuffler, nil
+	case ShufflerCrypto:
+		return NewCryptoShuffler, nil
+	case ShufflerFair:
+		return NewFairShuffler, nil
+	}
+	return nil, ErrShufflerUnknown
+}
+
+// defaultName returns the name of the shuffler used by decks without shuffler
+func (s *shufflers) defaultName() string {
+	if s == nil || s.fallback == "" {
+		return ShufflerMath
+	}
+	return s.fallback
+}
+
+// forDeck returns the shuffler of the deck for its next random operation
+func (s *shufflers) forDeck(deck *Deck) (Shuffler, error) {
+	name := deck.Shuffler
+	if name == "" {
+		name = s.defaultName()
+	}
+	factory, err := s.factory(name)
+	if err != nil {
+		return nil, err
+	}
+	return factory(deck)
+}
+
+// intSource is the source of uniform random numbers
+type intSource interface {
+	Intn(n int) int
+}
+
+// fisherYates is the Fisher-Yates shuffler over an int source
+type fisherYates struct {
+	src intSource
+}
+
+// Shuffle permutes cards in place
+func (fy *fisherYates) Shuffle(cards []*Card) {
+	for i := len(cards) - 1; i > 0; i-- {
+		j := fy.src.Intn(i + 1)
+		cards[i], cards[j] = cards[j], cards[i]
+	}
+}
+
+// Intn returns a uniform random number in [0,n)
+func (fy *fisherYates) Intn(n int) int {
+	return fy.src.Intn(n)
+}
+
+// cryptoSource is the int source backed by crypto/rand
+type cryptoSource struct{}
+
+// Intn returns a uniform random number in [0,n)
+func (cryptoSource) Intn(n int) int {
+	v, err := crand.Int(crand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		panic("crypto/rand is unavailable: " + err.Error())
+	}
+	return int(v.Int64())
+}
+
+// deckRand returns the random source of the next random operation on the deck
+// Decks with a seed get a reproducible source derived from the seed and the deck nonce,
+// others get an unpredictable source. Increments the deck nonce
+func deckRand(deck *Deck) *rand.Rand {
+	defer func() { deck.Nonce++ }()
+	if deck.Seed == nil {
+		return rand.New(rand.NewSource(unpredictableSeed()))
+	}
+	// golden ratio increment spreads consecutive nonces of close seeds apart
+	mixed := uint64(*deck.Seed) ^ uint64(deck.Nonce)*0x9E3779B97F4A7C15
+	return rand.New(rand.NewSource(int64(mixed)))
+}
+
+// unpredictableSeed returns a seed read from the crypto random source
+func unpredictableSeed() int64 {
+	var b [8]byte
+	if _, err := crand.Read(b[:]); err != nil {
+		panic("crypto/rand is unavailable: " + err.Error())
+	}
+	return int64(binary.LittleEndian.Uint64(b[:]))
+}
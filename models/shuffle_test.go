@@ -0,0 +1,201 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_deckRand(t *testing.T) {
+	seed := int64(42)
+	otherSeed := int64(43)
+
+	t.Run("seeded reproducible", func(t *testing.T) {
+		a, b := Deck{Seed: &seed}, Deck{Seed: &seed}
+		for i := 0; i < 3; i++ {
+			if x, y := deckRand(&a).Int63(), deckRand(&b).Int63(); x != y {
+				t.Errorf("deckRand() nonce %d got = %v and %v, want equal", i, x, y)
+			}
+		}
+		if a.Nonce != 3 {
+			t.Errorf("deckRand() nonce got = %v, want 3", a.Nonce)
+		}
+	})
+
+	t.Run("nonce changes source", func(t *testing.T) {
+		deck := Deck{Seed: &seed}
+		if x, y := deckRand(&deck).Int63(), deckRand(&deck).Int63(); x == y {
+			t.Errorf("deckRand() got = %v twice, want different", x)
+		}
+	})
+
+	t.Run("seed changes source", func(t *testing.T) {
+		a, b := Deck{Seed: &seed}, Deck{Seed: &otherSeed}
+		if x, y := deckRand(&a).Int63(), deckRand(&b).Int63(); x == y {
+			t.Errorf("deckRand() got = %v for different seeds, want different", x)
+		}
+	})
+
+	t.Run("unseeded unpredictable", func(t *testing.T) {
+		a, b := Deck{}, Deck{}
+		if x, y := deckRand(&a).Int63(), deckRand(&b).Int63(); x == y {
+			t.Errorf("deckRand() got = %v for unseeded decks, want different", x)
+		}
+	})
+}
+
+func Test_deckService_Seed(t *testing.T) {
+	seed := int64(20220101)
+	play := func() ([]*Card, *Deck) {
+		ds := NewDeckService(NewCardService())
+		deck := Deck{Shuffled: true, Seed: &seed}
+		if err := ds.Create(&deck); err != nil {
+			t.Fatalf("Create() err = %s, want nil", err)
+		}
+		drawn, _ := ds.Draw(&deck, 5)
+		_ = ds.Return(&deck, []string{drawn[0].Code, drawn[1].Code}, PositionRandom)
+		_ = ds.Shuffle(&deck, ShuffleOptions{})
+		return drawn, &deck
+	}
+
+	drawnA, deckA := play()
+	drawnB, deckB := play()
+	if !reflect.DeepEqual(drawnA, drawnB) {
+		t.Errorf("Draw() got = %v and %v, want equal", drawnA, drawnB)
+	}
+	if !reflect.DeepEqual(deckA.Cards, deckB.Cards) {
+		t.Errorf("Cards got = %v and %v, want equal", deckA.Cards, deckB.Cards)
+	}
+	if deckA.Seed == nil || *deckA.Seed != seed {
+		t.Errorf("Seed got = %v, want %v", deckA.Seed, seed)
+	}
+}
+
+// chiSquareCritical is the critical value of chi-square distribution
+// with 49 degrees of freedom at 1e-6 significance, a uniform shuffler fails one in a million runs
+const chiSquareCritical = 111.56
+
+// testUniformity shuffles 8 cards many times and checks by chi-square test
+// that every card lands on every position equally likely
+func testUniformity(t *testing.T, factory ShufflerFactory, deck *Deck) {
+	const n, trials = 8, 20000
+	var counts [n][n]int
+	for trial := 0; trial < trials; trial++ {
+		shuffler, err := factory(deck)
+		if err != nil {
+			t.Fatalf("factory() err = %s, want nil", err)
+		}
+		cards := append([]*Card{}, allCards[:n]...)
+		shuffler.Shuffle(cards)
+		for pos, card := range cards {
+			for i := 0; i < n; i++ {
+				if allCards[i] == card {
+					counts[i][pos]++
+				}
+			}
+		}
+	}
+
+	expected := float64(trials) / n
+	chi := 0.0
+	for i := range counts {
+		for pos := range counts[i] {
+			d := float64(counts[i][pos]) - expected
+			chi += d * d / expected
+		}
+	}
+	if chi > chiSquareCritical {
+		t.Errorf("Shuffle() chi-square = %.2f, want <= %.2f, counts %v", chi, chiSquareCritical, counts)
+	}
+}
+
+func TestShufflers_Uniformity(t *testing.T) {
+	seed := int64(7)
+	tests := []struct {
+		name    string
+		factory ShufflerFactory
+		deck    *Deck
+	}{
+		{name: "math seeded", factory: NewMathShuffler, deck: &Deck{Seed: &seed}},
+		{name: "math", factory: NewMathShuffler, deck: &Deck{}},
+		{name: "crypto", factory: NewCryptoShuffler, deck: &Deck{}},
+		{name: "fair", factory: NewFairShuffler, deck: &Deck{Fairness: &Fairness{Secret: "server", ClientSeed: "client"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testUniformity(t, tt.factory, tt.deck)
+		})
+	}
+}
+
+func TestNewCryptoShuffler(t *testing.T) {
+	seed := int64(7)
+	if _, err := NewCryptoShuffler(&Deck{Seed: &seed}); err != ErrSeedNotSupported {
+		t.Errorf("NewCryptoShuffler() err = %v, want ErrSeedNotSupported", err)
+	}
+}
+
+func Test_deckService_Shuffler(t *testing.T) {
+	seed := int64(7)
+	custom := func(deck *Deck) (Shuffler, error) {
+		return &fisherYates{deckRand(deck)}, nil
+	}
+	tests := []struct {
+		name         string
+		opts         []DeckServiceOption
+		deck         Deck
+		wantShuffler string
+		wantErr      error
+	}{
+		{
+			name:         "default",
+			deck:         Deck{Shuffled: true},
+			wantShuffler: ShufflerMath,
+		},
+		{
+			name:         "server wide",
+			opts:         []DeckServiceOption{WithShuffler(ShufflerCrypto)},
+			deck:         Deck{Shuffled: true},
+			wantShuffler: ShufflerCrypto,
+		},
+		{
+			name:         "per deck",
+			opts:         []DeckServiceOption{WithShuffler(ShufflerCrypto)},
+			deck:         Deck{Shuffled: true, Shuffler: ShufflerMath},
+			wantShuffler: ShufflerMath,
+		},
+		{
+			name:         "custom",
+			opts:         []DeckServiceOption{WithShufflerFactory("custom", custom)},
+			deck:         Deck{Shuffled: true, Shuffler: "custom"},
+			wantShuffler: "custom",
+		},
+		{
+			name:    "unknown",
+			deck:    Deck{Shuffled: true, Shuffler: "unknown"},
+			wantErr: ErrShufflerUnknown,
+		},
+		{
+			name:    "seed not supported",
+			deck:    Deck{Shuffled: true, Shuffler: ShufflerCrypto, Seed: &seed},
+			wantErr: ErrSeedNotSupported,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ds := NewDeckService(NewCardService(), tt.opts...)
+			deck := tt.deck
+			if err := ds.Create(&deck); err != tt.wantErr {
+				t.Fatalf("Create() err = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if deck.Shuffler != tt.wantShuffler {
+				t.Errorf("Create() shuffler = %v, want %v", deck.Shuffler, tt.wantShuffler)
+			}
+			if err := ds.Shuffle(&deck, ShuffleOptions{}); err != nil {
+				t.Errorf("Shuffle() err = %v, want nil", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package models_test
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/mocak/tbupt/models"
+	"github.com/mocak/tbupt/models/storagetest"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestDeckMemory_Conformance(t *testing.T) {
+	storagetest.RunDeckStorage(t, func(t *testing.T) models.DeckStorage {
+		return models.NewDeckMemory()
+	})
+}
+
+func TestDeckService_Conformance(t *testing.T) {
+	storagetest.RunDeckStorage(t, func(t *testing.T) models.DeckStorage {
+		return models.NewDeckService(models.NewCardService())
+	})
+}
+
+func TestDeckSQL_Conformance(t *testing.T) {
+	storagetest.RunDeckStorage(t, newDeckSQLite)
+}
+
+func TestIdempotencyMemory_Conformance(t *testing.T) {
+	storagetest.RunIdempotencyStore(t, func(t *testing.T) models.IdempotencyStore {
+		return models.NewIdempotencyMemory()
+	})
+}
+
+func TestIdempotencySQL_Conformance(t *testing.T) {
+	storagetest.RunIdempotencyStore(t, func(t *testing.T) models.IdempotencyStore {
+		return newDeckSQLite(t).(models.IdempotencyStore)
+	})
+}
+
+// newDeckSQLite returns sql deck storage on a temporary sqlite database
+func newDeckSQLite(t *testing.T) models.DeckStorage {
+	dsn := "file:" + filepath.Join(t.TempDir(), "decks.db") + "?_foreign_keys=on&_busy_timeout=5000"
+	db, err := sql.Open(string(models.DialectSQLite), dsn)
+	if err != nil {
+		t.Fatalf("sql.Open() err = %s, want nil", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	ds, err := models.NewDeckSQL(db, models.DialectSQLite)
+	if err != nil {
+		t.Fatalf("NewDeckSQL() err = %s, want nil", err)
+	}
+	return ds
+}
@@ -0,0 +1,169 @@
+package storagetest
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mocak/tbupt/models"
+)
+
+// IdempotencyFactory returns the IdempotencyStore under test
+// Called once per test case
+type IdempotencyFactory func(t *testing.T) models.IdempotencyStore
+
+// RunIdempotencyStore runs the conformance test suite against the stores returned by factory
+func RunIdempotencyStore(t *testing.T, factory IdempotencyFactory) {
+	t.Run("Reserve", func(t *testing.T) { testReserve(t, factory(t)) })
+	t.Run("Save", func(t *testing.T) { testSave(t, factory(t)) })
+	t.Run("Save not reserved", func(t *testing.T) { testSaveNotReserved(t, factory(t)) })
+	t.Run("Reserve expired", func(t *testing.T) { testReserveExpired(t, factory(t)) })
+	t.Run("Release", func(t *testing.T) { testRelease(t, factory(t)) })
+}
+
+// newRecord returns a pending record of a unique key which expires in an hour
+func newRecord() *models.IdempotencyRecord {
+	return &models.IdempotencyRecord{
+		Key:         uuid.NewString(),
+		Fingerprint: "fingerprint",
+		ExpiresAt:   time.Now().Add(time.Hour).UTC().Truncate(time.Microsecond),
+	}
+}
+
+// reserve reserves the record and fails the test if it is already reserved
+func reserve(t *testing.T, is models.IdempotencyStore, rec *models.IdempotencyRecord) {
+	t.Helper()
+	stored, err := is.Reserve(rec)
+	if err != nil {
+		t.Fatalf("Reserve() err = %s, want nil", err)
+	}
+	if stored != nil {
+		t.Fatalf("Reserve() got = %+v, want nil", stored)
+	}
+}
+
+// assertRecordEqual compares records field by field
+// nil and empty bodies are considered equal
+func assertRecordEqual(t *testing.T, got, want *models.IdempotencyRecord) {
+	t.Helper()
+	if got == nil {
+		t.Fatalf("Reserve() got = nil, want %+v", want)
+	}
+	if got.Key != want.Key || got.Fingerprint != want.Fingerprint || got.Status != want.Status {
+		t.Errorf("Key/Fingerprint/Status got = %v/%v/%v, want %v/%v/%v",
+			got.Key, got.Fingerprint, got.Status, want.Key, want.Fingerprint, want.Status)
+	}
+	if !reflect.DeepEqual(got.Header, want.Header) {
+		t.Errorf("Header got = %v, want %v", got.Header, want.Header)
+	}
+	if string(got.Body) != string(want.Body) {
+		t.Errorf("Body got = %s, want %s", got.Body, want.Body)
+	}
+	if !got.ExpiresAt.Equal(want.ExpiresAt) {
+		t.Errorf("ExpiresAt got = %v, want %v", got.ExpiresAt, want.ExpiresAt)
+	}
+}
+
+func testReserve(t *testing.T, is models.IdempotencyStore) {
+	rec := newRecord()
+	reserve(t, is, rec)
+
+	retry := newRecord()
+	retry.Key = rec.Key
+	retry.Fingerprint = "another"
+	stored, err := is.Reserve(retry)
+	if err != nil {
+		t.Fatalf("Reserve() err = %s, want nil", err)
+	}
+	assertRecordEqual(t, stored, rec)
+	if !stored.Pending() {
+		t.Errorf("Pending() got = false, want true")
+	}
+}
+
+func testSave(t *testing.T, is models.IdempotencyStore) {
+	rec := newRecord()
+	reserve(t, is, rec)
+
+	rec.Status = 201
+	rec.Header = map[string][]string{"Content-Type": {"application/json"}, "Etag": {`"1"`}}
+	rec.Body = []byte(`{"DeckID":"1812b565"}`)
+	if err := is.Save(rec); err != nil {
+		t.Fatalf("Save() err = %s, want nil", err)
+	}
+
+	stored, err := is.Reserve(newRecordOf(rec.Key))
+	if err != nil {
+		t.Fatalf("Reserve() err = %s, want nil", err)
+	}
+	assertRecordEqual(t, stored, rec)
+
+	// changing the saved record must not change the stored one
+	rec.Header["Etag"][0] = `"2"`
+	rec.Body[0] = '['
+	stored, _ = is.Reserve(newRecordOf(rec.Key))
+	if got := stored.Header["Etag"][0]; got != `"1"` {
+		t.Errorf("Header[Etag] got = %v, want \"1\"", got)
+	}
+	if got := string(stored.Body); got != `{"DeckID":"1812b565"}` {
+		t.Errorf("Body got = %v, want the saved body", got)
+	}
+}
+
+func testSaveNotReserved(t *testing.T, is models.IdempotencyStore) {
+	rec := newRecord()
+	rec.Status = 200
+	if err := is.Save(rec); err != models.ErrNotFound {
+		t.Errorf("Save() err = %v, want ErrNotFound", err)
+	}
+}
+
+func testReserveExpired(t *testing.T, is models.IdempotencyStore) {
+	expired := newRecord()
+	expired.ExpiresAt = time.Now().Add(-time.Second).UTC().Truncate(time.Microsecond)
+	reserve(t, is, expired)
+
+	rec := newRecordOf(expired.Key)
+	reserve(t, is, rec)
+	stored, err := is.Reserve(newRecordOf(rec.Key))
+	if err != nil {
+		t.Fatalf("Reserve() err = %s, want nil", err)
+	}
+	assertRecordEqual(t, stored, rec)
+}
+
+func testRelease(t *testing.T, is models.IdempotencyStore) {
+	pending := newRecord()
+	reserve(t, is, pending)
+	if err := is.Release(pending.Key); err != nil {
+		t.Fatalf("Release() err = %s, want nil", err)
+	}
+	reserve(t, is, newRecordOf(pending.Key))
+
+	saved := newRecord()
+	reserve(t, is, saved)
+	saved.Status = 200
+	if err := is.Save(saved); err != nil {
+		t.Fatalf("Save() err = %s, want nil", err)
+	}
+	if err := is.Release(saved.Key); err != nil {
+		t.Fatalf("Release() err = %s, want nil", err)
+	}
+	stored, err := is.Reserve(newRecordOf(saved.Key))
+	if err != nil {
+		t.Fatalf("Reserve() err = %s, want nil", err)
+	}
+	assertRecordEqual(t, stored, saved)
+
+	if err := is.Release(newRecord().Key); err != nil {
+		t.Errorf("Release() of unknown key err = %v, want nil", err)
+	}
+}
+
+// newRecordOf returns a pending record of the key
+func newRecordOf(key string) *models.IdempotencyRecord {
+	rec := newRecord()
+	rec.Key = key
+	return rec
+}
@@ -0,0 +1,768 @@
+// Package storagetest provides the conformance test suite for models.DeckStorage implementations.
+//
+// Any storage, in-tree or out-of-tree, can be validated by a single call:
+//
+//	func TestMyStorage(t *testing.T) {
+//		storagetest.RunDeckStorage(t, func(t *testing.T) models.DeckStorage {
+//			return NewMyStorage()
+//		})
+//	}
+package storagetest
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mocak/tbupt/models"
+)
+
+// Factory returns the DeckStorage under test
+// Called once per test case, returned storages may share the underlying data
+type Factory func(t *testing.T) models.DeckStorage
+
+// RunDeckStorage runs the conformance test suite against the storages returned by factory
+// Tests of the optional interfaces are skipped if the storage does not implement them
+func RunDeckStorage(t *testing.T, factory Factory) {
+	t.Run("Create", func(t *testing.T) { testCreate(t, factory(t)) })
+	t.Run("ByUUID not found", func(t *testing.T) { testByUUIDNotFound(t, factory(t)) })
+	t.Run("Update", func(t *testing.T) { testUpdate(t, factory(t)) })
+	t.Run("Update not found", func(t *testing.T) { testUpdateNotFound(t, factory(t)) })
+	t.Run("Update version mismatch", func(t *testing.T) { testUpdateVersionMismatch(t, factory(t)) })
+	t.Run("cards order", func(t *testing.T) { testCardsOrder(t, factory(t)) })
+	t.Run("copy isolation", func(t *testing.T) { testCopyIsolation(t, factory(t)) })
+	t.Run("concurrent access", func(t *testing.T) { testConcurrentAccess(t, factory(t)) })
+	t.Run("consistent reads", func(t *testing.T) { testConsistentReads(t, factory(t)) })
+	t.Run("List", func(t *testing.T) {
+		ds := factory(t)
+		if _, ok := ds.(models.DeckLister); !ok {
+			t.Skip("storage does not implement DeckLister")
+		}
+		testList(t, ds)
+	})
+	t.Run("Delete", func(t *testing.T) {
+		ds := factory(t)
+		if _, ok := ds.(models.DeckDeleter); !ok {
+			t.Skip("storage does not implement DeckDeleter")
+		}
+		testDelete(t, ds)
+	})
+	t.Run("DeleteExpired", func(t *testing.T) {
+		ds := factory(t)
+		if _, ok := ds.(models.DeckExpirer); !ok {
+			t.Skip("storage does not implement DeckExpirer")
+		}
+		testDeleteExpired(t, ds)
+	})
+	t.Run("Events", func(t *testing.T) {
+		ds := factory(t)
+		if _, ok := ds.(models.DeckEventLog); !ok {
+			t.Skip("storage does not implement DeckEventLog")
+		}
+		testEvents(t, ds)
+	})
+	t.Run("Events bounds", func(t *testing.T) {
+		ds := factory(t)
+		if _, ok := ds.(models.DeckEventLog); !ok {
+			t.Skip("storage does not implement DeckEventLog")
+		}
+		testEventsBounds(t, ds)
+	})
+}
+
+// newDeck returns a deck which is not stored yet with the first n cards of the standard deck
+func newDeck(t *testing.T, n int) *models.Deck {
+	cs := models.NewCardService()
+	cards, err := cs.All()
+	if err != nil {
+		t.Fatalf("All() err = %s, want nil", err)
+	}
+	return &models.Deck{
+		UUID:      uuid.NewString(),
+		Cards:     cards[:n],
+		Remaining: n,
+	}
+}
+
+// create persists the deck and fails the test if storage fails
+func create(t *testing.T, ds models.DeckStorage, deck *models.Deck) {
+	if err := ds.Create(deck); err != nil {
+		t.Fatalf("Create() err = %s, want nil", err)
+	}
+}
+
+// mustFind returns stored deck by uuid and fails the test if not found
+func mustFind(t *testing.T, ds models.DeckStorage, uuid string) *models.Deck {
+	found, err := ds.ByUUID(uuid)
+	if err != nil {
+		t.Fatalf("ByUUID() err = %s, want nil", err)
+	}
+	return found
+}
+
+// assertDeckEqual compares decks field by field
+// nil and empty card lists are considered equal
+func assertDeckEqual(t *testing.T, got, want *models.Deck) {
+	t.Helper()
+	if got.UUID != want.UUID {
+		t.Errorf("UUID got = %v, want %v", got.UUID, want.UUID)
+	}
+	if got.Shuffled != want.Shuffled {
+		t.Errorf("Shuffled got = %v, want %v", got.Shuffled, want.Shuffled)
+	}
+	if got.Remaining != want.Remaining {
+		t.Errorf("Remaining got = %v, want %v", got.Remaining, want.Remaining)
+	}
+	if got.Opened != want.Opened {
+		t.Errorf("Opened got = %v, want %v", got.Opened, want.Opened)
+	}
+	if got.Decks != want.Decks || got.Penetration != want.Penetration || got.CutCard != want.CutCard {
+		t.Errorf("shoe got = %v/%v/%v, want %v/%v/%v",
+			got.Decks, got.Penetration, got.CutCard, want.Decks, want.Penetration, want.CutCard)
+	}
+	if got.Dealt != want.Dealt || got.Reshuffle != want.Reshuffle {
+		t.Errorf("Dealt/Reshuffle got = %v/%v, want %v/%v", got.Dealt, got.Reshuffle, want.Dealt, want.Reshuffle)
+	}
+	if !reflect.DeepEqual(got.Seed, want.Seed) || got.Nonce != want.Nonce || got.Shuffler != want.Shuffler {
+		t.Errorf("Seed/Nonce/Shuffler got = %v/%v/%v, want %v/%v/%v",
+			got.Seed, got.Nonce, got.Shuffler, want.Seed, want.Nonce, want.Shuffler)
+	}
+	if !reflect.DeepEqual(got.Composition, want.Composition) {
+		t.Errorf("Composition got = %v, want %v", got.Composition, want.Composition)
+	}
+	if got.Owner != want.Owner || !reflect.DeepEqual(got.Tags, want.Tags) {
+		t.Errorf("Owner/Tags got = %v/%v, want %v/%v", got.Owner, got.Tags, want.Owner, want.Tags)
+	}
+	if got.Principal != want.Principal || !reflect.DeepEqual(got.Grants, want.Grants) {
+		t.Errorf("Principal/Grants got = %v/%v, want %v/%v", got.Principal, got.Grants, want.Principal, want.Grants)
+	}
+	if !reflect.DeepEqual(got.ACL, want.ACL) || !reflect.DeepEqual(got.Shares, want.Shares) {
+		t.Errorf("ACL/Shares got = %v/%v, want %v/%v", got.ACL, got.Shares, want.ACL, want.Shares)
+	}
+	if got.Version != want.Version {
+		t.Errorf("Version got = %v, want %v", got.Version, want.Version)
+	}
+	if got.TTL != want.TTL || !got.ExpiresAt.Equal(want.ExpiresAt) {
+		t.Errorf("TTL/ExpiresAt got = %v/%v, want %v/%v", got.TTL, got.ExpiresAt, want.TTL, want.ExpiresAt)
+	}
+	if !got.CreatedAt.Equal(want.CreatedAt) {
+		t.Errorf("CreatedAt got = %v, want %v", got.CreatedAt, want.CreatedAt)
+	}
+	if !reflect.DeepEqual(got.Fairness, want.Fairness) {
+		t.Errorf("Fairness got = %+v, want %+v", got.Fairness, want.Fairness)
+	}
+	if g, w := codes(got.Cards), codes(want.Cards); g != w {
+		t.Errorf("Cards got = %v, want %v", g, w)
+	}
+	if g, w := codes(got.Drawn), codes(want.Drawn); g != w {
+		t.Errorf("Drawn got = %v, want %v", g, w)
+	}
+	if len(got.Piles) != len(want.Piles) {
+		t.Errorf("Piles got = %v, want %v", got.Piles, want.Piles)
+	}
+	for name, wantPile := range want.Piles {
+		gotPile, ok := got.Piles[name]
+		if !ok {
+			t.Errorf("Piles[%s] not found", name)
+			continue
+		}
+		if g, w := codes(gotPile.Cards), codes(wantPile.Cards); g != w {
+			t.Errorf("Piles[%s] got = %v, want %v", name, g, w)
+		}
+		if gotPile.Remaining != wantPile.Remaining {
+			t.Errorf("Piles[%s] remaining got = %v, want %v", name, gotPile.Remaining, wantPile.Remaining)
+		}
+		if gotPile.Owner != wantPile.Owner || !reflect.DeepEqual(gotPile.Revealed, wantPile.Revealed) {
+			t.Errorf("Piles[%s] Owner/Revealed got = %v/%v, want %v/%v",
+				name, gotPile.Owner, gotPile.Revealed, wantPile.Owner, wantPile.Revealed)
+		}
+	}
+}
+
+func codes(cards []*models.Card) string {
+	s := ""
+	for _, card := range cards {
+		s += fmt.Sprintf("%s:%s:%s,", card.Code, card.Value, card.Suit)
+	}
+	return s
+}
+
+func testCreate(t *testing.T, ds models.DeckStorage) {
+	deck := newDeck(t, 5)
+	deck.Composition = &models.Composition{Name: "piquet", Jokers: 1, Exclude: []string{"7*"}}
+	deck.Decks = 2
+	deck.Penetration = 0.75
+	seed := int64(-42)
+	deck.Seed = &seed
+	deck.Nonce = 3
+	deck.Shuffler = "math"
+	deck.CreatedAt = time.Date(2022, 1, 2, 3, 4, 5, 6000, time.UTC)
+	deck.Owner = "dealer"
+	deck.TTL = 3600
+	deck.ExpiresAt = time.Now().Add(time.Hour).UTC().Truncate(time.Microsecond)
+	deck.Tags = []string{"poker", "table-1"}
+	deck.Principal = "alice"
+	deck.Grants = []string{"bob"}
+	deck.ACL = map[string]string{"carol": models.RoleDraw}
+	deck.Shares = []*models.Share{{ID: "share-1", Role: models.RoleView, TokenHash: "hash", CreatedAt: time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)}}
+	create(t, ds, deck)
+	if deck.Version != 1 {
+		t.Errorf("Create() Version got = %v, want 1", deck.Version)
+	}
+	assertDeckEqual(t, mustFind(t, ds, deck.UUID), deck)
+
+	empty := newDeck(t, 0)
+	create(t, ds, empty)
+	assertDeckEqual(t, mustFind(t, ds, empty.UUID), empty)
+}
+
+func testByUUIDNotFound(t *testing.T, ds models.DeckStorage) {
+	if _, err := ds.ByUUID(uuid.NewString()); err != models.ErrNotFound {
+		t.Errorf("ByUUID() err = %v, want ErrNotFound", err)
+	}
+}
+
+func testUpdate(t *testing.T, ds models.DeckStorage) {
+	deck := newDeck(t, 5)
+	create(t, ds, deck)
+
+	deck.Drawn = deck.Cards[:1]
+	deck.Piles = map[string]*models.Pile{
+		"discard": {Cards: deck.Cards[1:2], Remaining: 1},
+		"empty":   {Remaining: 0},
+		"hand":    {Cards: deck.Cards[2:4], Remaining: 2, Owner: "player", Revealed: []string{deck.Cards[2].Code}},
+	}
+	deck.Cards = deck.Cards[4:]
+	deck.Remaining = len(deck.Cards)
+	deck.Opened = true
+	deck.Dealt = 4
+	deck.Fairness = &models.Fairness{
+		ServerSeedHash: "hash",
+		Commitment:     "commitment",
+		ClientSeed:     "client",
+		Nonce:          1,
+		Initial:        []string{"AS", "KH"},
+		ServerSeed:     "server",
+		Secret:         "server",
+	}
+	if err := ds.Update(deck); err != nil {
+		t.Fatalf("Update() err = %s, want nil", err)
+	}
+	if deck.Version != 2 {
+		t.Errorf("Update() Version got = %v, want 2", deck.Version)
+	}
+	assertDeckEqual(t, mustFind(t, ds, deck.UUID), deck)
+
+	deck.Cards = nil
+	deck.Remaining = 0
+	deck.Drawn = nil
+	deck.Piles = nil
+	if err := ds.Update(deck); err != nil {
+		t.Fatalf("Update() err = %s, want nil", err)
+	}
+	assertDeckEqual(t, mustFind(t, ds, deck.UUID), deck)
+}
+
+func testUpdateNotFound(t *testing.T, ds models.DeckStorage) {
+	deck := newDeck(t, 1)
+	if err := ds.Update(deck); err != models.ErrNotFound {
+		t.Errorf("Update() err = %v, want ErrNotFound", err)
+	}
+	if _, err := ds.ByUUID(deck.UUID); err != models.ErrNotFound {
+		t.Errorf("ByUUID() after failed Update err = %v, want ErrNotFound", err)
+	}
+}
+
+func testUpdateVersionMismatch(t *testing.T, ds models.DeckStorage) {
+	deck := newDeck(t, 5)
+	create(t, ds, deck)
+	stale := mustFind(t, ds, deck.UUID)
+
+	deck.Cards = deck.Cards[1:]
+	deck.Remaining = len(deck.Cards)
+	if err := ds.Update(deck); err != nil {
+		t.Fatalf("Update() err = %s, want nil", err)
+	}
+
+	stale.Opened = true
+	if err := ds.Update(stale); err != models.ErrVersionMismatch {
+		t.Errorf("Update() err = %v, want ErrVersionMismatch", err)
+	}
+	if stale.Version != 1 {
+		t.Errorf("Update() Version got = %v, want 1", stale.Version)
+	}
+	assertDeckEqual(t, mustFind(t, ds, deck.UUID), deck)
+}
+
+func testCardsOrder(t *testing.T, ds models.DeckStorage) {
+	deck := newDeck(t, 52)
+	reversed := make([]*models.Card, len(deck.Cards))
+	for i, card := range deck.Cards {
+		reversed[len(reversed)-1-i] = card
+	}
+	deck.Cards = reversed
+	create(t, ds, deck)
+	assertDeckEqual(t, mustFind(t, ds, deck.UUID), deck)
+
+	deck.Cards = append([]*models.Card{deck.Cards[51]}, deck.Cards[:51]...)
+	if err := ds.Update(deck); err != nil {
+		t.Fatalf("Update() err = %s, want nil", err)
+	}
+	assertDeckEqual(t, mustFind(t, ds, deck.UUID), deck)
+}
+
+func testCopyIsolation(t *testing.T, ds models.DeckStorage) {
+	deck := newDeck(t, 5)
+	create(t, ds, deck)
+	want := *deck
+	want.Cards = append([]*models.Card(nil), deck.Cards...)
+
+	// changing piles of the stored deck must not change the stored one
+	withPiles := newDeck(t, 5)
+	withPiles.Piles = map[string]*models.Pile{"discard": {Cards: withPiles.Cards[:1], Remaining: 1}}
+	create(t, ds, withPiles)
+	wantCode := withPiles.Piles["discard"].Cards[0].Code
+	withPiles.Piles["discard"].Cards[0] = withPiles.Cards[2]
+	found := mustFind(t, ds, withPiles.UUID)
+	found.Piles["discard"].Cards = nil
+	if got := mustFind(t, ds, withPiles.UUID).Piles["discard"]; len(got.Cards) != 1 || got.Cards[0].Code != wantCode {
+		t.Errorf("Piles[discard] got = %v, want %v", codes(got.Cards), wantCode)
+	}
+
+	// changing the created deck must not change the stored one
+	deck.Cards[0] = deck.Cards[1]
+	deck.Opened = !deck.Opened
+	assertDeckEqual(t, mustFind(t, ds, deck.UUID), &want)
+
+	// changing the found deck must not change the stored one
+	found = mustFind(t, ds, deck.UUID)
+	found.Piles = map[string]*models.Pile{"discard": {}}
+	found.Cards[0] = found.Cards[1]
+	found.Cards = found.Cards[:1]
+	found.Remaining = 1
+	assertDeckEqual(t, mustFind(t, ds, deck.UUID), &want)
+}
+
+func testConcurrentAccess(t *testing.T, ds models.DeckStorage) {
+	shared := newDeck(t, 52)
+	create(t, ds, shared)
+
+	// concurrent updates of the same version must succeed only once
+	stale := make([]*models.Deck, 10)
+	for i := range stale {
+		stale[i] = mustFind(t, ds, shared.UUID)
+	}
+	var updated int32
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			deck := newDeck(t, 10)
+			if err := ds.Create(deck); err != nil {
+				t.Errorf("Create() err = %s, want nil", err)
+				return
+			}
+			for j := 0; j < 5; j++ {
+				found, err := ds.ByUUID(deck.UUID)
+				if err != nil {
+					t.Errorf("ByUUID() err = %s, want nil", err)
+					return
+				}
+				found.Cards = found.Cards[1:]
+				found.Remaining = len(found.Cards)
+				if err := ds.Update(found); err != nil {
+					t.Errorf("Update() err = %s, want nil", err)
+					return
+				}
+			}
+			found, err := ds.ByUUID(deck.UUID)
+			if err != nil {
+				t.Errorf("ByUUID() err = %s, want nil", err)
+				return
+			}
+			if found.Remaining != 5 || len(found.Cards) != 5 {
+				t.Errorf("Remaining got = %v, want 5", found.Remaining)
+			}
+		}()
+		go func(found *models.Deck) {
+			defer wg.Done()
+			switch err := ds.Update(found); err {
+			case nil:
+				atomic.AddInt32(&updated, 1)
+			case models.ErrVersionMismatch:
+			default:
+				t.Errorf("Update() err = %s, want nil or ErrVersionMismatch", err)
+			}
+		}(stale[i])
+	}
+	wg.Wait()
+
+	if updated != 1 {
+		t.Errorf("Update() succeeded %v times on the same version, want 1", updated)
+	}
+	shared.Version = 2
+	assertDeckEqual(t, mustFind(t, ds, shared.UUID), shared)
+}
+
+// testConsistentReads checks the decks found during updates are the state of a single version
+func testConsistentReads(t *testing.T, ds models.DeckStorage) {
+	deck := newDeck(t, 52)
+	create(t, ds, deck)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 40; i++ {
+			found, err := ds.ByUUID(deck.UUID)
+			if err != nil {
+				t.Errorf("ByUUID() err = %s, want nil", err)
+				return
+			}
+			found.Drawn = append(found.Drawn, found.Cards[0])
+			found.Cards = found.Cards[1:]
+			found.Remaining = len(found.Cards)
+			if err := ds.Update(found); err != nil {
+				t.Errorf("Update() err = %s, want nil", err)
+				return
+			}
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		found, err := ds.ByUUID(deck.UUID)
+		if err != nil {
+			t.Errorf("ByUUID() err = %s, want nil", err)
+			<-done
+			return
+		}
+		if drawn := found.Version - 1; len(found.Drawn) != drawn || len(found.Cards) != 52-drawn || found.Remaining != 52-drawn {
+			t.Errorf("ByUUID() got version %d with %d cards, %d remaining and %d drawn, want %d drawn",
+				found.Version, len(found.Cards), found.Remaining, len(found.Drawn), drawn)
+			<-done
+			return
+		}
+	}
+}
+
+func testList(t *testing.T, ds models.DeckStorage) {
+	lister := ds.(models.DeckLister)
+	// decks are isolated from the other tests by a unique owner
+	owner := uuid.NewString()
+	base := time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+	decks := make([]*models.Deck, 5)
+	for i := range decks {
+		deck := newDeck(t, i+1)
+		deck.Owner = owner
+		deck.CreatedAt = base.Add(time.Duration(i) * time.Minute)
+		deck.Opened = i%2 == 1
+		deck.Shuffled = i >= 3
+		if i < 2 {
+			deck.Tags = []string{"poker", "50%_off"}
+		}
+		if i < 3 {
+			deck.Principal = "alice"
+		}
+		switch i {
+		case 0:
+			deck.ACL = map[string]string{"bob": models.RoleView}
+		case 1:
+			deck.Grants = []string{"carol"}
+			deck.ACL = map[string]string{"dave": models.RoleDraw}
+		}
+		create(t, ds, deck)
+		decks[i] = deck
+	}
+	truth, lie := true, false
+	two, four := 2, 4
+
+	tests := []struct {
+		name   string
+		filter models.DeckFilter
+		want   []*models.Deck
+	}{
+		{name: "owner", filter: models.DeckFilter{}, want: decks},
+		{name: "opened", filter: models.DeckFilter{Opened: &truth}, want: []*models.Deck{decks[1], decks[3]}},
+		{name: "not opened", filter: models.DeckFilter{Opened: &lie}, want: []*models.Deck{decks[0], decks[2], decks[4]}},
+		{name: "shuffled", filter: models.DeckFilter{Shuffled: &truth}, want: decks[3:]},
+		{name: "created after", filter: models.DeckFilter{CreatedAfter: decks[2].CreatedAt}, want: decks[3:]},
+		{name: "created before", filter: models.DeckFilter{CreatedBefore: decks[2].CreatedAt}, want: decks[:2]},
+		{name: "remaining", filter: models.DeckFilter{MinRemaining: &two, MaxRemaining: &four}, want: decks[1:4]},
+		{name: "tag", filter: models.DeckFilter{Tag: "poker"}, want: decks[:2]},
+		{name: "tag with wildcards", filter: models.DeckFilter{Tag: "50%_off"}, want: decks[:2]},
+		{name: "tag prefix", filter: models.DeckFilter{Tag: "pok"}, want: nil},
+		{name: "principal", filter: models.DeckFilter{Principal: "alice"}, want: decks[:3]},
+		{name: "principal of owner label", filter: models.DeckFilter{Principal: owner}, want: nil},
+		{name: "viewer of owned decks", filter: models.DeckFilter{Viewer: "alice"}, want: decks},
+		{name: "viewer in acl", filter: models.DeckFilter{Viewer: "bob"}, want: []*models.Deck{decks[0], decks[2], decks[3], decks[4]}},
+		{name: "viewer granted", filter: models.DeckFilter{Viewer: "carol"}, want: decks[1:]},
+		{name: "viewer without role", filter: models.DeckFilter{Viewer: "eve"}, want: decks[2:]},
+		{name: "viewer prefix", filter: models.DeckFilter{Viewer: "bo"}, want: decks[2:]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.filter.Owner = owner
+			page, err := lister.List(tt.filter)
+			if err != nil {
+				t.Fatalf("List() err = %s, want nil", err)
+			}
+			assertDeckUUIDs(t, page.Decks, tt.want)
+			if page.NextCursor != "" {
+				t.Errorf("List() next cursor = %v, want empty", page.NextCursor)
+			}
+		})
+	}
+
+	t.Run("expired", func(t *testing.T) {
+		now := time.Now().UTC().Truncate(time.Microsecond)
+		expiring := uuid.NewString()
+		expired, alive := newDeck(t, 1), newDeck(t, 1)
+		expired.Owner, alive.Owner = expiring, expiring
+		expired.ExpiresAt, alive.ExpiresAt = now.Add(-time.Minute), now.Add(time.Hour)
+		create(t, ds, expired)
+		create(t, ds, alive)
+		page, err := lister.List(models.DeckFilter{Owner: expiring, ExpiresAfter: now})
+		if err != nil {
+			t.Fatalf("List() err = %s, want nil", err)
+		}
+		assertDeckUUIDs(t, page.Decks, []*models.Deck{alive})
+	})
+
+	t.Run("pagination", func(t *testing.T) {
+		var got []*models.Deck
+		filter := models.DeckFilter{Owner: owner, Limit: 2}
+		for pages := 0; ; pages++ {
+			if pages > len(decks) {
+				t.Fatalf("List() did not end after %d pages", pages)
+			}
+			page, err := lister.List(filter)
+			if err != nil {
+				t.Fatalf("List() err = %s, want nil", err)
+			}
+			if len(page.Decks) > 2 || page.Limit != 2 {
+				t.Fatalf("List() got %d decks and limit %d, want at most 2", len(page.Decks), page.Limit)
+			}
+			got = append(got, page.Decks...)
+			if page.NextCursor == "" {
+				break
+			}
+			filter.Cursor = page.NextCursor
+		}
+		assertDeckUUIDs(t, got, decks)
+		for i, deck := range got {
+			assertDeckEqual(t, deck, decks[i])
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		if _, err := lister.List(models.DeckFilter{Cursor: "!"}); err != models.ErrCursorInvalid {
+			t.Errorf("List() err = %v, want ErrCursorInvalid", err)
+		}
+		if _, err := lister.List(models.DeckFilter{Limit: models.MaxListLimit + 1}); err != models.ErrLimitInvalid {
+			t.Errorf("List() err = %v, want ErrLimitInvalid", err)
+		}
+	})
+}
+
+// assertDeckUUIDs compares the order of the decks by uuid
+func assertDeckUUIDs(t *testing.T, got, want []*models.Deck) {
+	t.Helper()
+	ids := func(decks []*models.Deck) []string {
+		s := make([]string, len(decks))
+		for i, deck := range decks {
+			s[i] = deck.UUID
+		}
+		return s
+	}
+	if g, w := ids(got), ids(want); !reflect.DeepEqual(g, w) {
+		t.Errorf("decks got = %v, want %v", g, w)
+	}
+}
+
+func testDelete(t *testing.T, ds models.DeckStorage) {
+	deleter := ds.(models.DeckDeleter)
+	deck := newDeck(t, 5)
+	deck.Piles = map[string]*models.Pile{"discard": {Cards: deck.Cards[:1], Remaining: 1}}
+	deck.Cards = deck.Cards[1:]
+	deck.Remaining = len(deck.Cards)
+	create(t, ds, deck)
+	other := newDeck(t, 1)
+	create(t, ds, other)
+
+	if err := deleter.Delete(deck.UUID); err != nil {
+		t.Fatalf("Delete() err = %s, want nil", err)
+	}
+	if _, err := ds.ByUUID(deck.UUID); err != models.ErrNotFound {
+		t.Errorf("ByUUID() after Delete err = %v, want ErrNotFound", err)
+	}
+	if err := deleter.Delete(deck.UUID); err != models.ErrNotFound {
+		t.Errorf("Delete() twice err = %v, want ErrNotFound", err)
+	}
+	assertDeckEqual(t, mustFind(t, ds, other.UUID), other)
+
+	// uuid of a deleted deck can be reused
+	create(t, ds, deck)
+	assertDeckEqual(t, mustFind(t, ds, deck.UUID), deck)
+}
+
+func testDeleteExpired(t *testing.T, ds models.DeckStorage) {
+	expirer := ds.(models.DeckExpirer)
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	expired := newDeck(t, 3)
+	expired.ExpiresAt = now.Add(-time.Minute)
+	expired.Drawn = expired.Cards[:1]
+	expired.Cards = expired.Cards[1:]
+	create(t, ds, expired)
+	alive := newDeck(t, 3)
+	alive.ExpiresAt = now.Add(time.Hour)
+	create(t, ds, alive)
+	forever := newDeck(t, 3)
+	create(t, ds, forever)
+
+	n, err := expirer.DeleteExpired(now)
+	if err != nil {
+		t.Fatalf("DeleteExpired() err = %s, want nil", err)
+	}
+	// storages may be shared by other tests, at least the expired deck is removed
+	if n < 1 {
+		t.Errorf("DeleteExpired() got = %v, want >= 1", n)
+	}
+	if _, err := ds.ByUUID(expired.UUID); err != models.ErrNotFound {
+		t.Errorf("ByUUID() of expired deck err = %v, want ErrNotFound", err)
+	}
+	assertDeckEqual(t, mustFind(t, ds, alive.UUID), alive)
+	assertDeckEqual(t, mustFind(t, ds, forever.UUID), forever)
+}
+
+func testEvents(t *testing.T, ds models.DeckStorage) {
+	log := ds.(models.DeckEventLog)
+	deck := newDeck(t, 5)
+	create(t, ds, deck)
+
+	at := time.Date(2022, 1, 2, 3, 4, 5, 6000, time.UTC)
+	want := []*models.DeckEvent{
+		{DeckID: deck.UUID, Seq: 1, Type: models.EventCreated, At: at, State: &models.DeckState{Cards: deck.Cards}},
+		{DeckID: deck.UUID, Seq: 2, Type: models.EventDrawn, At: at, Actor: "dealer", Cards: []string{deck.Cards[0].Code},
+			State: &models.DeckState{Cards: deck.Cards[1:], Drawn: deck.Cards[:1], Dealt: 1, Nonce: 2}},
+		{DeckID: deck.UUID, Seq: 3, Type: models.EventPileAdded, At: at, Pile: "hand", Cards: []string{deck.Cards[0].Code},
+			State: &models.DeckState{Cards: deck.Cards[1:], Piles: map[string]*models.Pile{
+				"hand": {Cards: deck.Cards[:1], Remaining: 1},
+			}, Shuffled: true, Opened: true, Reshuffle: true}},
+		{DeckID: deck.UUID, Seq: 4, Type: models.EventCardsMoved, At: at, Pile: "hand", To: "discard"},
+		{DeckID: deck.UUID, Seq: 5, Type: models.EventUndone, At: at, Reverts: 4, Cards: []string{deck.Cards[0].Code}},
+	}
+	for _, event := range want {
+		if err := log.AppendEvent(event); err != nil {
+			t.Fatalf("AppendEvent() err = %s, want nil", err)
+		}
+	}
+	other := newDeck(t, 1)
+	create(t, ds, other)
+	if err := log.AppendEvent(&models.DeckEvent{DeckID: other.UUID, Seq: 1, Type: models.EventCreated, At: at}); err != nil {
+		t.Fatalf("AppendEvent() err = %s, want nil", err)
+	}
+
+	tests := []struct {
+		name  string
+		after int
+		limit int
+		want  []*models.DeckEvent
+	}{
+		{name: "all", want: want},
+		{name: "after", after: 2, want: want[2:]},
+		{name: "limit", after: 1, limit: 2, want: want[1:3]},
+		{name: "none", after: 5, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := log.Events(deck.UUID, tt.after, tt.limit)
+			if err != nil {
+				t.Fatalf("Events() err = %s, want nil", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Events() len got = %v, want %v", len(got), len(tt.want))
+			}
+			for i := range got {
+				assertEventEqual(t, got[i], tt.want[i])
+			}
+		})
+	}
+
+	// changing the found event must not change the stored one
+	found, _ := log.Events(deck.UUID, 1, 1)
+	found[0].Cards[0] = "XX"
+	found[0].State.Drawn[0] = deck.Cards[4]
+	found, _ = log.Events(deck.UUID, 1, 1)
+	assertEventEqual(t, found[0], want[1])
+
+	if deleter, ok := ds.(models.DeckDeleter); ok {
+		if err := deleter.Delete(deck.UUID); err != nil {
+			t.Fatalf("Delete() err = %s, want nil", err)
+		}
+		if got, _ := log.Events(deck.UUID, 0, 0); len(got) != 0 {
+			t.Errorf("Events() after Delete got = %v, want none", len(got))
+		}
+	}
+}
+
+func testEventsBounds(t *testing.T, ds models.DeckStorage) {
+	log := ds.(models.DeckEventLog)
+	deck := newDeck(t, 1)
+	create(t, ds, deck)
+	for seq := 1; seq <= models.EventLimit+10; seq++ {
+		event := &models.DeckEvent{DeckID: deck.UUID, Seq: seq, Type: models.EventShuffled, State: &models.DeckState{}}
+		if err := log.AppendEvent(event); err != nil {
+			t.Fatalf("AppendEvent() err = %s, want nil", err)
+		}
+	}
+	events, err := log.Events(deck.UUID, 0, 0)
+	if err != nil {
+		t.Fatalf("Events() err = %s, want nil", err)
+	}
+	if len(events) != models.EventLimit || events[0].Seq != 11 {
+		t.Fatalf("Events() got %v events from seq %v, want %v from 11", len(events), events[0].Seq, models.EventLimit)
+	}
+	for i, event := range events {
+		if wantState := i >= len(events)-models.EventStates; (event.State != nil) != wantState {
+			t.Errorf("Events()[%d] has state = %v, want %v", i, event.State != nil, wantState)
+		}
+	}
+}
+
+// assertEventEqual compares events field by field
+func assertEventEqual(t *testing.T, got, want *models.DeckEvent) {
+	t.Helper()
+	if got.DeckID != want.DeckID || got.Seq != want.Seq || got.Type != want.Type || got.Actor != want.Actor {
+		t.Errorf("DeckID/Seq/Type/Actor got = %v/%v/%v/%v, want %v/%v/%v/%v",
+			got.DeckID, got.Seq, got.Type, got.Actor, want.DeckID, want.Seq, want.Type, want.Actor)
+	}
+	if !got.At.Equal(want.At) {
+		t.Errorf("At got = %v, want %v", got.At, want.At)
+	}
+	if !reflect.DeepEqual(got.Cards, want.Cards) || got.Pile != want.Pile || got.To != want.To || got.Reverts != want.Reverts {
+		t.Errorf("Cards/Pile/To/Reverts got = %v/%v/%v/%v, want %v/%v/%v/%v",
+			got.Cards, got.Pile, got.To, got.Reverts, want.Cards, want.Pile, want.To, want.Reverts)
+	}
+	if (got.State == nil) != (want.State == nil) {
+		t.Fatalf("State got = %v, want %v", got.State, want.State)
+	}
+	if want.State == nil {
+		return
+	}
+	g, w := &models.Deck{Piles: got.State.Piles}, &models.Deck{Piles: want.State.Piles}
+	g.Cards, g.Drawn, w.Cards, w.Drawn = got.State.Cards, got.State.Drawn, want.State.Cards, want.State.Drawn
+	assertDeckEqual(t, g, w)
+	gs, ws := *got.State, *want.State
+	gs.Cards, gs.Drawn, gs.Piles, ws.Cards, ws.Drawn, ws.Piles = nil, nil, nil, nil, nil, nil
+	if !reflect.DeepEqual(gs, ws) {
+		t.Errorf("State got = %+v, want %+v", gs, ws)
+	}
+}
@@ -0,0 +1,130 @@
+package models
+
+import (
+	"errors"
+)
+
+var (
+	ErrStrategyUnknown = errors.New("strategy must be uniform, riffle, overhand, strip or cut")
+	ErrTimesInvalid    = errors.New("times must be between 1 and 100")
+)
+
+// Strategies of the in-place shuffle
+const (
+	// StrategyUniform is the uniform permutation by the deck shuffler
+	StrategyUniform = "uniform"
+	// StrategyRiffle splits the cards into halves and interleaves them by Gilbert-Shannon-Reeds model
+	StrategyRiffle = "riffle"
+	// StrategyOverhand moves small packets from the top onto a new pile in hand
+	StrategyOverhand = "overhand"
+	// StrategyStrip moves large packets from the top onto a new pile on the table
+	StrategyStrip = "strip"
+	// StrategyCut moves a packet from the top to the bottom, cutting around the middle
+	StrategyCut = "cut"
+)
+
+// maxShuffleTimes is the maximum number of times a strategy is applied at once
+const maxShuffleTimes = 100
+
+// ShuffleOptions are the options of the in-place shuffle of the remaining cards
+type ShuffleOptions struct {
+	// Discarded puts the discard pile back before shuffling
+	Discarded bool
+	// Strategy is the shuffle strategy, StrategyUniform by default
+	Strategy string
+	// Times is the number of times the strategy is applied, 1 by default
+	Times int
+}
+
+// strategy returns the shuffled cards, cards must not be changed
+type strategy func(cards []*Card, s Shuffler) []*Card
+
+// strategies are the named shuffle strategies
+var strategies = map[string]strategy{
+	StrategyUniform:  uniform,
+	StrategyRiffle:   riffle,
+	StrategyOverhand: overhand,
+	StrategyStrip:    strip,
+	StrategyCut:      cut,
+}
+
+// normalize sets the defaults of the options
+// Returns ErrStrategyUnknown if strategy is unknown
+// Returns ErrTimesInvalid if times is out of range
+func (o *ShuffleOptions) normalize() error {
+	if o.Strategy == "" {
+		o.Strategy = StrategyUniform
+	}
+	if _, ok := strategies[o.Strategy]; !ok {
+		return ErrStrategyUnknown
+	}
+	if o.Times == 0 {
+		o.Times = 1
+	}
+	if o.Times < 1 || o.Times > maxShuffleTimes {
+		return ErrTimesInvalid
+	}
+	return nil
+}
+
+func uniform(cards []*Card, s Shuffler) []*Card {
+	shuffled := append([]*Card{}, cards...)
+	s.Shuffle(shuffled)
+	return shuffled
+}
+
+// riffle cuts the cards binomially and drops cards from each packet
+// with probability proportional to the packet size
+func riffle(cards []*Card, s Shuffler) []*Card {
+	k := 0
+	for range cards {
+		k += s.Intn(2)
+	}
+	left, right := cards[:k], cards[k:]
+	shuffled := make([]*Card, 0, len(cards))
+	for len(left) > 0 || len(right) > 0 {
+		if s.Intn(len(left)+len(right)) < len(left) {
+			shuffled, left = append(shuffled, left[0]), left[1:]
+		} else {
+			shuffled, right = append(shuffled, right[0]), right[1:]
+		}
+	}
+	return shuffled
+}
+
+func overhand(cards []*Card, s Shuffler) []*Card {
+	return packets(cards, s, len(cards)/8+1)
+}
+
+func strip(cards []*Card, s Shuffler) []*Card {
+	return packets(cards, s, len(cards)/3+1)
+}
+
+// packets moves packets of 1 to maxPacket cards from the top onto a new pile
+// Order of the packets is reversed, order of the cards in a packet is kept
+func packets(cards []*Card, s Shuffler, maxPacket int) []*Card {
+	shuffled := make([]*Card, len(cards))
+	end := len(cards)
+	for len(cards) > 0 {
+		size := 1 + s.Intn(maxPacket)
+		if size > len(cards) {
+			size = len(cards)
+		}
+		copy(shuffled[end-size:end], cards[:size])
+		cards, end = cards[size:], end-size
+	}
+	return shuffled
+}
+
+// cut moves the top of the cards to the bottom
+// Cut point is in the middle half of the cards
+func cut(cards []*Card, s Shuffler) []*Card {
+	if len(cards) < 2 {
+		return append([]*Card{}, cards...)
+	}
+	k := len(cards)/4 + s.Intn(len(cards)/2+1)
+	if k == 0 {
+		k = 1
+	}
+	return append(append([]*Card{}, cards[k:]...), cards[:k]...)
+}
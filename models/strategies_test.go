@@ -0,0 +1,140 @@
+package models
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// fixedShuffler returns the same number for every Intn call, capped by n-1
+type fixedShuffler int
+
+func (f fixedShuffler) Shuffle(cards []*Card) {}
+
+func (f fixedShuffler) Intn(n int) int {
+	if int(f) >= n {
+		return n - 1
+	}
+	return int(f)
+}
+
+func testCards(t *testing.T, codes string) []*Card {
+	t.Helper()
+	if codes == "" {
+		return []*Card{}
+	}
+	cards, err := NewCardService().ByCodesStr(codes)
+	if err != nil {
+		t.Fatalf("ByCodesStr() err = %s, want nil", err)
+	}
+	return cards
+}
+
+func joinCodes(cards []*Card) string {
+	return strings.Join(cardCodes(cards), ",")
+}
+
+func Test_strategies_Permutation(t *testing.T) {
+	all, _ := NewCardService().All()
+	for name, strategy := range strategies {
+		for _, n := range []int{0, 1, 2, 5, 52} {
+			cards := all[:n]
+			before := joinCodes(cards)
+			got := cardCodes(strategy(cards, &fisherYates{deckRand(&Deck{})}))
+			if joinCodes(cards) != before {
+				t.Errorf("%s() changed the given cards", name)
+			}
+			want := cardCodes(cards)
+			sort.Strings(got)
+			sort.Strings(want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s() of %d cards got = %v, want permutation of %v", name, n, got, want)
+			}
+		}
+	}
+}
+
+func Test_strategies_Fixed(t *testing.T) {
+	cards := "AS,2S,3S,4S,5S,6S"
+	tests := []struct {
+		name     string
+		strategy strategy
+		shuffler fixedShuffler
+		want     string
+	}{
+		// every coin lands 1, all cards are cut into the left packet
+		{name: "riffle", strategy: riffle, shuffler: 1, want: "AS,2S,3S,4S,5S,6S"},
+		{name: "riffle from right", strategy: riffle, shuffler: 0, want: "AS,2S,3S,4S,5S,6S"},
+		{name: "overhand", strategy: overhand, shuffler: 1, want: "6S,5S,4S,3S,2S,AS"},
+		{name: "strip", strategy: strip, shuffler: 1, want: "5S,6S,3S,4S,AS,2S"},
+		{name: "cut", strategy: cut, shuffler: 1, want: "3S,4S,5S,6S,AS,2S"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := joinCodes(tt.strategy(testCards(t, cards), tt.shuffler)); got != tt.want {
+				t.Errorf("%s() got = %v, want %v", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_riffle_RisingSequences(t *testing.T) {
+	all, _ := NewCardService().All()
+	for i := 0; i < 100; i++ {
+		got := riffle(all, &fisherYates{deckRand(&Deck{})})
+		position := map[*Card]int{}
+		for j, card := range got {
+			position[card] = j
+		}
+		// a single riffle interleaves two packets, so it has at most 2 rising sequences
+		rising := 1
+		for j := 1; j < len(all); j++ {
+			if position[all[j]] < position[all[j-1]] {
+				rising++
+			}
+		}
+		if rising > 2 {
+			t.Fatalf("riffle() got %d rising sequences, want at most 2: %v", rising, joinCodes(got))
+		}
+	}
+}
+
+func Test_deckService_Shuffle_Strategy(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    ShuffleOptions
+		wantErr error
+	}{
+		{name: "default", opts: ShuffleOptions{}},
+		{name: "riffle", opts: ShuffleOptions{Strategy: StrategyRiffle, Times: 7}},
+		{name: "overhand", opts: ShuffleOptions{Strategy: StrategyOverhand, Times: 10}},
+		{name: "strip", opts: ShuffleOptions{Strategy: StrategyStrip}},
+		{name: "cut", opts: ShuffleOptions{Strategy: StrategyCut}},
+		{name: "unknown", opts: ShuffleOptions{Strategy: "pile"}, wantErr: ErrStrategyUnknown},
+		{name: "negative times", opts: ShuffleOptions{Times: -1}, wantErr: ErrTimesInvalid},
+		{name: "too many times", opts: ShuffleOptions{Times: maxShuffleTimes + 1}, wantErr: ErrTimesInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ds := NewDeckService(NewCardService())
+			deck := Deck{}
+			if err := ds.Create(&deck); err != nil {
+				t.Fatalf("Create() err = %s, want nil", err)
+			}
+			before := joinCodes(deck.Cards)
+			if err := ds.Shuffle(&deck, tt.opts); err != tt.wantErr {
+				t.Fatalf("Shuffle() err = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if !deck.Shuffled || deck.Remaining != 52 {
+				t.Errorf("Shuffle() shuffled/remaining = %v/%v, want true/52", deck.Shuffled, deck.Remaining)
+			}
+			if joinCodes(deck.Cards) == before {
+				t.Errorf("Shuffle() cards not shuffled")
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package models
+
+import "errors"
+
+var (
+	ErrNothingToUndo   = errors.New("there is no operation to undo")
+	ErrVersionRequired = errors.New("deck version is required to undo")
+)
+
+// DefaultUndoDepth is the number of the operations can be undone in a row by default
+const DefaultUndoDepth = 10
+
+// undoable are the event types of the operations can be undone
+var undoable = map[string]bool{
+	EventDrawn:       true,
+	EventReturned:    true,
+	EventShuffled:    true,
+	EventOpened:      true,
+	EventPileAdded:   true,
+	EventPileDrawn:   true,
+	EventCardsMoved:  true,
+	EventPileClaimed: true,
+	EventDealt:       true,
+}
+
+// WithUndoDepth sets the number of the operations can be undone in a row
+// Undo is disabled if depth is not positive
+func WithUndoDepth(depth int) DeckServiceOption {
+	return func(cfg *deckServiceConfig) {
+		cfg.undoDepth = depth
+	}
+}
+
+// Undo reverts the latest operation of the deck which is not undone yet
+// IfMatch of the deck is required, so the operations of the other clients since are not reverted
+// Opening of the decks with fairness proof can not be undone since their server seed is revealed
+// Returns ErrEventsNotSupported if storage does not implement DeckEventLog
+// Returns ErrVersionRequired if IfMatch of the deck is not set
+// Returns ErrVersionMismatch if deck is changed since IfMatch version
+// Returns ErrNothingToUndo if there is no operation to undo within the undo depth
+func (ds *deckService) Undo(deck *Deck) error {
+	if ds.events == nil {
+		return ErrEventsNotSupported
+	}
+	if deck.IfMatch == 0 {
+		return ErrVersionRequired
+	}
+	event := &DeckEvent{Type: EventUndone}
+	return ds.modify(deck, event, func(deck *Deck) ([]*Card, error) {
+		target, err := ds.undoTarget(deck)
+		if err != nil {
+			return nil, err
+		}
+		prev, err := ds.eventAt(deck.UUID, target.Seq-1)
+		if err != nil {
+			return nil, err
+		}
+		deck.setState(prev.State)
+		event.Reverts = target.Seq
+		event.Cards = target.Cards
+		return nil, nil
+	})
+}
+
+// undoTarget returns the latest operation event of the deck which is not undone yet
+// Returns ErrNothingToUndo if there is no such operation within the undo depth
+func (ds *deckService) undoTarget(deck *Deck) (*DeckEvent, error) {
+	undos := 0
+	for seq := deck.Version; ; seq-- {
+		event, err := ds.eventAt(deck.UUID, seq)
+		if err != nil {
+			return nil, err
+		}
+		if event.Type != EventUndone {
+			break
+		}
+		undos++
+	}
+	if undos >= ds.undoDepth {
+		return nil, ErrNothingToUndo
+	}
+
+	seq := deck.Version
+	for {
+		event, err := ds.eventAt(deck.UUID, seq)
+		if err != nil {
+			return nil, err
+		}
+		if event.Type != EventUndone {
+			if !undoable[event.Type] || event.Type == EventOpened && deck.Fairness != nil {
+				return nil, ErrNothingToUndo
+			}
+			return event, nil
+		}
+		// state of the deck is the state before the reverted event
+		seq = event.Reverts - 1
+	}
+}
+
+// eventAt returns the event of the deck by sequence
+// Returns ErrNothingToUndo if event or its state is not recorded
+func (ds *deckService) eventAt(uuid string, seq int) (*DeckEvent, error) {
+	events, err := ds.events.Events(uuid, seq-1, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(events) == 0 || events[0].Seq != seq || events[0].State == nil {
+		return nil, ErrNothingToUndo
+	}
+	return events[0], nil
+}
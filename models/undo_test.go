@@ -0,0 +1,147 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+// undo reverts the latest operation of the deck on its current version
+func undo(ds DeckService, deck *Deck) error {
+	deck.IfMatch = deck.Version
+	return ds.Undo(deck)
+}
+
+func Test_deckService_Undo(t *testing.T) {
+	ds := NewDeckService(NewCardService())
+	deck := &Deck{}
+	if err := ds.Create(deck); err != nil {
+		t.Fatalf("Create() err = %s, want nil", err)
+	}
+	states := []*DeckState{deck.state()}
+	mutations := []func() error{
+		func() error { _, err := ds.Draw(deck, 3); return err },
+		func() error { return ds.AddToPile(deck, "hand", nil) },
+		func() error { return ds.Shuffle(deck, ShuffleOptions{}) },
+		func() error { return ds.Open(deck) },
+	}
+	for _, mutate := range mutations {
+		if err := mutate(); err != nil {
+			t.Fatalf("mutation err = %s, want nil", err)
+		}
+		states = append(states, deck.state())
+	}
+
+	for i := len(states) - 2; i >= 0; i-- {
+		if err := undo(ds, deck); err != nil {
+			t.Fatalf("Undo() err = %s, want nil", err)
+		}
+		if got := deck.state(); !reflect.DeepEqual(got, states[i]) {
+			t.Errorf("Undo() state = %+v, want %+v", got, states[i])
+		}
+	}
+	if err := undo(ds, deck); err != ErrNothingToUndo {
+		t.Errorf("Undo() err = %v, want ErrNothingToUndo", err)
+	}
+
+	page, err := ds.Events(deck.UUID, 5, 0)
+	if err != nil {
+		t.Fatalf("Events() err = %s, want nil", err)
+	}
+	for i, event := range page.Events {
+		if event.Type != EventUndone || event.Reverts != 5-i {
+			t.Errorf("Events()[%d] = %v reverts %v, want undone reverts %v", i, event.Type, event.Reverts, 5-i)
+		}
+	}
+}
+
+func Test_deckService_Undo_AfterNewOperation(t *testing.T) {
+	ds := NewDeckService(NewCardService())
+	deck := &Deck{}
+	if err := ds.Create(deck); err != nil {
+		t.Fatalf("Create() err = %s, want nil", err)
+	}
+	created := deck.state()
+	for _, count := range []int{1, 2} {
+		if _, err := ds.Draw(deck, count); err != nil {
+			t.Fatalf("Draw() err = %s, want nil", err)
+		}
+	}
+	if err := undo(ds, deck); err != nil {
+		t.Fatalf("Undo() err = %s, want nil", err)
+	}
+	drawn := deck.state()
+	if _, err := ds.Draw(deck, 5); err != nil {
+		t.Fatalf("Draw() err = %s, want nil", err)
+	}
+
+	if err := undo(ds, deck); err != nil {
+		t.Fatalf("Undo() err = %s, want nil", err)
+	}
+	if got := deck.state(); !reflect.DeepEqual(got, drawn) {
+		t.Errorf("Undo() state = %+v, want %+v", got, drawn)
+	}
+	if err := undo(ds, deck); err != nil {
+		t.Fatalf("Undo() err = %s, want nil", err)
+	}
+	if got := deck.state(); !reflect.DeepEqual(got, created) {
+		t.Errorf("Undo() state = %+v, want %+v", got, created)
+	}
+}
+
+func Test_deckService_Undo_Refused(t *testing.T) {
+	t.Run("version required", func(t *testing.T) {
+		ds := NewDeckService(NewCardService())
+		deck := &Deck{}
+		_ = ds.Create(deck)
+		_, _ = ds.Draw(deck, 1)
+		if err := ds.Undo(deck); err != ErrVersionRequired {
+			t.Errorf("Undo() err = %v, want ErrVersionRequired", err)
+		}
+	})
+
+	t.Run("changed by another client", func(t *testing.T) {
+		ds := NewDeckService(NewCardService())
+		deck := &Deck{}
+		_ = ds.Create(deck)
+		_, _ = ds.Draw(deck, 1)
+		stale := *deck
+		_, _ = ds.Draw(deck, 1)
+		if err := undo(ds, &stale); err != ErrVersionMismatch {
+			t.Errorf("Undo() err = %v, want ErrVersionMismatch", err)
+		}
+	})
+
+	t.Run("depth", func(t *testing.T) {
+		ds := NewDeckService(NewCardService(), WithUndoDepth(1))
+		deck := &Deck{}
+		_ = ds.Create(deck)
+		_, _ = ds.Draw(deck, 1)
+		_, _ = ds.Draw(deck, 1)
+		if err := undo(ds, deck); err != nil {
+			t.Fatalf("Undo() err = %s, want nil", err)
+		}
+		if err := undo(ds, deck); err != ErrNothingToUndo {
+			t.Errorf("Undo() err = %v, want ErrNothingToUndo", err)
+		}
+	})
+
+	t.Run("fair deck opened", func(t *testing.T) {
+		ds := NewDeckService(NewCardService())
+		deck := &Deck{Shuffled: true, Shuffler: ShufflerFair}
+		if err := ds.Create(deck); err != nil {
+			t.Fatalf("Create() err = %s, want nil", err)
+		}
+		_ = ds.Open(deck)
+		if err := undo(ds, deck); err != ErrNothingToUndo {
+			t.Errorf("Undo() err = %v, want ErrNothingToUndo", err)
+		}
+	})
+
+	t.Run("not supported", func(t *testing.T) {
+		storage := struct{ DeckStorage }{NewDeckMemory()}
+		ds := NewDeckService(NewCardService(), WithDeckStorage(storage))
+		if err := ds.Undo(&Deck{IfMatch: 1}); err != ErrEventsNotSupported {
+			t.Errorf("Undo() err = %v, want ErrEventsNotSupported", err)
+		}
+	})
+}
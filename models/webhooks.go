@@ -0,0 +1,509 @@
+package models
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrWebhookNotFound     = errors.New("webhook not found")
+	ErrWebhookURLInvalid   = errors.New("webhook url must be an absolute http or https url")
+	ErrWebhookURLPrivate   = errors.New("webhook url must not target a loopback, link-local or private address")
+	ErrWebhookEventUnknown = errors.New("webhook event is unknown")
+	ErrWebhookLimit        = errors.New("deck has too many webhooks")
+	ErrWebhooksClosed      = errors.New("webhooks are closed")
+	ErrWebhookQueueFull    = errors.New("webhook delivery queue is full")
+)
+
+// Types of the webhook notifications
+const (
+	WebhookDeckCreated = "deck.created"
+	WebhookCardsDrawn  = "cards.drawn"
+	WebhookDeckEmpty   = "deck.empty"
+	WebhookDeckOpened  = "deck.opened"
+)
+
+// Headers of the webhook requests
+const (
+	WebhookIDHeader        = "Webhook-Id"
+	WebhookTimestampHeader = "Webhook-Timestamp"
+	WebhookSignatureHeader = "Webhook-Signature"
+)
+
+const (
+	// MaxDeckWebhooks is the number of the webhooks a deck can have
+	MaxDeckWebhooks = 10
+	// MaxDeadLetters is the number of the failed deliveries kept, older ones are dropped
+	MaxDeadLetters = 1000
+	// DefaultWebhookAttempts is the number of the delivery attempts by default
+	DefaultWebhookAttempts = 5
+	// DefaultWebhookBackoff is the delay before the first retry by default, it doubles after every retry
+	DefaultWebhookBackoff = time.Second
+	// DefaultWebhookWorkers is the number of the concurrent deliveries by default
+	DefaultWebhookWorkers = 4
+	// webhookQueueSize is the number of the deliveries waiting for a worker
+	webhookQueueSize = 1024
+	// webhookTimeout is the longest time of a delivery attempt
+	webhookTimeout = 10 * time.Second
+)
+
+// webhookTypes are the notification types sent for the deck events
+var webhookTypes = map[string]string{
+	EventCreated: WebhookDeckCreated,
+	EventDrawn:   WebhookCardsDrawn,
+	EventOpened:  WebhookDeckOpened,
+}
+
+// webhookMetrics are published by expvar as webhooks
+// delivered, retried and dead count the delivery outcomes
+var webhookMetrics = expvar.NewMap("webhooks")
+
+// Webhook is a registered receiver of the deck notifications
+// Webhooks without DeckID receive the notifications of every deck
+// Events are the notification types to send, all types are sent if empty
+// Secret signs the requests, it is generated on registration
+type Webhook struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	DeckID    string    `json:"deck_id,omitempty"`
+	Events    []string  `json:"events,omitempty"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookPayload is the body of the webhook requests
+// ID identifies the notification, it is same on every attempt
+type WebhookPayload struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	DeckID    string    `json:"deck_id"`
+	Seq       int       `json:"seq"`
+	At        time.Time `json:"at"`
+	Actor     string    `json:"actor,omitempty"`
+	Cards     []string  `json:"cards,omitempty"`
+	Remaining int       `json:"remaining"`
+}
+
+// DeadLetter is a notification which could not be delivered
+type DeadLetter struct {
+	WebhookID string         `json:"webhook_id"`
+	URL       string         `json:"url"`
+	Payload   WebhookPayload `json:"payload"`
+	Attempts  int            `json:"attempts"`
+	Error     string         `json:"error"`
+	At        time.Time      `json:"at"`
+}
+
+// WebhooksOption is used to configure Webhooks
+type WebhooksOption func(*Webhooks)
+
+// WithWebhookClient sets the client sending the webhook requests
+// Given client is responsible of refusing the private addresses, see WithPrivateWebhookTargets
+func WithWebhookClient(client *http.Client) WebhooksOption {
+	return func(wh *Webhooks) {
+		wh.client = client
+	}
+}
+
+// WithWebhookRetries sets the number of the delivery attempts and the delay before the first retry
+func WithWebhookRetries(attempts int, backoff time.Duration) WebhooksOption {
+	return func(wh *Webhooks) {
+		wh.attempts = attempts
+		wh.backoff = backoff
+	}
+}
+
+// WithPrivateWebhookTargets allows the webhooks of the loopback, link-local and private addresses
+// They are refused by default, so the webhooks can not reach the internal services of the server
+func WithPrivateWebhookTargets() WebhooksOption {
+	return func(wh *Webhooks) {
+		wh.private = true
+	}
+}
+
+// WithWebhooks makes the service notify the webhooks of the deck events
+func WithWebhooks(wh *Webhooks) DeckServiceOption {
+	return func(cfg *deckServiceConfig) {
+		cfg.webhooks = wh
+	}
+}
+
+// Webhooks keeps the registered webhooks and delivers the notifications to them
+// Notifications are delivered in the background, failed attempts are retried with exponential backoff
+// and the notifications failed on every attempt are kept as dead letters
+type Webhooks struct {
+	client   *http.Client
+	attempts int
+	backoff  time.Duration
+	// private allows the private target addresses
+	private bool
+
+	mu     sync.RWMutex
+	hooks  map[string]*Webhook
+	closed bool
+
+	deadMu sync.Mutex
+	dead   []DeadLetter
+
+	queue   chan *delivery
+	done    chan struct{}
+	workers sync.WaitGroup
+}
+
+// delivery is a notification to a webhook
+type delivery struct {
+	hook    Webhook
+	payload WebhookPayload
+	body    []byte
+	attempt int
+}
+
+// NewWebhooks returns Webhooks by defaults and starts its workers
+// Defaults can be overridden by given options
+func NewWebhooks(opts ...WebhooksOption) *Webhooks {
+	wh := &Webhooks{
+		attempts: DefaultWebhookAttempts,
+		backoff:  DefaultWebhookBackoff,
+		hooks:    map[string]*Webhook{},
+		queue:    make(chan *delivery, webhookQueueSize),
+		done:     make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(wh)
+	}
+	if wh.client == nil {
+		wh.client = newWebhookClient(wh.private)
+	}
+	for i := 0; i < DefaultWebhookWorkers; i++ {
+		wh.workers.Add(1)
+		go wh.work()
+	}
+	return wh
+}
+
+// Register validates and stores the webhook, sets its id, secret and creation time
+// Returns ErrWebhookURLInvalid if url is not an absolute http or https url
+// Returns ErrWebhookURLPrivate if url host is a private address, host names are checked on delivery
+// Returns ErrWebhookEventUnknown if any event is not a notification type
+// Returns ErrWebhookLimit if the deck has MaxDeckWebhooks webhooks
+func (wh *Webhooks) Register(hook *Webhook) error {
+	u, err := url.Parse(hook.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrWebhookURLInvalid
+	}
+	if ip := net.ParseIP(u.Hostname()); ip != nil && !wh.private && !publicIP(ip) {
+		return ErrWebhookURLPrivate
+	}
+	for _, event := range hook.Events {
+		switch event {
+		case WebhookDeckCreated, WebhookCardsDrawn, WebhookDeckEmpty, WebhookDeckOpened:
+		default:
+			return ErrWebhookEventUnknown
+		}
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return err
+	}
+
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+	if hook.DeckID != "" && len(wh.webhooksOf(hook.DeckID)) >= MaxDeckWebhooks {
+		return ErrWebhookLimit
+	}
+	hook.ID = uuid.NewString()
+	hook.Secret = hex.EncodeToString(secret)
+	hook.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	c := copyWebhook(hook)
+	wh.hooks[hook.ID] = &c
+	return nil
+}
+
+// Webhooks returns the webhooks of the deck without secrets in creation order
+// Global webhooks are returned if deckID is empty
+func (wh *Webhooks) Webhooks(deckID string) []*Webhook {
+	wh.mu.RLock()
+	defer wh.mu.RUnlock()
+	hooks := wh.webhooksOf(deckID)
+	for _, hook := range hooks {
+		hook.Secret = ""
+	}
+	return hooks
+}
+
+// Unregister removes the webhook of the deck by id
+// Returns ErrWebhookNotFound if the deck has no webhook of the id
+func (wh *Webhooks) Unregister(deckID, id string) error {
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+	hook, ok := wh.hooks[id]
+	if !ok || hook.DeckID != deckID {
+		return ErrWebhookNotFound
+	}
+	delete(wh.hooks, id)
+	return nil
+}
+
+// forget removes the webhooks of the deleted deck
+func (wh *Webhooks) forget(deckID string) {
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+	for id, hook := range wh.hooks {
+		if hook.DeckID == deckID {
+			delete(wh.hooks, id)
+		}
+	}
+}
+
+// DeadLetters returns the notifications failed on every attempt, latest first
+func (wh *Webhooks) DeadLetters() []DeadLetter {
+	wh.deadMu.Lock()
+	defer wh.deadMu.Unlock()
+	letters := make([]DeadLetter, len(wh.dead))
+	for i := range wh.dead {
+		letters[i] = wh.dead[len(wh.dead)-1-i]
+	}
+	return letters
+}
+
+// Notify queues the notifications of the deck event to the subscribed webhooks
+// Draws and deals emptying the deck are notified as WebhookDeckEmpty
+// It does not wait for the deliveries
+func (wh *Webhooks) Notify(deck *Deck, event DeckEvent) {
+	var types []string
+	if typ, ok := webhookTypes[event.Type]; ok {
+		types = append(types, typ)
+	}
+	if (event.Type == EventDrawn || event.Type == EventDealt) && deck.Remaining == 0 {
+		types = append(types, WebhookDeckEmpty)
+	}
+	if len(types) == 0 {
+		return
+	}
+
+	wh.mu.RLock()
+	hooks := append(wh.webhooksOf(""), wh.webhooksOf(deck.UUID)...)
+	wh.mu.RUnlock()
+	for _, typ := range types {
+		payload := WebhookPayload{
+			ID:        uuid.NewString(),
+			Type:      typ,
+			DeckID:    deck.UUID,
+			Seq:       event.Seq,
+			At:        event.At,
+			Actor:     event.Actor,
+			Cards:     event.Cards,
+			Remaining: deck.Remaining,
+		}
+		body, err := json.Marshal(payload)
+		if err != nil {
+			continue
+		}
+		for _, hook := range hooks {
+			if hook.subscribed(typ) {
+				wh.enqueue(&delivery{hook: *hook, payload: payload, body: body})
+			}
+		}
+	}
+}
+
+// Close stops the deliveries and waits for the attempts in progress
+// Queued and retried notifications are kept as dead letters with ErrWebhooksClosed
+func (wh *Webhooks) Close() {
+	wh.mu.Lock()
+	if wh.closed {
+		wh.mu.Unlock()
+		return
+	}
+	wh.closed = true
+	wh.mu.Unlock()
+	close(wh.done)
+	wh.workers.Wait()
+	for {
+		select {
+		case d := <-wh.queue:
+			wh.bury(d, ErrWebhooksClosed)
+		default:
+			return
+		}
+	}
+}
+
+// SignWebhook returns the signature of the webhook request
+// It is the hex encoded HMAC-SHA256 of the id, timestamp and body joined by dots, prefixed by v1=
+func SignWebhook(secret, id string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s.%d.", id, timestamp)
+	mac.Write(body)
+	return "v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhooksOf returns the copies of the webhooks of the deck in creation order, webhooks must be locked
+func (wh *Webhooks) webhooksOf(deckID string) []*Webhook {
+	hooks := make([]*Webhook, 0)
+	for _, hook := range wh.hooks {
+		if hook.DeckID == deckID {
+			c := copyWebhook(hook)
+			hooks = append(hooks, &c)
+		}
+	}
+	sort.Slice(hooks, func(i, j int) bool {
+		if !hooks[i].CreatedAt.Equal(hooks[j].CreatedAt) {
+			return hooks[i].CreatedAt.Before(hooks[j].CreatedAt)
+		}
+		return hooks[i].ID < hooks[j].ID
+	})
+	return hooks
+}
+
+// enqueue queues the delivery without blocking
+// Delivery is kept as dead letter if webhooks are closed or the queue is full
+func (wh *Webhooks) enqueue(d *delivery) {
+	wh.mu.RLock()
+	defer wh.mu.RUnlock()
+	if wh.closed {
+		wh.bury(d, ErrWebhooksClosed)
+		return
+	}
+	select {
+	case wh.queue <- d:
+	default:
+		wh.bury(d, ErrWebhookQueueFull)
+	}
+}
+
+// work delivers the queued notifications until webhooks are closed
+func (wh *Webhooks) work() {
+	defer wh.workers.Done()
+	for {
+		select {
+		case <-wh.done:
+			return
+		case d := <-wh.queue:
+			wh.deliver(d)
+		}
+	}
+}
+
+// deliver attempts the delivery and schedules its retry if it fails
+func (wh *Webhooks) deliver(d *delivery) {
+	d.attempt++
+	err := wh.send(d)
+	if err == nil {
+		webhookMetrics.Add("delivered", 1)
+		return
+	}
+	if d.attempt >= wh.attempts {
+		wh.bury(d, err)
+		return
+	}
+	webhookMetrics.Add("retried", 1)
+	backoff := wh.backoff << (d.attempt - 1)
+	time.AfterFunc(backoff, func() { wh.enqueue(d) })
+}
+
+// send posts the signed payload, responses other than 2xx are failures
+func (wh *Webhooks) send(d *delivery) error {
+	req, err := http.NewRequest(http.MethodPost, d.hook.URL, bytes.NewReader(d.body))
+	if err != nil {
+		return err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookIDHeader, d.payload.ID)
+	req.Header.Set(WebhookTimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(d.hook.Secret, d.payload.ID, timestamp, d.body))
+	resp, err := wh.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return nil
+}
+
+// newWebhookClient returns the client of the webhook requests
+// Connections to the private addresses are refused unless private is set,
+// addresses are checked after the resolution so host names of private addresses are refused too
+func newWebhookClient(private bool) *http.Client {
+	dialer := &net.Dialer{Timeout: webhookTimeout}
+	if !private {
+		dialer.Control = func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+				return ErrWebhookURLPrivate
+			}
+			return nil
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// proxies would connect to the targets without the address check
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: webhookTimeout, Transport: transport}
+}
+
+// publicIP reports whether the ip is not a loopback, link-local, private or unspecified address
+func publicIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsPrivate() && !ip.IsUnspecified()
+}
+
+// bury keeps the delivery as dead letter
+func (wh *Webhooks) bury(d *delivery, err error) {
+	webhookMetrics.Add("dead", 1)
+	wh.deadMu.Lock()
+	defer wh.deadMu.Unlock()
+	wh.dead = append(wh.dead, DeadLetter{
+		WebhookID: d.hook.ID,
+		URL:       d.hook.URL,
+		Payload:   d.payload,
+		Attempts:  d.attempt,
+		Error:     err.Error(),
+		At:        time.Now().UTC().Truncate(time.Second),
+	})
+	if len(wh.dead) > MaxDeadLetters {
+		wh.dead = wh.dead[len(wh.dead)-MaxDeadLetters:]
+	}
+}
+
+// subscribed reports whether the webhook receives the notification type
+func (hook *Webhook) subscribed(typ string) bool {
+	if len(hook.Events) == 0 {
+		return true
+	}
+	for _, event := range hook.Events {
+		if event == typ {
+			return true
+		}
+	}
+	return false
+}
+
+func copyWebhook(hook *Webhook) Webhook {
+	c := *hook
+	c.Events = append([]string(nil), hook.Events...)
+	return c
+}
@@ -0,0 +1,284 @@
+package models
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// receiver is a webhook endpoint checking the signatures of the requests
+// Requests are replied by the status returned by respond
+func receiver(t *testing.T, secret *string, respond func() int) (*httptest.Server, chan WebhookPayload) {
+	received := make(chan WebhookPayload, 100)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp, _ := strconv.ParseInt(r.Header.Get(WebhookTimestampHeader), 10, 64)
+		want := SignWebhook(*secret, r.Header.Get(WebhookIDHeader), timestamp, body)
+		if got := r.Header.Get(WebhookSignatureHeader); got != want {
+			t.Errorf("%s got = %v, want %v", WebhookSignatureHeader, got, want)
+		}
+		status := respond()
+		w.WriteHeader(status)
+		if status == http.StatusOK {
+			var payload WebhookPayload
+			json.Unmarshal(body, &payload)
+			received <- payload
+		}
+	}))
+	return srv, received
+}
+
+func receive(t *testing.T, received chan WebhookPayload) WebhookPayload {
+	select {
+	case payload := <-received:
+		return payload
+	case <-time.After(5 * time.Second):
+		t.Fatalf("webhook is not notified")
+		return WebhookPayload{}
+	}
+}
+
+func TestWebhooks_Notify(t *testing.T) {
+	// receivers listen on loopback
+	wh := NewWebhooks(WithPrivateWebhookTargets())
+	defer wh.Close()
+	ds := NewDeckService(NewCardService(), WithWebhooks(wh))
+
+	var globalSecret, deckSecret string
+	global, globalReceived := receiver(t, &globalSecret, func() int { return http.StatusOK })
+	defer global.Close()
+	hook := &Webhook{URL: global.URL, Events: []string{WebhookDeckCreated}}
+	if err := wh.Register(hook); err != nil {
+		t.Fatalf("Register() err = %s, want nil", err)
+	}
+	globalSecret = hook.Secret
+
+	deck := &Deck{}
+	if err := ds.Create(deck); err != nil {
+		t.Fatalf("Create() err = %s, want nil", err)
+	}
+	if got := receive(t, globalReceived); got.Type != WebhookDeckCreated || got.DeckID != deck.UUID || got.Remaining != 52 {
+		t.Errorf("global webhook got = %+v, want %v of the deck", got, WebhookDeckCreated)
+	}
+
+	perDeck, deckReceived := receiver(t, &deckSecret, func() int { return http.StatusOK })
+	defer perDeck.Close()
+	hook = &Webhook{URL: perDeck.URL, DeckID: deck.UUID}
+	if err := wh.Register(hook); err != nil {
+		t.Fatalf("Register() err = %s, want nil", err)
+	}
+	deckSecret = hook.Secret
+
+	deck.Actor = "dealer"
+	if _, err := ds.Draw(deck, 52); err != nil {
+		t.Fatalf("Draw() err = %s, want nil", err)
+	}
+	if err := ds.Open(deck); err != nil {
+		t.Fatalf("Open() err = %s, want nil", err)
+	}
+	types := map[string]WebhookPayload{}
+	for i := 0; i < 3; i++ {
+		payload := receive(t, deckReceived)
+		types[payload.Type] = payload
+	}
+	if got := types[WebhookCardsDrawn]; got.Seq != 2 || got.Actor != "dealer" || len(got.Cards) != 52 || got.Remaining != 0 {
+		t.Errorf("deck webhook got = %+v, want 52 cards drawn by dealer", got)
+	}
+	if got := types[WebhookDeckEmpty]; got.Seq != 2 {
+		t.Errorf("deck webhook got = %+v, want %v of seq 2", got, WebhookDeckEmpty)
+	}
+	if got := types[WebhookDeckOpened]; got.Seq != 3 {
+		t.Errorf("deck webhook got = %+v, want %v of seq 3", got, WebhookDeckOpened)
+	}
+	select {
+	case payload := <-globalReceived:
+		t.Errorf("global webhook got = %+v, want only %v", payload, WebhookDeckCreated)
+	default:
+	}
+
+	if err := ds.Delete(deck.UUID); err != nil {
+		t.Fatalf("Delete() err = %s, want nil", err)
+	}
+	if got := wh.Webhooks(deck.UUID); len(got) != 0 {
+		t.Errorf("Webhooks() of deleted deck got = %v, want none", got)
+	}
+}
+
+func TestWebhooks_Retry(t *testing.T) {
+	wh := NewWebhooks(WithWebhookRetries(3, time.Millisecond), WithPrivateWebhookTargets())
+	defer wh.Close()
+
+	var secret string
+	var calls int32
+	flaky, received := receiver(t, &secret, func() int {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			return http.StatusInternalServerError
+		}
+		return http.StatusOK
+	})
+	defer flaky.Close()
+	hook := &Webhook{URL: flaky.URL, DeckID: "deck"}
+	if err := wh.Register(hook); err != nil {
+		t.Fatalf("Register() err = %s, want nil", err)
+	}
+	secret = hook.Secret
+
+	deck := &Deck{UUID: "deck", Remaining: 1}
+	wh.Notify(deck, DeckEvent{Type: EventOpened, Seq: 2})
+	if got := receive(t, received); got.Type != WebhookDeckOpened || got.Seq != 2 {
+		t.Errorf("webhook got = %+v, want %v of seq 2", got, WebhookDeckOpened)
+	}
+	if got := atomic.LoadInt32(&calls); got != 3 {
+		t.Errorf("webhook calls = %v, want 3", got)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	if err := wh.Unregister("deck", hook.ID); err != nil {
+		t.Fatalf("Unregister() err = %s, want nil", err)
+	}
+	hook = &Webhook{URL: failing.URL, DeckID: "deck"}
+	if err := wh.Register(hook); err != nil {
+		t.Fatalf("Register() err = %s, want nil", err)
+	}
+	wh.Notify(deck, DeckEvent{Type: EventOpened, Seq: 3})
+	deadline := time.Now().Add(5 * time.Second)
+	for len(wh.DeadLetters()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	letters := wh.DeadLetters()
+	if len(letters) != 1 {
+		t.Fatalf("DeadLetters() got %d letters, want 1", len(letters))
+	}
+	if got := letters[0]; got.WebhookID != hook.ID || got.Attempts != 3 || got.Payload.Seq != 3 || got.Error == "" {
+		t.Errorf("DeadLetters()[0] = %+v, want 3 failed attempts of seq 3", got)
+	}
+}
+
+func TestWebhooks_Register(t *testing.T) {
+	wh := NewWebhooks()
+	defer wh.Close()
+	for i := 0; i < MaxDeckWebhooks; i++ {
+		if err := wh.Register(&Webhook{URL: "http://example.com/hook", DeckID: "full"}); err != nil {
+			t.Fatalf("Register() err = %s, want nil", err)
+		}
+	}
+	tests := []struct {
+		name    string
+		hook    Webhook
+		wantErr error
+	}{
+		{
+			name: "global",
+			hook: Webhook{URL: "https://example.com/hook", Events: []string{WebhookDeckEmpty}},
+		},
+		{
+			name:    "relative url",
+			hook:    Webhook{URL: "/hook"},
+			wantErr: ErrWebhookURLInvalid,
+		},
+		{
+			name:    "unsupported scheme",
+			hook:    Webhook{URL: "ftp://example.com/hook"},
+			wantErr: ErrWebhookURLInvalid,
+		},
+		{
+			name:    "loopback",
+			hook:    Webhook{URL: "http://127.0.0.1:3000/hook"},
+			wantErr: ErrWebhookURLPrivate,
+		},
+		{
+			name:    "link-local",
+			hook:    Webhook{URL: "http://169.254.169.254/latest/meta-data"},
+			wantErr: ErrWebhookURLPrivate,
+		},
+		{
+			name:    "private",
+			hook:    Webhook{URL: "https://10.0.0.1/hook"},
+			wantErr: ErrWebhookURLPrivate,
+		},
+		{
+			name:    "private ipv6",
+			hook:    Webhook{URL: "http://[::1]/hook"},
+			wantErr: ErrWebhookURLPrivate,
+		},
+		{
+			name:    "unknown event",
+			hook:    Webhook{URL: "https://example.com/hook", Events: []string{"deck.lost"}},
+			wantErr: ErrWebhookEventUnknown,
+		},
+		{
+			name:    "too many",
+			hook:    Webhook{URL: "https://example.com/hook", DeckID: "full"},
+			wantErr: ErrWebhookLimit,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := wh.Register(&tt.hook)
+			if err != tt.wantErr {
+				t.Fatalf("Register() err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (tt.hook.ID == "" || len(tt.hook.Secret) != 64) {
+				t.Errorf("Register() got = %+v, want id and secret", tt.hook)
+			}
+		})
+	}
+	if got := wh.Webhooks(""); len(got) != 1 || got[0].Secret != "" {
+		t.Errorf("Webhooks() got = %+v, want one webhook without secret", got)
+	}
+}
+
+func TestWebhooks_PrivateTarget(t *testing.T) {
+	wh := NewWebhooks(WithWebhookRetries(1, time.Millisecond))
+	defer wh.Close()
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	}))
+	defer srv.Close()
+	if err := wh.Register(&Webhook{URL: srv.URL}); err != ErrWebhookURLPrivate {
+		t.Errorf("Register() of loopback address err = %v, want %v", err, ErrWebhookURLPrivate)
+	}
+
+	// host name is resolved to the loopback address on delivery
+	_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	if err := wh.Register(&Webhook{URL: "http://localhost:" + port + "/hook"}); err != nil {
+		t.Fatalf("Register() err = %s, want nil", err)
+	}
+	wh.Notify(&Deck{UUID: "deck"}, DeckEvent{Type: EventCreated, Seq: 1})
+	deadline := time.Now().Add(5 * time.Second)
+	for len(wh.DeadLetters()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	letters := wh.DeadLetters()
+	if len(letters) != 1 || !strings.Contains(letters[0].Error, ErrWebhookURLPrivate.Error()) {
+		t.Errorf("DeadLetters() got = %+v, want a letter of %v", letters, ErrWebhookURLPrivate)
+	}
+	if got := atomic.LoadInt32(&calls); got != 0 {
+		t.Errorf("webhook calls = %v, want 0", got)
+	}
+}
+
+func TestWebhooks_Close(t *testing.T) {
+	wh := NewWebhooks()
+	if err := wh.Register(&Webhook{URL: "http://example.com/hook"}); err != nil {
+		t.Fatalf("Register() err = %s, want nil", err)
+	}
+	wh.Close()
+	wh.Close()
+	wh.Notify(&Deck{UUID: "deck"}, DeckEvent{Type: EventCreated, Seq: 1})
+	letters := wh.DeadLetters()
+	if len(letters) != 1 || letters[0].Error != ErrWebhooksClosed.Error() {
+		t.Errorf("DeadLetters() got = %+v, want a letter of %v", letters, ErrWebhooksClosed)
+	}
+}